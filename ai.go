@@ -2,10 +2,14 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	mathrand "math/rand"
 	"net/http"
+	"os"
 	"time"
 
 	"go.uber.org/zap"
@@ -50,10 +54,150 @@ type AgentResponse struct {
 	Data      map[string]interface{} `json:"data"`       // 数据
 }
 
+// agentCallRequest 一次 Agent 调用的参数
+type agentCallRequest struct {
+	ChatID       string             // 会话ID
+	EventType    string             // 事件类型，如 user_input、post_reply_analysis
+	Contents     []AgentCallContent // 事件内容
+	Tools        []interface{}      // 可供 Agent 调用的工具定义
+	Redactor     *PIIRedactor       // 本次请求的敏感信息脱敏器，为 nil 时不脱敏
+	Agent        *AgentInfo         // 处理本次请求的 Agent，为 nil 时使用默认 Agent
+	AgentURL     string             // Agent API 地址，为空时使用 AGENT_API_URL
+	SuggestionID string             // 本次调用生成的建议ID，记录在审计日志中
+	Stateless    bool               // 不复用也不保存 Agent 会话，用于意图分类等辅助调用
+}
+
+// contentText 将 WeComMessage.Content 转为文本
+// Content 为 JSON 字符串时返回解码后的文本，否则返回原始 JSON
+func contentText(content json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return text
+	}
+	return string(content)
+}
+
+// agentResponseText 从 Agent 响应中提取文本内容
+// data 结构: { "0": { "type": "text", "content": "..." } }
+func agentResponseText(agentResp *AgentResponse) string {
+	if agentResp == nil || agentResp.Data == nil {
+		return ""
+	}
+
+	// 先尝试从 "0" key 获取内容对象
+	if contentObj, ok := agentResp.Data["0"].(map[string]interface{}); ok {
+		// 从内容对象中提取 content 字段
+		if content, ok := contentObj["content"].(string); ok {
+			return content
+		}
+		return ""
+	}
+
+	// 向后兼容：尝试直接从 data 中提取（旧格式）
+	for _, key := range []string{"text", "response", "content"} {
+		if text, ok := agentResp.Data[key].(string); ok && text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// defaultSuggestionConfidence Agent 未返回置信度时建议的默认置信度
+const defaultSuggestionConfidence = 0.8
+
+// agentResponseConfidence 从 Agent 响应中提取建议的置信度（data.confidence，0-1），未返回时使用默认值
+func agentResponseConfidence(agentResp *AgentResponse) float64 {
+	if agentResp != nil {
+		if confidence, ok := agentResp.Data["confidence"].(float64); ok && confidence >= 0 && confidence <= 1 {
+			return confidence
+		}
+	}
+	return defaultSuggestionConfidence
+}
+
 // triggerNextAIAnalysis 触发AI分析后续对话
+// 客服发送回复后，结合最近的会话上下文进行第二轮 AI 分析，
+// 给出下一步提示、缺失信息检查和回复质量评分
 func (c *WeComClient) triggerNextAIAnalysis(msg WeComMessage) {
-	// TODO: 实现AI分析逻辑
-	logger.Info("触发AI分析", zap.String("agent_id", c.AgentID), zap.String("chat_id", c.ChatID))
+	chatID := msg.ChatID
+	if chatID == "" {
+		chatID = c.ChatID
+	}
+
+	reply := contentText(msg.Content)
+	if reply == "" {
+		logger.Debug("客服回复内容为空，跳过AI分析", zap.String("agent_id", c.AgentID), zap.String("chat_id", chatID))
+		return
+	}
+
+	logger.Info("触发AI分析", zap.String("agent_id", c.AgentID), zap.String("chat_id", chatID), zap.String("msg_id", msg.MsgID))
+
+	// 最近的会话上下文
+	history := chatHistory.Recent(chatID, getEnvInt("AI_ANALYSIS_CONTEXT_SIZE", 10))
+
+	// 会话内容脱敏后再发送给 Agent，分析结果中的占位符还原后展示给客服
+	redactor := newPIIRedactor()
+
+	// 分析不会被新消息取代，只在客户端断开时取消
+	agentResp, err := c.callAgentWithTools(c.ctx, agentCallRequest{
+		ChatID:    chatID,
+		EventType: "post_reply_analysis",
+		Contents: []AgentCallContent{
+			{Type: "context", Content: history},
+			{Type: "agent_reply", Content: reply},
+		},
+		Redactor: redactor,
+	})
+	if errors.Is(err, ErrCircuitOpen) {
+		logger.Warn("Agent API 已熔断，跳过AI分析", zap.String("agent_id", c.AgentID), zap.String("chat_id", chatID))
+		c.notifyAIUnavailable(chatID, "")
+		return
+	}
+	var throttle *ThrottleError
+	if errors.As(err, &throttle) {
+		logger.Warn("AI分析被限流，跳过",
+			zap.String("agent_id", c.AgentID),
+			zap.String("chat_id", chatID),
+			zap.String("scope", throttle.Scope))
+		return
+	}
+	if err != nil {
+		logger.Error("AI分析调用 Agent API 失败",
+			zap.String("agent_id", c.AgentID),
+			zap.String("chat_id", chatID),
+			zap.Error(err))
+		return
+	}
+
+	analysis := parseReplyAnalysis(agentResp)
+	for i, hint := range analysis.NextStepHints {
+		analysis.NextStepHints[i] = redactor.Restore(hint)
+	}
+	for i, info := range analysis.MissingInfo {
+		analysis.MissingInfo[i] = redactor.Restore(info)
+	}
+
+	// 发送分析结果给侧边栏
+	if err := c.SendMessage(map[string]interface{}{
+		"type":            "ai_analysis",
+		"agent_id":        c.AgentID,
+		"chat_id":         chatID,
+		"msg_id":          msg.MsgID,
+		"next_step_hints": analysis.NextStepHints,
+		"missing_info":    analysis.MissingInfo,
+		"quality_score":   analysis.QualityScore,
+	}); err != nil {
+		logger.Error("发送AI分析结果失败", zap.String("agent_id", c.AgentID), zap.Error(err))
+	}
+
+	// 保存分析结果
+	if err := createReplyAnalysis(c.AgentID, chatID, msg.MsgID, reply, analysis); err != nil {
+		logger.Error("保存AI分析结果失败",
+			zap.String("agent_id", c.AgentID),
+			zap.String("chat_id", chatID),
+			zap.String("msg_id", msg.MsgID),
+			zap.Error(err))
+	}
 }
 
 // handleAIFeedback 处理AI建议反馈
@@ -63,8 +207,8 @@ func (c *WeComClient) handleAIFeedback(msg WeComMessage) {
 		zap.String("chat_id", c.ChatID),
 		zap.String("suggestion_id", msg.SuggestionID),
 		zap.String("action", msg.Action),
-		zap.String("original_content", msg.OriginalContent),
-		zap.String("edited_content", msg.EditedContent))
+		zap.String("original_content", redactForLog(msg.OriginalContent)),
+		zap.String("edited_content", redactForLog(msg.EditedContent)))
 
 	// 验证必要字段
 	if msg.SuggestionID == "" {
@@ -77,6 +221,9 @@ func (c *WeComClient) handleAIFeedback(msg WeComMessage) {
 		return
 	}
 
+	// 建议已被处理，不再需要通知取代
+	c.resolveSuggestion(msg.SuggestionID)
+
 	// 更新数据库中的反馈信息
 	if err := updateSuggestionFeedback(msg.SuggestionID, msg.Action, msg.OriginalContent, msg.EditedContent); err != nil {
 		logger.Error("更新 suggestion 反馈信息失败",
@@ -91,138 +238,465 @@ func (c *WeComClient) handleAIFeedback(msg WeComMessage) {
 			zap.String("chat_id", c.ChatID),
 			zap.String("suggestion_id", msg.SuggestionID),
 			zap.String("action", msg.Action),
-			zap.String("original_content", msg.OriginalContent),
-			zap.String("edited_content", msg.EditedContent))
+			zap.String("original_content", redactForLog(msg.OriginalContent)),
+			zap.String("edited_content", redactForLog(msg.EditedContent)))
+
+		// 直接采用的建议写入缓存，命中缓存后被拒绝的建议从缓存移除
+		if err := learnSuggestionCache(msg.SuggestionID, msg.Action); err != nil {
+			logger.Warn("更新建议缓存失败", zap.String("suggestion_id", msg.SuggestionID), zap.Error(err))
+		}
+
+		// 记录客服对建议的修改
+		if normalizeFeedbackAction(msg.Action) == feedbackActionEdit {
+			if err := recordSuggestionDiff(msg.SuggestionID, msg.EditedContent, diffSourceFeedback); err != nil {
+				logger.Warn("记录 suggestion 差异失败", zap.String("suggestion_id", msg.SuggestionID), zap.Error(err))
+			}
+		}
 	}
 }
 
 // handleAIAssistanceRequest 处理AI协助请求
 func (c *WeComClient) handleAIAssistanceRequest(msg WeComMessage) {
-	logger.Info("收到AI协助请求", zap.String("agent_id", c.AgentID), zap.String("chat_id", c.ChatID))
+	// 轮询触发的请求携带具体的 chatId，手动触发时使用当前会话
+	chatID := msg.ChatID
+	if chatID == "" {
+		chatID = c.ChatID
+	}
+
+	logger.Info("收到AI协助请求", zap.String("agent_id", c.AgentID), zap.String("chat_id", chatID))
 
 	// msg.Content 为 string 类型，直接使用
-	logger.Debug("AI协助请求 context", zap.String("agent_id", c.AgentID), zap.String("chat_id", c.ChatID), zap.String("context", string(msg.Content)))
+	logger.Debug("AI协助请求 context", zap.String("agent_id", c.AgentID), zap.String("chat_id", chatID), zap.String("context", redactForLog(string(msg.Content))))
 
-	// 调用 Agent API 获取建议
-	agentResp, err := c.callAgentAPI(msg.Content)
-	if err != nil {
-		logger.Error("调用 Agent API 失败",
-			zap.String("agent_id", c.AgentID),
-			zap.String("chat_id", c.ChatID),
-			zap.Error(err))
-		return
-	}
+	// A/B 实验：按会话或客服确定性分组，变体可替换后端、Agent 版本或提示词
+	assignment := assignExperiment(c.AgentID, chatID)
 
-	// 从 Agent 响应中提取建议文本
-	suggestionText := ""
-	confidence := 0.8
-
-	// 尝试从 data 中提取内容
-	// data 结构: { "0": { "type": "text", "content": "..." } }
-	if agentResp.Data != nil {
-		// 先尝试从 "0" key 获取内容对象
-		if contentObj, ok := agentResp.Data["0"].(map[string]interface{}); ok {
-			// 从内容对象中提取 content 字段
-			if content, ok := contentObj["content"].(string); ok && content != "" {
-				suggestionText = content
-			}
-		} else {
-			// 向后兼容：尝试直接从 data 中提取（旧格式）
-			if text, ok := agentResp.Data["text"].(string); ok && text != "" {
-				suggestionText = text
-			} else if response, ok := agentResp.Data["response"].(string); ok && response != "" {
-				suggestionText = response
-			} else if content, ok := agentResp.Data["content"].(string); ok && content != "" {
-				suggestionText = content
-			}
+	// 新请求会取消该会话中进行中的旧请求，客户端断开时也会取消
+	ctx, generation, done := c.beginAIRequest(chatID)
+	defer done()
+
+	// 客户消息中的敏感信息脱敏后发送给 Agent，建议中的占位符再还原给客服
+	text := contentText(msg.Content)
+	redactor := newPIIRedactor()
+
+	// 双语模式：客户使用其他语言时先翻译为客服语言，建议以客服语言生成后再回译为客户语言
+	customerLang, translatedText, languageOK := c.translateCustomerMessage(ctx, chatID, msg, text, redactor)
+	contents := []AgentCallContent{
+		{Type: "text", Content: msg.Content},
+	}
+	if translatedText != "" {
+		contents = []AgentCallContent{
+			{Type: "text", Content: translatedText},
+			{Type: "original_text", Content: map[string]string{"language": customerLang, "text": text}},
 		}
+		text = translatedText
 	}
 
-	// 如果没有获取到有效文本，记录警告并返回
-	if suggestionText == "" {
-		logger.Warn("Agent API 未返回有效建议文本",
-			zap.String("agent_id", c.AgentID),
-			zap.String("chat_id", c.ChatID),
-			zap.Any("agent_data", agentResp.Data))
+	// 意图分类，为会话打标签并选择处理请求的 Agent
+	intent := c.classifyIntent(ctx, chatID, text, redactor)
+	if ctx.Err() != nil {
+		logger.Info("AI协助请求已被取消", zap.String("agent_id", c.AgentID), zap.String("chat_id", chatID))
 		return
 	}
+	var agent *AgentInfo
+	if def, ok := findIntentDefinition(intent.Intent); ok {
+		agent = def.Agent
+	}
 
-	// 生成 suggestion_id
+	// 预先生成 suggestion_id，Agent 调用审计日志据此关联到建议
 	suggestionID := fmt.Sprintf("sug_%d", time.Now().UnixNano())
 
-	// 构造 AI 协助响应
-	assistanceResponse := map[string]interface{}{
-		"type":          "ai_suggestion",
-		"agent_id":      c.AgentID,
-		"chat_id":       c.ChatID,
-		"msg_id":        "",
-		"suggestion_id": suggestionID,
-		"text":          suggestionText,
-		"confidence":    confidence,
+	// 相同或相似的问题命中客服采用过的建议时，不再调用 Agent
+	var (
+		suggestionText string
+		knowledgeIDs   []uint
+		cacheEntryID   uint
+		cacheUses      int
+	)
+	experimentName, variantName := "", ""
+	confidence := defaultSuggestionConfidence
+	cacheSimilarity := 0.0
+	if match, ok := suggestionCache.Lookup(currentCorpID(), intent.Intent, text); ok {
+		suggestionText = match.Entry.Answer
+		cacheEntryID = match.Entry.ID
+		cacheUses = match.Entry.UseCount
+		// 问题相似度单独记录，置信度沿用缓存来源建议的模型置信度
+		cacheSimilarity = match.Similarity
+		confidence = match.Confidence
+		logger.Info("命中建议缓存",
+			zap.String("agent_id", c.AgentID),
+			zap.String("chat_id", chatID),
+			zap.Uint("cache_entry_id", cacheEntryID),
+			zap.Float64("similarity", match.Similarity))
+	} else {
+		call := agentCallRequest{
+			ChatID:       chatID,
+			EventType:    "user_input",
+			Contents:     contents,
+			Redactor:     redactor,
+			Agent:        agent,
+			SuggestionID: suggestionID,
+		}
+		assignment.apply(&call)
+		if assignment != nil {
+			experimentName, variantName = assignment.Experiment, assignment.Variant.Name
+		}
+
+		var ok bool
+		suggestionText, knowledgeIDs, confidence, ok = c.generateSuggestion(ctx, call, msg.MsgID, text)
+		if !ok {
+			return
+		}
 	}
 
-	// 发送 AI 协助响应
-	if err := c.SendMessage(assistanceResponse); err != nil {
-		logger.Error("发送AI协助响应失败", zap.String("agent_id", c.AgentID), zap.Error(err))
+	// 合规检查：拦截、改写或标记命中规则的建议
+	compliance := complianceEngine.Check(suggestionText)
+	violations, err := json.Marshal(compliance.Violations)
+	if err != nil {
+		logger.Error("序列化合规检查结果失败", zap.String("agent_id", c.AgentID), zap.Error(err))
+	}
+	if compliance.Status == complianceStatusBlocked {
+		logger.Warn("AI建议未通过合规检查，已拦截",
+			zap.String("agent_id", c.AgentID),
+			zap.String("chat_id", chatID),
+			zap.String("suggestion_id", suggestionID),
+			zap.Any("violations", compliance.Violations))
+
+		if ctx.Err() == nil {
+			if err := c.SendMessage(map[string]interface{}{
+				"type":                "ai_suggestion_blocked",
+				"agent_id":            c.AgentID,
+				"chat_id":             chatID,
+				"suggestion_id":       suggestionID,
+				"compliance_warnings": compliance.Violations,
+			}); err != nil {
+				logger.Error("发送 ai_suggestion_blocked 消息失败", zap.String("agent_id", c.AgentID), zap.Error(err))
+			}
+		}
+
+		// 被拦截的建议同样入库，便于审计
+		if err := createSuggestion(Suggestion{
+			SuggestionID:         suggestionID,
+			AgentID:              c.AgentID,
+			ChatID:               chatID,
+			OriginalContent:      suggestionText,
+			Confidence:           confidence,
+			KnowledgeIDs:         joinKnowledgeIDs(knowledgeIDs),
+			ComplianceStatus:     compliance.Status,
+			ComplianceViolations: string(violations),
+			Intent:               intent.Intent,
+			Experiment:           experimentName,
+			Variant:              variantName,
+			Question:             text,
+			CacheEntryID:         cacheEntryID,
+		}); err != nil {
+			logger.Error("插入被拦截的 suggestion 记录失败",
+				zap.String("agent_id", c.AgentID),
+				zap.String("suggestion_id", suggestionID),
+				zap.Error(err))
+		}
 		return
 	}
+	suggestionText = compliance.Text
+
+	// 回译为客户语言，客服发送回译后的文本
+	backTranslated := ""
+	if customerLang != "" {
+		backTranslated, err = c.translate(ctx, chatID, suggestionText, c.agentLanguage(), customerLang, redactor)
+		if err != nil {
+			logger.Warn("回译AI建议失败，只展示客服语言的建议",
+				zap.String("agent_id", c.AgentID),
+				zap.String("chat_id", chatID),
+				zap.String("language", customerLang),
+				zap.Error(err))
+		}
+	}
 
-	logger.Info("已发送AI协助响应给客服", zap.String("agent_id", c.AgentID))
+	// 自动回复：满足条件时由服务端直接发送给客户
+	// 双语模式下发送回译文本，回译文本同样需通过合规检查；无法识别客户语言、翻译或回译失败时不自动回复
+	replyText := suggestionText
+	replyCompliance := compliance.Status
+	switch {
+	case !languageOK:
+		replyText = ""
+	case customerLang != "":
+		replyText = backTranslated
+		if replyText != "" {
+			replyCompliance = complianceEngine.Check(replyText).Status
+		}
+	}
+	action := ""
+	if c.tryAutoReply(ctx, chatID, suggestionID, replyText, autoReplyCandidate{
+		OpenKfID:         msg.OpenKfID,
+		Intent:           intent.Intent,
+		Confidence:       confidence,
+		ComplianceStatus: replyCompliance,
+		CacheUses:        cacheUses,
+		CacheSimilarity:  cacheSimilarity,
+	}) {
+		action = feedbackActionAuto
+	} else {
+		// 构造 AI 协助响应
+		assistanceResponse := map[string]interface{}{
+			"type":                "ai_suggestion",
+			"agent_id":            c.AgentID,
+			"chat_id":             chatID,
+			"msg_id":              "",
+			"suggestion_id":       suggestionID,
+			"text":                suggestionText,
+			"confidence":          confidence,
+			"knowledge_ids":       knowledgeIDs,
+			"compliance_status":   compliance.Status,
+			"compliance_warnings": compliance.Violations,
+			"intent":              intent.Intent,
+			"intent_label":        intentLabel(intent.Intent),
+			"customer_language":   customerLang,
+			"translated_text":     backTranslated,
+			"cache_hit":           cacheEntryID != 0,
+			"cache_similarity":    cacheSimilarity,
+		}
+
+		// 发送 AI 协助响应，请求已被更新的消息取代时丢弃迟到的结果
+		published, err := c.publishSuggestion(ctx, chatID, generation, suggestionID, assistanceResponse)
+		if err != nil {
+			logger.Error("发送AI协助响应失败", zap.String("agent_id", c.AgentID), zap.Error(err))
+			return
+		}
+		if !published {
+			logger.Info("AI建议已过期，丢弃迟到的结果",
+				zap.String("agent_id", c.AgentID),
+				zap.String("chat_id", chatID),
+				zap.String("suggestion_id", suggestionID))
+			return
+		}
+
+		logger.Info("已发送AI协助响应给客服", zap.String("agent_id", c.AgentID))
+	}
 
 	// 插入 suggestion 记录到数据库
 	msgID := ""
-	if err := createSuggestion(suggestionID, c.AgentID, c.ChatID, msgID, suggestionText, confidence); err != nil {
+	if err := createSuggestion(Suggestion{
+		SuggestionID:         suggestionID,
+		AgentID:              c.AgentID,
+		ChatID:               chatID,
+		MsgID:                msgID, // 初始为空，后续关联时更新
+		Action:               action,
+		OriginalContent:      suggestionText,
+		Confidence:           confidence,
+		KnowledgeIDs:         joinKnowledgeIDs(knowledgeIDs),
+		ComplianceStatus:     compliance.Status,
+		ComplianceViolations: string(violations),
+		Intent:               intent.Intent,
+		Language:             customerLang,
+		TranslatedContent:    backTranslated,
+		Experiment:           experimentName,
+		Variant:              variantName,
+		Question:             text,
+		CacheEntryID:         cacheEntryID,
+	}); err != nil {
 		logger.Error("插入 suggestion 记录失败",
 			zap.String("agent_id", c.AgentID),
-			zap.String("chat_id", c.ChatID),
+			zap.String("chat_id", chatID),
 			zap.String("suggestion_id", suggestionID),
 			zap.Error(err))
 	} else {
 		logger.Info("成功插入 suggestion 记录",
 			zap.String("agent_id", c.AgentID),
-			zap.String("chat_id", c.ChatID),
+			zap.String("chat_id", chatID),
 			zap.String("suggestion_id", suggestionID),
 			zap.String("msg_id", msgID),
 			zap.Float64("confidence", confidence))
 	}
 }
 
+// generateSuggestion 调用 Agent 生成建议，失败、被限流或请求被取消时返回 false
+// msgID 为触发请求的消息ID，text 为客服语言的客户消息，用于检索知识库
+func (c *WeComClient) generateSuggestion(ctx context.Context, call agentCallRequest, msgID, text string) (suggestionText string, knowledgeIDs []uint, confidence float64, ok bool) {
+	chatID := call.ChatID
+
+	// 检索知识库，将最相关的片段作为参考资料附带给 Agent
+	passages := searchKnowledgeForAgent(text)
+	if len(passages) > 0 {
+		call.Contents = append(call.Contents, AgentCallContent{Type: "reference", Content: passages})
+		logger.Debug("附带知识库参考资料",
+			zap.String("agent_id", c.AgentID),
+			zap.String("chat_id", chatID),
+			zap.Int("passages", len(passages)))
+	}
+
+	// 调用 Agent API 获取建议
+	agentResp, err := c.callAgentWithTools(ctx, call)
+	if errors.Is(err, ErrCircuitOpen) {
+		logger.Warn("Agent API 已熔断，暂停 AI 建议",
+			zap.String("agent_id", c.AgentID),
+			zap.String("chat_id", chatID))
+		c.notifyAIUnavailable(chatID, call.AgentURL)
+		return "", nil, 0, false
+	}
+	var throttle *ThrottleError
+	if errors.As(err, &throttle) {
+		c.notifyAIThrottled(chatID, msgID, throttle)
+		return "", nil, 0, false
+	}
+	if err != nil && ctx.Err() != nil {
+		logger.Info("AI协助请求已被取消",
+			zap.String("agent_id", c.AgentID),
+			zap.String("chat_id", chatID),
+			zap.Error(err))
+		return "", nil, 0, false
+	}
+	if err != nil {
+		logger.Error("调用 Agent API 失败",
+			zap.String("agent_id", c.AgentID),
+			zap.String("chat_id", chatID),
+			zap.Error(err))
+		return "", nil, 0, false
+	}
+
+	// 调用成功，该后端后续熔断时重新通知侧边栏
+	c.mu.Lock()
+	delete(c.aiUnavailable, resolveAgentURL(call.AgentURL))
+	c.mu.Unlock()
+
+	// 从 Agent 响应中提取建议文本
+	suggestionText = call.Redactor.Restore(agentResponseText(agentResp))
+
+	// 如果没有获取到有效文本，记录警告并返回
+	if suggestionText == "" {
+		logger.Warn("Agent API 未返回有效建议文本",
+			zap.String("agent_id", c.AgentID),
+			zap.String("chat_id", chatID),
+			zap.Any("agent_data", agentResp.Data))
+		return "", nil, 0, false
+	}
+
+	return suggestionText, usedKnowledgeIDs(agentResp, passages), agentResponseConfidence(agentResp), true
+}
+
+// agentAPIURL 获取 Agent API 地址
+func agentAPIURL() string {
+	if agentURL := os.Getenv("AGENT_API_URL"); agentURL != "" {
+		return agentURL
+	}
+	return "http://192.168.201.28:8080/customer_support/assist"
+}
+
+// resolveAgentURL 返回实际调用的后端地址，为空时使用默认后端
+func resolveAgentURL(agentURL string) string {
+	if agentURL == "" {
+		return agentAPIURL()
+	}
+	return agentURL
+}
+
+// defaultAgentInfo 默认处理客服协助请求的 Agent
+func defaultAgentInfo() AgentInfo {
+	return AgentInfo{
+		AgentID:          "customer-support-agent",
+		CustomID:         "customer-support-agent",
+		PublishedVersion: defaultPublishedVersion(),
+		URL:              "local",
+		Type:             "",
+		AgentProviderID:  0,
+		Description:      "",
+		Name:             "",
+	}
+}
+
+// notifyAIUnavailable 通知侧边栏 AI 建议已暂停，同一次熔断期间只通知一次
+// agentURL 为熔断的后端，为空时表示默认后端；各后端熔断状态独立，分别通知
+func (c *WeComClient) notifyAIUnavailable(chatID, agentURL string) {
+	agentURL = resolveAgentURL(agentURL)
+
+	c.mu.Lock()
+	alreadyNotified := c.aiUnavailable[agentURL]
+	if c.aiUnavailable == nil {
+		c.aiUnavailable = make(map[string]bool)
+	}
+	c.aiUnavailable[agentURL] = true
+	c.mu.Unlock()
+
+	if alreadyNotified {
+		return
+	}
+
+	retryAfter := getCircuitBreaker(agentURL).RetryAfter()
+	if err := c.SendMessage(map[string]interface{}{
+		"type":        "ai_unavailable",
+		"agent_id":    c.AgentID,
+		"chat_id":     chatID,
+		"reason":      "circuit_open",
+		"retry_after": float64(retryAfter) / float64(time.Second),
+	}); err != nil {
+		logger.Error("发送 ai_unavailable 消息失败", zap.String("agent_id", c.AgentID), zap.Error(err))
+	}
+}
+
 // callAgentAPI 调用 Agent API
-func (c *WeComClient) callAgentAPI(content interface{}) (*AgentResponse, error) {
-	// Agent API 地址
-	agentURL := "http://192.168.201.28:8080/customer_support/assist"
+// 同一 (客服, 会话) 在有效期内复用下游 Agent 的会话，使 Agent 能够保留对话记忆
+func (c *WeComClient) callAgentAPI(ctx context.Context, call agentCallRequest) (_ *AgentResponse, err error) {
+	chatID := call.ChatID
+
+	// Agent API 地址，实验变体可指定其他后端
+	agentURL := resolveAgentURL(call.AgentURL)
+
+	// 后端熔断时直接返回，不再堆积请求；先于限流检查，熔断期间不消耗速率和每日配额
+	breaker := getCircuitBreaker(agentURL)
+	if !breaker.Allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	// 限流：每次实际调用 Agent（包括意图分类、翻译、摘要和工具调用轮次）都计入速率和每日配额，
+	// 命中建议缓存的请求不调用 Agent，不消耗配额；被限流时释放熔断器放行的探测名额
+	if throttle := throttleAIRequest(c.AgentID, chatID, agentURL); throttle != nil {
+		breaker.Release()
+		return nil, throttle
+	}
+
+	// 查找已有的 Agent 会话，没有则生成新的调用者实例ID；辅助调用不进入会话记忆
+	callerInstanceID := time.Now().UnixNano() / 1000 // 微秒级时间戳
+	sessionID := 0
+	if !call.Stateless {
+		if session, ok := agentSessions.Get(c.AgentID, chatID); ok {
+			callerInstanceID = session.CallerInstanceID
+			sessionID = session.SessionID
+			logger.Debug("复用 Agent 会话",
+				zap.String("agent_id", c.AgentID),
+				zap.String("chat_id", chatID),
+				zap.Int("session_id", sessionID))
+		}
+	}
+
+	// 发送给 Agent 的内容和请求日志都只包含脱敏后的文本
+	contents, err := call.Redactor.RedactContents(call.Contents)
+	if err != nil {
+		breaker.Release()
+		return nil, fmt.Errorf("敏感信息脱敏失败: %w", err)
+	}
+
+	// 按意图路由的 Agent，未指定时使用默认 Agent
+	agent := defaultAgentInfo()
+	if call.Agent != nil {
+		agent = *call.Agent
+	}
 
 	// 构造请求体
 	requestBody := AgentCallEvent{
-		Type: "user_input",
-		Contents: []AgentCallContent{
-			{
-				Type:    "text",
-				Content: content,
-			},
-		},
-		Agents: []AgentInfo{
-			{
-				AgentID:          "customer-support-agent",
-				CustomID:         "customer-support-agent",
-				PublishedVersion: "1.0.0",
-				URL:              "local",
-				Type:             "",
-				AgentProviderID:  0,
-				Description:      "",
-				Name:             "",
-			},
-		},
-		Tools:            []interface{}{},
-		CallerInstanceID: time.Now().UnixNano() / 1000, // 微秒级时间戳
+		Type:             call.EventType,
+		Contents:         contents,
+		Agents:           []AgentInfo{agent},
+		Tools:            call.Tools,
+		CallerInstanceID: callerInstanceID,
 		CallerType:       "user",
-		UserID:           c.ChatID,
+		UserID:           chatID,
+		SessionID:        sessionID,
 		Timestamp:        time.Now().Unix(),
 	}
 
 	// 序列化请求体
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
+		breaker.Release()
 		return nil, fmt.Errorf("序列化请求体失败: %w", err)
 	}
 
@@ -231,46 +705,61 @@ func (c *WeComClient) callAgentAPI(content interface{}) (*AgentResponse, error)
 		zap.String("url", agentURL),
 		zap.String("request", string(jsonData)))
 
-	// 创建 HTTP 请求
-	req, err := http.NewRequest("POST", agentURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("创建请求失败: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	// 发送请求
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("发送请求失败: %w", err)
+	// 整个调用（含重试）的超时预算
+	budgetCtx, cancel := context.WithTimeout(ctx, getEnvDuration("AGENT_API_TIMEOUT", 30*time.Second))
+	defer cancel()
+
+	start := time.Now()
+	respBody, retries, err := postAgentRequest(budgetCtx, agentURL, jsonData)
+
+	// 每次调用（含失败）都记录审计日志
+	audit := &AICall{
+		SuggestionID: call.SuggestionID,
+		AgentID:      c.AgentID,
+		ChatID:       chatID,
+		EventType:    call.EventType,
+		Backend:      agentURL,
+		Request:      string(jsonData),
+		Response:     string(respBody),
+		HTTPStatus:   agentCallHTTPStatus(err),
+		LatencyMs:    time.Since(start).Milliseconds(),
+		Retries:      retries,
 	}
-	defer resp.Body.Close()
+	defer func() {
+		if err != nil {
+			audit.Error = err.Error()
+		}
+		recordAICall(audit)
+	}()
 
-	// 读取响应
-	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("读取响应失败: %w", err)
+		// 调用方主动取消（请求被取代或客户端断开）不代表后端不可用
+		if ctx.Err() != nil {
+			breaker.Release()
+			return nil, err
+		}
+		// 只有后端不可用（5xx、连接错误、超时）才计入熔断，4xx 说明后端仍然可达
+		var reqErr *agentRequestError
+		if errors.As(err, &reqErr) && !reqErr.Retryable {
+			breaker.RecordSuccess()
+		} else {
+			breaker.RecordFailure()
+		}
+		return nil, err
 	}
+	breaker.RecordSuccess()
 
 	logger.Debug("收到 Agent API 响应",
 		zap.String("agent_id", c.AgentID),
-		zap.Int("status_code", resp.StatusCode),
+		zap.Int("retries", retries),
 		zap.String("response", string(respBody)))
 
-	// 检查 HTTP 状态码
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Agent API 返回错误状态码: %d, 响应: %s", resp.StatusCode, string(respBody))
-	}
-
 	// 解析响应
 	var agentResp AgentResponse
 	if err := json.Unmarshal(respBody, &agentResp); err != nil {
 		return nil, fmt.Errorf("解析响应失败: %w", err)
 	}
+	audit.Code = agentResp.Code
 
 	// 检查业务状态码
 	if agentResp.Code != 200 {
@@ -279,7 +768,138 @@ func (c *WeComClient) callAgentAPI(content interface{}) (*AgentResponse, error)
 
 	logger.Info("成功调用 Agent API",
 		zap.String("agent_id", c.AgentID),
+		zap.String("chat_id", chatID),
 		zap.Int("session_id", agentResp.SessionID))
 
+	// 保存 Agent 会话，下次调用时带回
+	if agentResp.SessionID != 0 && !call.Stateless {
+		if err := agentSessions.Save(c.AgentID, chatID, agentResp.SessionID, callerInstanceID); err != nil {
+			logger.Warn("保存 Agent 会话失败",
+				zap.String("agent_id", c.AgentID),
+				zap.String("chat_id", chatID),
+				zap.Int("session_id", agentResp.SessionID),
+				zap.Error(err))
+		}
+	}
+
 	return &agentResp, nil
 }
+
+// agentRequestError Agent API 请求错误
+type agentRequestError struct {
+	StatusCode int  // HTTP 状态码，连接错误时为 0
+	Retryable  bool // 是否可重试（5xx、429、连接错误、超时）
+	Err        error
+}
+
+func (e *agentRequestError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *agentRequestError) Unwrap() error {
+	return e.Err
+}
+
+// postAgentRequest 发送 Agent API 请求，对可重试的失败进行有限次数的抖动退避重试
+// 返回响应体和实际重试次数，失败时响应体为最后一次请求的错误响应；ctx 的截止时间作为整个调用的超时预算
+func postAgentRequest(ctx context.Context, agentURL string, jsonData []byte) ([]byte, int, error) {
+	maxRetries := getEnvInt("AGENT_API_MAX_RETRIES", 2)
+	if maxRetries < 0 {
+		maxRetries = 0
+	}
+	attemptTimeout := getEnvDuration("AGENT_API_ATTEMPT_TIMEOUT", 10*time.Second)
+	baseBackoff := getEnvDuration("AGENT_API_RETRY_BACKOFF", 200*time.Millisecond)
+
+	var lastErr error
+	var lastBody []byte
+	retries := 0
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			delay := retryBackoff(baseBackoff, attempt)
+
+			// 剩余预算不足以等待下一次重试时直接放弃
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+				break
+			}
+
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return lastBody, retries, fmt.Errorf("等待重试时取消: %w (最后一次错误: %v)", ctx.Err(), lastErr)
+			case <-timer.C:
+			}
+
+			retries++
+			logger.Warn("重试调用 Agent API",
+				zap.String("url", agentURL),
+				zap.Int("attempt", attempt),
+				zap.Duration("backoff", delay),
+				zap.Error(lastErr))
+		}
+
+		body, err := doAgentRequest(ctx, agentURL, jsonData, attemptTimeout)
+		if err == nil {
+			return body, retries, nil
+		}
+		lastErr = err
+		lastBody = body
+
+		if !err.Retryable || ctx.Err() != nil {
+			break
+		}
+	}
+
+	return lastBody, retries, lastErr
+}
+
+// doAgentRequest 发送单次 Agent API 请求，非 200 状态码时同时返回响应体和错误
+func doAgentRequest(ctx context.Context, agentURL string, jsonData []byte, timeout time.Duration) ([]byte, *agentRequestError) {
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// 创建 HTTP 请求
+	req, err := http.NewRequestWithContext(attemptCtx, "POST", agentURL, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, &agentRequestError{Err: fmt.Errorf("创建请求失败: %w", err)}
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	// 发送请求（超时由 context 控制）
+	resp, err := agentHTTPClient.Do(req)
+	if err != nil {
+		return nil, &agentRequestError{Retryable: true, Err: fmt.Errorf("发送请求失败: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	// 读取响应
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &agentRequestError{StatusCode: resp.StatusCode, Retryable: true, Err: fmt.Errorf("读取响应失败: %w", err)}
+	}
+
+	// 检查 HTTP 状态码，错误响应体同样返回，记录到审计日志
+	if resp.StatusCode != http.StatusOK {
+		return respBody, &agentRequestError{
+			StatusCode: resp.StatusCode,
+			Retryable:  resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests,
+			Err:        fmt.Errorf("Agent API 返回错误状态码: %d, 响应: %s", resp.StatusCode, string(respBody)),
+		}
+	}
+
+	return respBody, nil
+}
+
+// agentHTTPClient 调用 Agent API 的 HTTP 客户端，超时由每次请求的 context 控制
+var agentHTTPClient = &http.Client{}
+
+// retryBackoff 计算第 attempt 次重试的等待时间（指数退避 + 全抖动，上限 5 秒）
+func retryBackoff(base time.Duration, attempt int) time.Duration {
+	maxBackoff := 5 * time.Second
+	backoff := base << uint(attempt-1)
+	if backoff <= 0 || backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return time.Duration(mathrand.Int63n(int64(backoff)) + 1)
+}
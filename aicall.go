@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// AICall ai_calls 表模型，Agent API 调用审计日志
+// 请求体为脱敏后实际发送的内容，响应为 Agent 返回的原始内容
+type AICall struct {
+	ID           uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	SuggestionID string    `gorm:"type:varchar(255);index" json:"suggestion_id"` // 辅助调用（意图分类、翻译等）为空
+	AgentID      string    `gorm:"type:varchar(255);index;not null" json:"agent_id"`
+	ChatID       string    `gorm:"type:varchar(255);index" json:"chat_id"`
+	EventType    string    `gorm:"type:varchar(50);index" json:"event_type"`
+	Backend      string    `gorm:"type:varchar(500)" json:"backend"`
+	Request      string    `gorm:"type:text" json:"request"`
+	Response     string    `gorm:"type:text" json:"response"`
+	HTTPStatus   int       `json:"http_status"` // 连接错误、超时为 0
+	Code         int       `json:"code"`        // AgentResponse.Code
+	LatencyMs    int64     `json:"latency_ms"`  // 含重试的总耗时
+	Retries      int       `json:"retries"`
+	Error        string    `gorm:"type:text" json:"error"`
+	CreatedAt    time.Time `gorm:"index" json:"created_at"`
+}
+
+// TableName 指定表名
+func (AICall) TableName() string {
+	return "ai_calls"
+}
+
+// agentCallHTTPStatus 根据请求结果推断 HTTP 状态码
+func agentCallHTTPStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	var reqErr *agentRequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.StatusCode
+	}
+	return 0
+}
+
+// recordAICall 记录 Agent API 调用审计日志，失败只记录警告，不影响调用结果
+func recordAICall(call *AICall) {
+	if db == nil {
+		return
+	}
+	if err := db.Create(call).Error; err != nil {
+		logger.Warn("记录 Agent 调用审计日志失败",
+			zap.String("agent_id", call.AgentID),
+			zap.String("chat_id", call.ChatID),
+			zap.Error(err))
+	}
+}
+
+// aiCallsQuery 根据查询参数构造 ai_calls 查询
+// 支持 agent_id、chat_id、suggestion_id、event_type 以及 RFC3339 格式的 since、until
+func aiCallsQuery(r *http.Request) (*gorm.DB, error) {
+	query := db.Model(&AICall{})
+	params := r.URL.Query()
+	if agentID := params.Get("agent_id"); agentID != "" {
+		query = query.Where("agent_id = ?", agentID)
+	}
+	if chatID := params.Get("chat_id"); chatID != "" {
+		query = query.Where("chat_id = ?", chatID)
+	}
+	if suggestionID := params.Get("suggestion_id"); suggestionID != "" {
+		query = query.Where("suggestion_id = ?", suggestionID)
+	}
+	if eventType := params.Get("event_type"); eventType != "" {
+		query = query.Where("event_type = ?", eventType)
+	}
+	if since := params.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 since: %s", since)
+		}
+		query = query.Where("created_at >= ?", t)
+	}
+	if until := params.Get("until"); until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 until: %s", until)
+		}
+		query = query.Where("created_at < ?", t)
+	}
+	return query, nil
+}
+
+// AICallsHandler 查询 Agent 调用审计日志
+// GET /api/ai-calls?agent_id=...&chat_id=...&suggestion_id=...&since=...&until=...&limit=100
+func AICallsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if db == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "数据库未初始化")
+		return
+	}
+
+	query, err := aiCallsQuery(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	limit := 100
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 1000 {
+		limit = l
+	}
+
+	var calls []AICall
+	if err := query.Order("id DESC").Limit(limit).Find(&calls).Error; err != nil {
+		logger.Error("查询 Agent 调用记录失败", zap.Error(err))
+		writeJSONError(w, http.StatusInternalServerError, "查询 Agent 调用记录失败")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"calls": calls,
+	})
+}
+
+// AICallStatsHandler Agent 调用 SLA 统计：调用量、错误率和耗时分位数
+// GET /api/ai-calls/stats?agent_id=...&chat_id=...&event_type=...&since=...&until=...
+// 未指定 since 时统计最近 STATS_DEFAULT_WINDOW 内的调用
+func AICallStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if db == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "数据库未初始化")
+		return
+	}
+
+	query, err := aiCallsQuery(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	query, since := withDefaultSince(query, r)
+	query = query.Session(&gorm.Session{})
+
+	var agg struct {
+		Total        int64
+		Errors       int64
+		Retried      int64
+		AvgLatencyMs float64
+	}
+	if err := query.Select(`COUNT(*) AS total,
+		COALESCE(SUM(CASE WHEN error <> '' THEN 1 ELSE 0 END), 0) AS errors,
+		COALESCE(SUM(CASE WHEN retries > 0 THEN 1 ELSE 0 END), 0) AS retried,
+		COALESCE(AVG(latency_ms), 0) AS avg_latency_ms`).Scan(&agg).Error; err != nil {
+		logger.Error("统计 Agent 调用记录失败", zap.Error(err))
+		writeJSONError(w, http.StatusInternalServerError, "统计 Agent 调用记录失败")
+		return
+	}
+
+	stats := map[string]interface{}{
+		"since":          since,
+		"total":          agg.Total,
+		"errors":         agg.Errors,
+		"retried":        agg.Retried,
+		"error_rate":     0.0,
+		"avg_latency_ms": agg.AvgLatencyMs,
+	}
+	if agg.Total > 0 {
+		stats["error_rate"] = float64(agg.Errors) / float64(agg.Total)
+	}
+	for _, p := range []struct {
+		name string
+		p    float64
+	}{{"p50_latency_ms", 0.50}, {"p95_latency_ms", 0.95}, {"p99_latency_ms", 0.99}} {
+		latency, err := latencyPercentile(query, agg.Total, p.p)
+		if err != nil {
+			logger.Error("统计 Agent 调用耗时分位数失败", zap.Error(err))
+			writeJSONError(w, http.StatusInternalServerError, "统计 Agent 调用记录失败")
+			return
+		}
+		stats[p.name] = latency
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// latencyPercentile 在数据库中按耗时排序取分位数（最近秩法），total 为匹配的调用数
+func latencyPercentile(query *gorm.DB, total int64, p float64) (int64, error) {
+	if total == 0 {
+		return 0, nil
+	}
+	rank := int64(p*float64(total) + 0.5)
+	rank = max(rank, 1)
+	rank = min(rank, total)
+
+	var latencies []int64
+	if err := query.Order("latency_ms").Offset(int(rank-1)).Limit(1).Pluck("latency_ms", &latencies).Error; err != nil {
+		return 0, err
+	}
+	if len(latencies) == 0 {
+		return 0, nil
+	}
+	return latencies[0], nil
+}
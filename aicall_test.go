@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAgentCallHTTPStatus(t *testing.T) {
+	if got := agentCallHTTPStatus(nil); got != http.StatusOK {
+		t.Errorf("成功调用 = %d, want 200", got)
+	}
+	reqErr := &agentRequestError{StatusCode: http.StatusBadGateway, Err: errors.New("bad gateway")}
+	if got := agentCallHTTPStatus(fmt.Errorf("调用失败: %w", reqErr)); got != http.StatusBadGateway {
+		t.Errorf("HTTP 错误 = %d, want 502", got)
+	}
+	if got := agentCallHTTPStatus(errors.New("timeout")); got != 0 {
+		t.Errorf("连接错误 = %d, want 0", got)
+	}
+}
+
+func TestAICallsQueryAndStats(t *testing.T) {
+	newTestSQLiteStore(t)
+
+	now := time.Now()
+	for i := 1; i <= 10; i++ {
+		call := &AICall{AgentID: "a1", ChatID: "c1", EventType: "assist", LatencyMs: int64(i * 100), CreatedAt: now}
+		if i == 10 {
+			call.Error = "timeout"
+			call.Retries = 2
+		}
+		recordAICall(call)
+	}
+	recordAICall(&AICall{AgentID: "a2", ChatID: "c2", LatencyMs: 5000, CreatedAt: now})
+	// 超出默认统计窗口的调用
+	recordAICall(&AICall{AgentID: "a1", ChatID: "c1", LatencyMs: 9000, CreatedAt: now.Add(-30 * 24 * time.Hour)})
+
+	rec := httptest.NewRecorder()
+	AICallsHandler(rec, httptest.NewRequest("GET", "/api/ai-calls?agent_id=a1&limit=5", nil))
+	var list struct {
+		Calls []AICall `json:"calls"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("AICallsHandler: %d %s", rec.Code, rec.Body.String())
+	}
+	if len(list.Calls) != 5 || list.Calls[0].AgentID != "a1" {
+		t.Errorf("calls = %+v, 期望按 agent_id 过滤并限制 5 条", list.Calls)
+	}
+
+	rec = httptest.NewRecorder()
+	AICallStatsHandler(rec, httptest.NewRequest("GET", "/api/ai-calls/stats?agent_id=a1", nil))
+	var stats struct {
+		Total        int64   `json:"total"`
+		Errors       int64   `json:"errors"`
+		Retried      int64   `json:"retried"`
+		ErrorRate    float64 `json:"error_rate"`
+		P50LatencyMs int64   `json:"p50_latency_ms"`
+		P95LatencyMs int64   `json:"p95_latency_ms"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("AICallStatsHandler: %d %s", rec.Code, rec.Body.String())
+	}
+	if stats.Total != 10 || stats.Errors != 1 || stats.Retried != 1 || stats.ErrorRate != 0.1 {
+		t.Errorf("stats = %+v, 期望只统计默认窗口内 a1 的 10 次调用", stats)
+	}
+	if stats.P50LatencyMs != 500 || stats.P95LatencyMs != 1000 {
+		t.Errorf("p50 = %d, p95 = %d, want 500, 1000", stats.P50LatencyMs, stats.P95LatencyMs)
+	}
+
+	rec = httptest.NewRecorder()
+	AICallsHandler(rec, httptest.NewRequest("GET", "/api/ai-calls?since=yesterday", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("无效的 since 应返回 400，实际 %d", rec.Code)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ReplyAnalysis reply_analyses 表模型，记录客服回复后的 AI 分析结果
+type ReplyAnalysis struct {
+	ID            uint    `gorm:"primaryKey;autoIncrement"`
+	AgentID       string  `gorm:"type:varchar(255);index;not null"`
+	ChatID        string  `gorm:"type:varchar(255);index"`
+	MsgID         string  `gorm:"type:varchar(255);index"` // 客服回复的消息ID
+	ReplyContent  string  `gorm:"type:text"`               // 客服回复内容
+	NextStepHints string  `gorm:"type:text"`               // 下一步提示（JSON 数组）
+	MissingInfo   string  `gorm:"type:text"`               // 缺失信息检查（JSON 数组）
+	QualityScore  float64 `gorm:"type:decimal(5,2);default:0"`
+	CreatedAt     time.Time
+}
+
+// TableName 指定表名
+func (ReplyAnalysis) TableName() string {
+	return "reply_analyses"
+}
+
+// ReplyAnalysisResult 回复分析结果
+type ReplyAnalysisResult struct {
+	NextStepHints []string `json:"next_step_hints"` // 下一步提示，如“客户可能会询问退款时效”
+	MissingInfo   []string `json:"missing_info"`    // 回复中缺失的信息
+	QualityScore  float64  `json:"quality_score"`   // 回复质量评分
+}
+
+// parseReplyAnalysis 从 Agent 响应中解析回复分析结果
+// 支持 data 直接包含分析字段，或 data["0"].content 为分析结果的 JSON 文本；
+// 无法解析为结构化结果时，将文本整体作为一条下一步提示
+func parseReplyAnalysis(agentResp *AgentResponse) ReplyAnalysisResult {
+	result := ReplyAnalysisResult{
+		NextStepHints: []string{},
+		MissingInfo:   []string{},
+	}
+	if agentResp == nil || agentResp.Data == nil {
+		return result
+	}
+
+	// data 直接包含分析字段
+	if _, ok := agentResp.Data["next_step_hints"]; ok {
+		if raw, err := json.Marshal(agentResp.Data); err == nil {
+			json.Unmarshal(raw, &result)
+		}
+	} else if text := agentResponseText(agentResp); text != "" {
+		if err := json.Unmarshal([]byte(text), &result); err != nil {
+			result.NextStepHints = []string{text}
+		}
+	}
+
+	if result.NextStepHints == nil {
+		result.NextStepHints = []string{}
+	}
+	if result.MissingInfo == nil {
+		result.MissingInfo = []string{}
+	}
+	return result
+}
+
+// createReplyAnalysis 保存回复分析结果
+func createReplyAnalysis(agentID, chatID, msgID, reply string, result ReplyAnalysisResult) error {
+	if db == nil {
+		return fmt.Errorf("数据库未初始化")
+	}
+
+	hints, err := json.Marshal(result.NextStepHints)
+	if err != nil {
+		return fmt.Errorf("序列化下一步提示失败: %w", err)
+	}
+	missingInfo, err := json.Marshal(result.MissingInfo)
+	if err != nil {
+		return fmt.Errorf("序列化缺失信息失败: %w", err)
+	}
+
+	analysis := ReplyAnalysis{
+		AgentID:       agentID,
+		ChatID:        chatID,
+		MsgID:         msgID,
+		ReplyContent:  reply,
+		NextStepHints: string(hints),
+		MissingInfo:   string(missingInfo),
+		QualityScore:  result.QualityScore,
+	}
+
+	if err := db.Create(&analysis).Error; err != nil {
+		return fmt.Errorf("创建回复分析记录失败: %w", err)
+	}
+
+	return nil
+}
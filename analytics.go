@@ -0,0 +1,398 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 统计的分组维度
+var analyticsGroupColumns = map[string]string{
+	"agent": "agent_id",
+	"chat":  "chat_id",
+	"corp":  "''", // 单企业部署，按企业汇总即全部建议
+}
+
+// 统计的时间粒度：PostgreSQL 为 date_trunc 的精度，SQLite 为截断到该粒度的 strftime 参数（周从周一开始）
+var analyticsBuckets = map[string]string{
+	"hour":  "'%Y-%m-%d %H:00:00', created_at",
+	"day":   "'%Y-%m-%d', created_at",
+	"week":  "'%Y-%m-%d', created_at, 'weekday 0', '-6 days'",
+	"month": "'%Y-%m-01', created_at",
+}
+
+// analyticsBucketExpr 将 created_at 截断到时间段起点的 SQL 表达式，结果为 Unix 秒
+// PostgreSQL 按数据库会话时区截断；SQLite 没有 date_trunc，用 strftime 按 UTC 截断
+func analyticsBucketExpr(bucket string) string {
+	if usingPostgres() {
+		return fmt.Sprintf("CAST(EXTRACT(EPOCH FROM date_trunc('%s', created_at)) AS BIGINT)", bucket)
+	}
+	return fmt.Sprintf("CAST(strftime('%%s', strftime(%s)) AS INTEGER)", analyticsBuckets[bucket])
+}
+
+// calibrationBinExpr 置信度所在区间序号的 SQL 表达式，超出 [0, bins) 的截断到两端
+// SQLite 默认不含 FLOOR，置信度非负时 CAST 截断与向下取整相同，负值截断后同样归入第一个区间
+func calibrationBinExpr() string {
+	if usingPostgres() {
+		return "LEAST(GREATEST(FLOOR(confidence * ?), 0), ?)"
+	}
+	return "MIN(MAX(CAST(confidence * ? AS INTEGER), 0), ?)"
+}
+
+// SuggestionMetrics 一个时间段内一个客服、会话或企业的建议统计
+type SuggestionMetrics struct {
+	Bucket        time.Time `json:"bucket"`
+	Key           string    `json:"key"`       // 客服ID、会话ID 或企业ID
+	Generated     int       `json:"generated"` // 生成的建议数
+	Used          int       `json:"used"`      // 直接使用
+	Edited        int       `json:"edited"`    // 编辑后使用
+	Rejected      int       `json:"rejected"`  // 拒绝
+	Auto          int       `json:"auto"`      // 自动回复
+	Ignored       int       `json:"ignored"`   // 没有反馈
+	UseRate       float64   `json:"use_rate"`  // 以生成数为分母
+	EditRate      float64   `json:"edit_rate"`
+	RejectRate    float64   `json:"reject_rate"`
+	IgnoreRate    float64   `json:"ignore_rate"`
+	Linked        int       `json:"linked"`         // 已关联到客服消息的建议数
+	AvgSimilarity float64   `json:"avg_similarity"` // 已关联建议的平均相似率（0-100）
+	AvgConfidence float64   `json:"avg_confidence"`
+}
+
+// analyticsQuery 根据查询参数构造 suggestions 查询
+// 支持 agent_id、chat_id、intent 以及 RFC3339 格式的 since、until
+func analyticsQuery(r *http.Request) (*gorm.DB, error) {
+	query := db.Model(&Suggestion{})
+	params := r.URL.Query()
+	if agentID := params.Get("agent_id"); agentID != "" {
+		query = query.Where("agent_id = ?", agentID)
+	}
+	if chatID := params.Get("chat_id"); chatID != "" {
+		query = query.Where("chat_id = ?", chatID)
+	}
+	if intent := params.Get("intent"); intent != "" {
+		query = query.Where("intent = ?", intent)
+	}
+	if since := params.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 since: %s", since)
+		}
+		query = query.Where("created_at >= ?", t)
+	}
+	if until := params.Get("until"); until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 until: %s", until)
+		}
+		query = query.Where("created_at < ?", t)
+	}
+	return query, nil
+}
+
+// ratio 计算比例，分母为 0 时返回 0
+func ratio(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+// buildSuggestionMetrics 按时间段和分组维度统计建议的生成、使用、编辑、拒绝和忽略情况
+func buildSuggestionMetrics(query *gorm.DB, bucket, groupBy string) ([]SuggestionMetrics, error) {
+	var rows []struct {
+		Bucket        int64
+		Key           string
+		Action        string
+		Count         int
+		Linked        int
+		SimilaritySum float64
+		ConfidenceSum float64
+	}
+	err := query.
+		Select(fmt.Sprintf(`%s AS bucket, %s AS key, COALESCE(action, '') AS action, COUNT(*) AS count,
+			SUM(CASE WHEN msg_id <> '' THEN 1 ELSE 0 END) AS linked,
+			COALESCE(SUM(CASE WHEN msg_id <> '' THEN similarity ELSE 0 END), 0) AS similarity_sum,
+			COALESCE(SUM(confidence), 0) AS confidence_sum`, analyticsBucketExpr(bucket), analyticsGroupColumns[groupBy])).
+		Group("1, 2, 3").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("统计建议失败: %w", err)
+	}
+
+	type groupKey struct {
+		bucket time.Time
+		key    string
+	}
+	type sums struct {
+		metrics       SuggestionMetrics
+		similaritySum float64
+		confidenceSum float64
+	}
+	groups := make(map[groupKey]*sums)
+	for _, row := range rows {
+		key := row.Key
+		if groupBy == "corp" {
+			key = currentCorpID()
+		}
+		bucketStart := time.Unix(row.Bucket, 0)
+		k := groupKey{bucket: bucketStart, key: key}
+		g, ok := groups[k]
+		if !ok {
+			g = &sums{metrics: SuggestionMetrics{Bucket: bucketStart, Key: key}}
+			groups[k] = g
+		}
+		m := &g.metrics
+		m.Generated += row.Count
+		m.Linked += row.Linked
+		g.similaritySum += row.SimilaritySum
+		g.confidenceSum += row.ConfidenceSum
+		switch normalizeFeedbackAction(row.Action) {
+		case feedbackActionUse:
+			m.Used += row.Count
+		case feedbackActionEdit:
+			m.Edited += row.Count
+		case feedbackActionReject:
+			m.Rejected += row.Count
+		case feedbackActionAuto:
+			m.Auto += row.Count
+		case "":
+			m.Ignored += row.Count
+		}
+	}
+
+	metrics := make([]SuggestionMetrics, 0, len(groups))
+	for _, g := range groups {
+		m := g.metrics
+		m.UseRate = ratio(m.Used, m.Generated)
+		m.EditRate = ratio(m.Edited, m.Generated)
+		m.RejectRate = ratio(m.Rejected, m.Generated)
+		m.IgnoreRate = ratio(m.Ignored, m.Generated)
+		if m.Linked > 0 {
+			m.AvgSimilarity = g.similaritySum / float64(m.Linked)
+		}
+		if m.Generated > 0 {
+			m.AvgConfidence = g.confidenceSum / float64(m.Generated)
+		}
+		metrics = append(metrics, m)
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		if !metrics[i].Bucket.Equal(metrics[j].Bucket) {
+			return metrics[i].Bucket.Before(metrics[j].Bucket)
+		}
+		return metrics[i].Key < metrics[j].Key
+	})
+	return metrics, nil
+}
+
+// CalibrationBin 一个置信度区间内建议的实际采用情况
+type CalibrationBin struct {
+	Min           float64 `json:"min"`
+	Max           float64 `json:"max"`
+	Count         int     `json:"count"`          // 有反馈的建议数
+	AvgConfidence float64 `json:"avg_confidence"` // 区间内的平均置信度
+	AdoptRate     float64 `json:"adopt_rate"`     // 直接使用（含自动回复）的比例
+	AcceptRate    float64 `json:"accept_rate"`    // 直接使用或编辑后使用的比例
+}
+
+// buildCalibration 按置信度分区间统计有反馈的建议的采用率，并计算期望校准误差（ECE）
+func buildCalibration(query *gorm.DB, bins int) ([]CalibrationBin, float64, error) {
+	var rows []struct {
+		Bin           int
+		Action        string
+		Count         int
+		ConfidenceSum float64
+	}
+	err := query.
+		Select(calibrationBinExpr()+" AS bin, action, COUNT(*) AS count, SUM(confidence) AS confidence_sum", bins, bins-1).
+		Where("action <> '' AND confidence IS NOT NULL").
+		Group("1, 2").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("统计置信度校准失败: %w", err)
+	}
+
+	result := make([]CalibrationBin, bins)
+	confidenceSums := make([]float64, bins)
+	adopted := make([]int, bins)
+	accepted := make([]int, bins)
+	for i := range result {
+		result[i].Min = float64(i) / float64(bins)
+		result[i].Max = float64(i+1) / float64(bins)
+	}
+	total := 0
+	for _, row := range rows {
+		if row.Bin < 0 || row.Bin >= bins {
+			continue
+		}
+		result[row.Bin].Count += row.Count
+		confidenceSums[row.Bin] += row.ConfidenceSum
+		total += row.Count
+		switch normalizeFeedbackAction(row.Action) {
+		case feedbackActionUse, feedbackActionAuto:
+			adopted[row.Bin] += row.Count
+			accepted[row.Bin] += row.Count
+		case feedbackActionEdit:
+			accepted[row.Bin] += row.Count
+		}
+	}
+
+	ece := 0.0
+	for i := range result {
+		bin := &result[i]
+		if bin.Count == 0 {
+			continue
+		}
+		bin.AvgConfidence = confidenceSums[i] / float64(bin.Count)
+		bin.AdoptRate = ratio(adopted[i], bin.Count)
+		bin.AcceptRate = ratio(accepted[i], bin.Count)
+		ece += float64(bin.Count) / float64(total) * math.Abs(bin.AvgConfidence-bin.AdoptRate)
+	}
+	return result, ece, nil
+}
+
+// writeCSV 以 CSV 附件输出
+func writeCSV(w http.ResponseWriter, filename string, header []string, records [][]string) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	// 写入 UTF-8 BOM，Excel 打开时中文不乱码
+	w.Write([]byte("\xef\xbb\xbf"))
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	cw.WriteAll(records)
+	if err := cw.Error(); err != nil {
+		logger.Warn("输出 CSV 失败", zap.String("filename", filename), zap.Error(err))
+	}
+}
+
+// formatFloat 格式化 CSV 中的小数
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 4, 64)
+}
+
+// SuggestionAnalyticsHandler 按时间段统计建议的生成、使用、编辑、拒绝、忽略、相似率和置信度
+// GET /api/analytics/suggestions?group_by=agent|chat|corp&bucket=hour|day|week|month&agent_id=...&chat_id=...&intent=...&since=...&until=...&format=csv
+// 未指定 since 时统计最近 STATS_DEFAULT_WINDOW 内的建议
+func SuggestionAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if db == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "数据库未初始化")
+		return
+	}
+
+	params := r.URL.Query()
+	groupBy := params.Get("group_by")
+	if groupBy == "" {
+		groupBy = "agent"
+	}
+	if _, ok := analyticsGroupColumns[groupBy]; !ok {
+		writeJSONError(w, http.StatusBadRequest, "group_by 只支持 agent、chat 或 corp")
+		return
+	}
+	bucket := params.Get("bucket")
+	if bucket == "" {
+		bucket = "day"
+	}
+	if _, ok := analyticsBuckets[bucket]; !ok {
+		writeJSONError(w, http.StatusBadRequest, "bucket 只支持 hour、day、week 或 month")
+		return
+	}
+
+	query, err := analyticsQuery(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	query, since := withDefaultSince(query, r)
+	metrics, err := buildSuggestionMetrics(query, bucket, groupBy)
+	if err != nil {
+		logger.Error("统计建议失败", zap.Error(err))
+		writeJSONError(w, http.StatusInternalServerError, "统计建议失败")
+		return
+	}
+
+	if params.Get("format") == "csv" {
+		records := make([][]string, 0, len(metrics))
+		for _, m := range metrics {
+			records = append(records, []string{
+				m.Bucket.Format(time.RFC3339), m.Key,
+				strconv.Itoa(m.Generated), strconv.Itoa(m.Used), strconv.Itoa(m.Edited),
+				strconv.Itoa(m.Rejected), strconv.Itoa(m.Auto), strconv.Itoa(m.Ignored),
+				formatFloat(m.UseRate), formatFloat(m.EditRate), formatFloat(m.RejectRate), formatFloat(m.IgnoreRate),
+				strconv.Itoa(m.Linked), formatFloat(m.AvgSimilarity), formatFloat(m.AvgConfidence),
+			})
+		}
+		writeCSV(w, fmt.Sprintf("suggestions_%s_%s.csv", groupBy, bucket), []string{
+			"bucket", groupBy, "generated", "used", "edited", "rejected", "auto", "ignored",
+			"use_rate", "edit_rate", "reject_rate", "ignore_rate", "linked", "avg_similarity", "avg_confidence",
+		}, records)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"since":    since,
+		"group_by": groupBy,
+		"bucket":   bucket,
+		"metrics":  metrics,
+	})
+}
+
+// SuggestionCalibrationHandler 置信度校准：各置信度区间内建议的实际采用率
+// GET /api/analytics/calibration?bins=10&agent_id=...&chat_id=...&intent=...&since=...&until=...&format=csv
+// 未指定 since 时统计最近 STATS_DEFAULT_WINDOW 内的建议
+func SuggestionCalibrationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if db == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "数据库未初始化")
+		return
+	}
+
+	bins := 10
+	if b, err := strconv.Atoi(r.URL.Query().Get("bins")); err == nil && b >= 2 && b <= 100 {
+		bins = b
+	}
+
+	query, err := analyticsQuery(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	query, since := withDefaultSince(query, r)
+	calibration, ece, err := buildCalibration(query, bins)
+	if err != nil {
+		logger.Error("统计置信度校准失败", zap.Error(err))
+		writeJSONError(w, http.StatusInternalServerError, "统计置信度校准失败")
+		return
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		records := make([][]string, 0, len(calibration))
+		for _, bin := range calibration {
+			records = append(records, []string{
+				formatFloat(bin.Min), formatFloat(bin.Max), strconv.Itoa(bin.Count),
+				formatFloat(bin.AvgConfidence), formatFloat(bin.AdoptRate), formatFloat(bin.AcceptRate),
+			})
+		}
+		writeCSV(w, "calibration.csv", []string{"min", "max", "count", "avg_confidence", "adopt_rate", "accept_rate"}, records)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"since": since,
+		"bins":  calibration,
+		"ece":   ece,
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSuggestionAnalyticsSQLite(t *testing.T) {
+	newTestSQLiteStore(t)
+
+	// 2026-10-14 为周三，同一周的周一为 2026-10-12
+	day := time.Date(2026, 10, 14, 9, 30, 0, 0, time.UTC)
+	suggestions := []Suggestion{
+		{SuggestionID: "s1", AgentID: "a1", Action: feedbackActionUse, MsgID: "m1", Similarity: 90, Confidence: 0.9, CreatedAt: day},
+		{SuggestionID: "s2", AgentID: "a1", Action: "edited", MsgID: "m2", Similarity: 70, Confidence: 0.7, CreatedAt: day.Add(time.Hour)},
+		{SuggestionID: "s3", AgentID: "a1", Confidence: 0.2, CreatedAt: day.Add(2 * time.Hour)},
+		{SuggestionID: "s4", AgentID: "a2", Action: feedbackActionReject, Confidence: 0.15, CreatedAt: day.Add(24 * time.Hour)},
+	}
+	for _, sug := range suggestions {
+		if err := suggestionStore.CreateSuggestion(sug); err != nil {
+			t.Fatalf("CreateSuggestion: %v", err)
+		}
+	}
+
+	get := func(target string, out interface{}) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		if strings.HasPrefix(target, "/api/analytics/calibration") {
+			SuggestionCalibrationHandler(rec, httptest.NewRequest("GET", target, nil))
+		} else {
+			SuggestionAnalyticsHandler(rec, httptest.NewRequest("GET", target, nil))
+		}
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", target, rec.Code, rec.Body.String())
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("解析响应失败: %v", err)
+		}
+	}
+
+	var byWeek struct {
+		Metrics []SuggestionMetrics `json:"metrics"`
+	}
+	get("/api/analytics/suggestions?bucket=week&since=2026-10-01T00:00:00Z", &byWeek)
+	if len(byWeek.Metrics) != 2 {
+		t.Fatalf("metrics = %+v, want 2 行（a1、a2）", byWeek.Metrics)
+	}
+	monday := time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC)
+	a1 := byWeek.Metrics[0]
+	if !a1.Bucket.Equal(monday) || a1.Key != "a1" {
+		t.Errorf("bucket = %v, key = %s, want %v, a1", a1.Bucket, a1.Key, monday)
+	}
+	if a1.Generated != 3 || a1.Used != 1 || a1.Edited != 1 || a1.Ignored != 1 || a1.Linked != 2 || a1.AvgSimilarity != 80 {
+		t.Errorf("a1 = %+v", a1)
+	}
+
+	var byHour struct {
+		Metrics []SuggestionMetrics `json:"metrics"`
+	}
+	get("/api/analytics/suggestions?bucket=hour&group_by=corp&since=2026-10-01T00:00:00Z", &byHour)
+	if len(byHour.Metrics) != 4 || !byHour.Metrics[0].Bucket.Equal(time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("按小时统计 = %+v", byHour.Metrics)
+	}
+
+	// 未指定 since 时只统计默认窗口内的建议
+	t.Setenv("STATS_DEFAULT_WINDOW", "1h")
+	var recent struct {
+		Since   string              `json:"since"`
+		Metrics []SuggestionMetrics `json:"metrics"`
+	}
+	get("/api/analytics/suggestions?bucket=day", &recent)
+	if recent.Since == "" {
+		t.Error("响应应包含默认的 since")
+	}
+	if len(recent.Metrics) != 0 {
+		t.Errorf("默认窗口外的建议不应计入: %+v", recent.Metrics)
+	}
+
+	var calibration struct {
+		Bins []CalibrationBin `json:"bins"`
+	}
+	get("/api/analytics/calibration?bins=10&since=2026-10-01T00:00:00Z", &calibration)
+	counts := make([]int, len(calibration.Bins))
+	for i, bin := range calibration.Bins {
+		counts[i] = bin.Count
+	}
+	// 有反馈的建议：0.9 → 9，0.7 → 7，0.15 → 1；没有反馈的不计入
+	want := []int{0, 1, 0, 0, 0, 0, 0, 1, 0, 1}
+	for i := range want {
+		if counts[i] != want[i] {
+			t.Errorf("各区间建议数 = %v, want %v", counts, want)
+			break
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm/clause"
+)
+
+// feedbackActionAuto 由服务端自动回复的建议
+const feedbackActionAuto = "auto"
+
+// AutoReplySetting auto_reply_settings 表模型，客服的自动回复开关
+type AutoReplySetting struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"-"`
+	AgentID   string    `gorm:"type:varchar(255);uniqueIndex;not null" json:"agent_id"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (AutoReplySetting) TableName() string {
+	return "auto_reply_settings"
+}
+
+// AutoReplyStore 缓存客服的自动回复开关
+// 多实例部署时开关可能在其他实例上修改，缓存超过 AUTO_REPLY_SETTING_TTL 后回查数据库，
+// 发送自动回复前通过 Reload 重新读取，关闭后立即在所有实例生效
+type AutoReplyStore struct {
+	mu      sync.RWMutex
+	entries map[string]autoReplyEntry
+}
+
+// autoReplyEntry 缓存的自动回复开关及读取时间
+type autoReplyEntry struct {
+	enabled  bool
+	loadedAt time.Time
+}
+
+var autoReplySettings = &AutoReplyStore{
+	entries: make(map[string]autoReplyEntry),
+}
+
+// autoReplySettingTTL 自动回复开关的缓存时间（默认 30 秒）
+func autoReplySettingTTL() time.Duration {
+	return getEnvDuration("AUTO_REPLY_SETTING_TTL", 30*time.Second)
+}
+
+// Enabled 客服是否开启了自动回复，缓存未命中或已过期时回查数据库
+func (s *AutoReplyStore) Enabled(agentID string) bool {
+	s.mu.RLock()
+	entry, ok := s.entries[agentID]
+	s.mu.RUnlock()
+	if db == nil || (ok && time.Since(entry.loadedAt) < autoReplySettingTTL()) {
+		return entry.enabled
+	}
+	return s.Reload(agentID)
+}
+
+// Reload 从数据库重新读取客服的自动回复开关并更新缓存，未启用数据库时返回内存中的值
+func (s *AutoReplyStore) Reload(agentID string) bool {
+	if db == nil {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return s.entries[agentID].enabled
+	}
+
+	var setting AutoReplySetting
+	if err := db.Where("agent_id = ?", agentID).Limit(1).Find(&setting).Error; err != nil {
+		// 查询失败时视为关闭，不缓存结果
+		logger.Warn("查询自动回复设置失败", zap.String("agent_id", agentID), zap.Error(err))
+		return false
+	}
+
+	s.mu.Lock()
+	s.entries[agentID] = autoReplyEntry{enabled: setting.Enabled, loadedAt: time.Now()}
+	s.mu.Unlock()
+	return setting.Enabled
+}
+
+// Set 设置客服的自动回复开关，先更新内存再持久化，保存失败时在本实例的缓存有效期内仍然生效
+func (s *AutoReplyStore) Set(agentID string, enabled bool) error {
+	s.mu.Lock()
+	s.entries[agentID] = autoReplyEntry{enabled: enabled, loadedAt: time.Now()}
+	s.mu.Unlock()
+
+	if db == nil {
+		return nil
+	}
+
+	setting := AutoReplySetting{AgentID: agentID, Enabled: enabled}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "agent_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"enabled", "updated_at"}),
+	}).Create(&setting).Error
+	if err != nil {
+		return fmt.Errorf("保存自动回复设置失败: %w", err)
+	}
+	return nil
+}
+
+// splitEnvList 读取逗号分隔的环境变量，忽略空项
+func splitEnvList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// autoReplyIntents 允许自动回复的意图（逗号分隔），为空时不限制
+func autoReplyIntents() []string {
+	return splitEnvList("AUTO_REPLY_INTENTS")
+}
+
+// autoReplyOpenKfIDs 开启自动回复的微信客服账号（逗号分隔），为空时所有会话都不自动回复
+// 自动回复通过微信客服消息接口发送，只能回复这些账号接待的微信客服会话，客户联系的会话不会自动回复
+func autoReplyOpenKfIDs() []string {
+	return splitEnvList("AUTO_REPLY_OPEN_KFIDS")
+}
+
+// autoReplyCandidate 判断自动回复条件所需的建议信息
+type autoReplyCandidate struct {
+	OpenKfID         string // 微信客服会话的客服账号ID，非微信客服会话为空
+	Intent           string
+	Confidence       float64
+	ComplianceStatus string
+	CacheUses        int     // 命中的缓存条目被客服采用过的次数，未命中缓存为 0
+	CacheSimilarity  float64 // 与命中的缓存问题的相似度（0-100），未命中缓存为 0
+}
+
+// autoReplyAllowed 判断建议是否满足自动回复条件：
+// 会话所属的微信客服账号和客服都已开启自动回复、意图在允许范围内、
+// 置信度、缓存采用次数和问题相似度达到阈值、合规检查完全通过
+func autoReplyAllowed(agentID string, candidate autoReplyCandidate) bool {
+	if candidate.OpenKfID == "" || !containsString(autoReplyOpenKfIDs(), candidate.OpenKfID) {
+		return false
+	}
+	if !autoReplySettings.Enabled(agentID) {
+		return false
+	}
+	if intents := autoReplyIntents(); len(intents) > 0 && !containsString(intents, candidate.Intent) {
+		return false
+	}
+	if candidate.Confidence < getEnvFloat("AUTO_REPLY_MIN_CONFIDENCE", 0.95) {
+		return false
+	}
+	if minUses := getEnvInt("AUTO_REPLY_MIN_CACHE_USES", 3); minUses > 0 {
+		if candidate.CacheUses < minUses || candidate.CacheSimilarity < getEnvFloat("AUTO_REPLY_MIN_CACHE_SIMILARITY", 95) {
+			return false
+		}
+	}
+	return candidate.ComplianceStatus == complianceStatusPassed
+}
+
+// sendWeComText 通过微信客服消息接口以 openKfID 账号向微信客服会话的客户发送文本消息，返回消息ID
+// POST {WECOM_API_BASE_URL}/cgi-bin/kf/send_msg
+func sendWeComText(ctx context.Context, openKfID, externalUserID, text string) (string, error) {
+	corpID := os.Getenv("WECOM_CORP_ID")
+	corpSecret := os.Getenv("WECOM_CORP_SECRET")
+	if corpID == "" || corpSecret == "" {
+		return "", fmt.Errorf("缺少 WECOM_CORP_ID 或 WECOM_CORP_SECRET 环境变量")
+	}
+
+	accessToken, err := getAccessToken(corpID, corpSecret)
+	if err != nil {
+		return "", fmt.Errorf("获取 access_token 失败: %w", err)
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"touser":    externalUserID,
+		"open_kfid": openKfID,
+		"msgtype":   "text",
+		"text":      map[string]string{"content": text},
+	})
+	if err != nil {
+		return "", fmt.Errorf("序列化消息失败: %w", err)
+	}
+
+	apiURL := fmt.Sprintf("%s/cgi-bin/kf/send_msg?access_token=%s", wecomAPIBaseURL(), url.QueryEscape(accessToken))
+	reqCtx, cancel := context.WithTimeout(ctx, getEnvDuration("AUTO_REPLY_TIMEOUT", 5*time.Second))
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, apiURL, bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("发送请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("读取响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("请求返回错误状态码: %d, 响应: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+		MsgID   string `json:"msgid"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("解析响应失败: %w", err)
+	}
+	if result.ErrCode != 0 {
+		return "", fmt.Errorf("发送消息失败: errcode=%d, errmsg=%s", result.ErrCode, result.ErrMsg)
+	}
+	return result.MsgID, nil
+}
+
+// tryAutoReply 满足自动回复条件时直接向客户发送回复，并通知侧边栏
+// 返回 false 时建议仍按正常流程展示给客服
+func (c *WeComClient) tryAutoReply(ctx context.Context, chatID, suggestionID, text string, candidate autoReplyCandidate) bool {
+	if text == "" || !autoReplyAllowed(c.AgentID, candidate) {
+		return false
+	}
+	// 请求已被更新的消息取代或客户端已断开
+	if ctx.Err() != nil {
+		return false
+	}
+	// 发送前从数据库重新读取开关，客服在其他实例上关闭自动回复时立即生效
+	if !autoReplySettings.Reload(c.AgentID) {
+		return false
+	}
+
+	wecomMsgID, err := sendWeComText(ctx, candidate.OpenKfID, chatID, text)
+	if err != nil {
+		logger.Warn("自动回复发送失败，改为展示建议",
+			zap.String("agent_id", c.AgentID),
+			zap.String("chat_id", chatID),
+			zap.String("suggestion_id", suggestionID),
+			zap.Error(err))
+		return false
+	}
+
+	logger.Info("已自动回复客户",
+		zap.String("agent_id", c.AgentID),
+		zap.String("chat_id", chatID),
+		zap.String("suggestion_id", suggestionID),
+		zap.String("wecom_msg_id", wecomMsgID))
+
+	if err := c.SendMessage(map[string]interface{}{
+		"type":          "ai_auto_replied",
+		"agent_id":      c.AgentID,
+		"chat_id":       chatID,
+		"suggestion_id": suggestionID,
+		"text":          text,
+		"intent":        candidate.Intent,
+		"confidence":    candidate.Confidence,
+	}); err != nil {
+		logger.Error("发送 ai_auto_replied 消息失败", zap.String("agent_id", c.AgentID), zap.Error(err))
+	}
+	return true
+}
+
+// sendAutoReplyStatus 通知侧边栏当前的自动回复开关
+func (c *WeComClient) sendAutoReplyStatus() {
+	if err := c.SendMessage(map[string]interface{}{
+		"type":     "auto_reply_status",
+		"agent_id": c.AgentID,
+		"enabled":  autoReplySettings.Enabled(c.AgentID),
+	}); err != nil {
+		logger.Error("发送 auto_reply_status 消息失败", zap.String("agent_id", c.AgentID), zap.Error(err))
+	}
+}
+
+// handleSetAutoReply 处理侧边栏的自动回复开关，content 为 {"enabled": true}
+func (c *WeComClient) handleSetAutoReply(msg WeComMessage) {
+	var data struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.Unmarshal(msg.Content, &data); err != nil || data.Enabled == nil {
+		logger.Warn("自动回复设置缺少 enabled 字段", zap.String("agent_id", c.AgentID))
+		c.sendAutoReplyStatus()
+		return
+	}
+
+	if err := autoReplySettings.Set(c.AgentID, *data.Enabled); err != nil {
+		logger.Error("保存自动回复设置失败", zap.String("agent_id", c.AgentID), zap.Error(err))
+	}
+	logger.Info("客服设置自动回复", zap.String("agent_id", c.AgentID), zap.Bool("enabled", *data.Enabled))
+	c.sendAutoReplyStatus()
+}
+
+// AutoReplySettingsHandler 查询客服的自动回复开关
+// GET /api/auto-reply
+func AutoReplySettingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if db == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "数据库未初始化")
+		return
+	}
+
+	var settings []AutoReplySetting
+	if err := db.Order("agent_id").Find(&settings).Error; err != nil {
+		logger.Error("查询自动回复设置失败", zap.Error(err))
+		writeJSONError(w, http.StatusInternalServerError, "查询自动回复设置失败")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"settings":             settings,
+		"open_kfids":           autoReplyOpenKfIDs(),
+		"intents":              autoReplyIntents(),
+		"min_confidence":       getEnvFloat("AUTO_REPLY_MIN_CONFIDENCE", 0.95),
+		"min_cache_uses":       getEnvInt("AUTO_REPLY_MIN_CACHE_USES", 3),
+		"min_cache_similarity": getEnvFloat("AUTO_REPLY_MIN_CACHE_SIMILARITY", 95),
+	})
+}
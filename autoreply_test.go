@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestAutoReplyStore() *AutoReplyStore {
+	return &AutoReplyStore{entries: make(map[string]autoReplyEntry)}
+}
+
+func TestAutoReplyStoreWithoutDatabase(t *testing.T) {
+	s := newTestAutoReplyStore()
+	if s.Enabled("a1") {
+		t.Error("未设置时自动回复应为关闭")
+	}
+	if err := s.Set("a1", true); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if !s.Enabled("a1") || !s.Reload("a1") {
+		t.Error("未启用数据库时应使用内存中的开关")
+	}
+}
+
+func TestAutoReplyStoreReloadSeesOtherInstances(t *testing.T) {
+	newTestSQLiteStore(t)
+	t.Setenv("AUTO_REPLY_SETTING_TTL", "1h")
+
+	local, other := newTestAutoReplyStore(), newTestAutoReplyStore()
+	if err := local.Set("a1", true); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if !other.Enabled("a1") {
+		t.Fatal("其他实例应从数据库读取开关")
+	}
+
+	// 在另一个实例上关闭自动回复
+	if err := other.Set("a1", false); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if !local.Enabled("a1") {
+		t.Error("缓存有效期内应使用缓存的开关")
+	}
+	if local.Reload("a1") {
+		t.Error("Reload 应读取其他实例修改后的开关")
+	}
+	if local.Enabled("a1") {
+		t.Error("Reload 后缓存应更新")
+	}
+
+	// 缓存过期后回查数据库
+	t.Setenv("AUTO_REPLY_SETTING_TTL", "1ms")
+	if err := other.Set("a1", true); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if !local.Enabled("a1") {
+		t.Error("缓存过期后应回查数据库")
+	}
+}
+
+func TestAutoReplyAllowedRequiresOptIn(t *testing.T) {
+	t.Setenv("AUTO_REPLY_OPEN_KFIDS", "wk1")
+	t.Setenv("AUTO_REPLY_MIN_CACHE_USES", "0")
+	saved := autoReplySettings
+	autoReplySettings = newTestAutoReplyStore()
+	t.Cleanup(func() { autoReplySettings = saved })
+
+	candidate := autoReplyCandidate{OpenKfID: "wk1", Confidence: 0.99, ComplianceStatus: complianceStatusPassed}
+	if autoReplyAllowed("a1", candidate) {
+		t.Error("客服未开启自动回复时不应自动回复")
+	}
+	autoReplySettings.Set("a1", true)
+	if !autoReplyAllowed("a1", candidate) {
+		t.Error("满足全部条件时应自动回复")
+	}
+
+	other := candidate
+	other.OpenKfID = "wk2"
+	if autoReplyAllowed("a1", other) {
+		t.Error("未开启自动回复的客服账号不应自动回复")
+	}
+	low := candidate
+	low.Confidence = 0.5
+	if autoReplyAllowed("a1", low) {
+		t.Error("置信度不足时不应自动回复")
+	}
+}
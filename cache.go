@@ -0,0 +1,349 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SuggestionCacheEntry suggestion_cache 表模型，客服采用过的建议按问题缓存
+type SuggestionCacheEntry struct {
+	ID                 uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	CorpID             string    `gorm:"type:varchar(100);uniqueIndex:idx_suggestion_cache_key;not null" json:"corp_id"`
+	Intent             string    `gorm:"type:varchar(50);uniqueIndex:idx_suggestion_cache_key" json:"intent"`
+	QuestionHash       string    `gorm:"type:varchar(64);uniqueIndex:idx_suggestion_cache_key;not null" json:"-"` // 归一化问题的 SHA-256
+	Question           string    `gorm:"type:text" json:"question"`
+	NormalizedQuestion string    `gorm:"type:text" json:"normalized_question"`
+	Answer             string    `gorm:"type:text" json:"answer"` // 客服语言的建议
+	SuggestionID       string    `gorm:"type:varchar(255)" json:"suggestion_id"`
+	UseCount           int       `json:"use_count"` // 被客服采用的次数（含命中缓存后再次采用）
+	HitCount           int       `json:"hit_count"` // 命中次数
+	ExpiresAt          time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (SuggestionCacheEntry) TableName() string {
+	return "suggestion_cache"
+}
+
+// suggestionCacheEnabled 是否启用建议缓存，设置 SUGGESTION_CACHE=false 关闭
+func suggestionCacheEnabled() bool {
+	return os.Getenv("SUGGESTION_CACHE") != "false"
+}
+
+// normalizeQuestion 归一化问题文本：转小写，标点和空白统一为单个空格
+// 中日韩文字之间不用空格分词，相邻两个中日韩文字之间的标点和空白直接去掉（"怎么 退货" 与 "怎么退货" 相同）
+func normalizeQuestion(text string) string {
+	var b strings.Builder
+	space := false
+	lastCJK := false
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			cjk := isCJK(r)
+			if space && b.Len() > 0 && !(cjk && lastCJK) {
+				b.WriteByte(' ')
+			}
+			b.WriteRune(unicode.ToLower(r))
+			space = false
+			lastCJK = cjk
+		} else {
+			space = true
+		}
+	}
+	return b.String()
+}
+
+// questionHash 计算归一化问题的哈希
+func questionHash(normalized string) string {
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// SuggestionCache 建议缓存，未过期的条目加载到内存中匹配，变更时失效
+type SuggestionCache struct {
+	mu      sync.RWMutex
+	loaded  bool
+	version uint64
+	entries []cachedSuggestion
+}
+
+type cachedSuggestion struct {
+	entry SuggestionCacheEntry
+	words map[string]int
+}
+
+var suggestionCache = &SuggestionCache{}
+
+// Invalidate 使缓存失效
+func (s *SuggestionCache) Invalidate() {
+	s.mu.Lock()
+	s.loaded = false
+	s.version++
+	s.entries = nil
+	s.mu.Unlock()
+}
+
+// load 从数据库加载未过期的条目
+func (s *SuggestionCache) load() error {
+	s.mu.RLock()
+	loaded := s.loaded
+	version := s.version
+	s.mu.RUnlock()
+	if loaded {
+		return nil
+	}
+
+	var entries []SuggestionCacheEntry
+	if err := db.Where("expires_at > ?", time.Now()).Find(&entries).Error; err != nil {
+		return fmt.Errorf("加载建议缓存失败: %w", err)
+	}
+
+	cached := make([]cachedSuggestion, 0, len(entries))
+	for _, entry := range entries {
+		// 缓存在客户之间共享，含敏感信息的条目不再使用
+		if containsPII(entry.Question) || containsPII(entry.Answer) {
+			continue
+		}
+		cached = append(cached, cachedSuggestion{
+			entry: entry,
+			words: tokenize(entry.NormalizedQuestion),
+		})
+	}
+
+	s.mu.Lock()
+	s.entries = cached
+	s.loaded = s.version == version
+	s.mu.Unlock()
+	return nil
+}
+
+// CacheMatch 命中的缓存条目
+type CacheMatch struct {
+	Entry      SuggestionCacheEntry
+	Similarity float64 // 与缓存问题的相似度（0-100），归一化后完全相同为 100
+	Confidence float64 // 缓存来源建议的模型置信度
+}
+
+// Lookup 查找同一企业、同一意图下与问题相同或相似度不低于 SUGGESTION_CACHE_MIN_SIMILARITY 的缓存条目
+func (s *SuggestionCache) Lookup(corpID, intent, question string) (CacheMatch, bool) {
+	if !suggestionCacheEnabled() || db == nil {
+		return CacheMatch{}, false
+	}
+	normalized := normalizeQuestion(question)
+	if normalized == "" {
+		return CacheMatch{}, false
+	}
+
+	if err := s.load(); err != nil {
+		logger.Warn("加载建议缓存失败，跳过缓存", zap.Error(err))
+		return CacheMatch{}, false
+	}
+
+	minSimilarity := getEnvFloat("SUGGESTION_CACHE_MIN_SIMILARITY", 90)
+	words := tokenize(normalized)
+	now := time.Now()
+
+	var best CacheMatch
+	found := false
+	s.mu.RLock()
+	for _, cached := range s.entries {
+		entry := cached.entry
+		if entry.CorpID != corpID || entry.Intent != intent || !entry.ExpiresAt.After(now) {
+			continue
+		}
+		similarity := 100.0
+		if entry.NormalizedQuestion != normalized {
+			similarity = cosineSimilarity(words, cached.words)
+		}
+		if similarity >= minSimilarity && (!found || similarity > best.Similarity) {
+			best = CacheMatch{Entry: entry, Similarity: similarity}
+			found = true
+		}
+	}
+	s.mu.RUnlock()
+
+	if !found {
+		return CacheMatch{}, false
+	}
+
+	err := db.Model(&SuggestionCacheEntry{}).
+		Where("id = ?", best.Entry.ID).
+		UpdateColumn("hit_count", gorm.Expr("hit_count + 1")).Error
+	if err != nil {
+		logger.Warn("更新建议缓存命中次数失败", zap.Uint("id", best.Entry.ID), zap.Error(err))
+	}
+
+	best.Confidence = defaultSuggestionConfidence
+	var source Suggestion
+	err = db.Select("confidence").Where("suggestion_id = ?", best.Entry.SuggestionID).Limit(1).Find(&source).Error
+	if err != nil {
+		logger.Warn("查询缓存来源建议失败", zap.String("suggestion_id", best.Entry.SuggestionID), zap.Error(err))
+	} else if source.Confidence > 0 {
+		best.Confidence = source.Confidence
+	}
+	return best, true
+}
+
+// learnSuggestionCache 根据客服反馈维护建议缓存
+// 客服直接采用（use）的建议写入缓存并延长有效期；命中缓存的建议被拒绝时删除该条目
+// 缓存在同一企业的所有客户之间共享，问题或建议中含敏感信息时不写入
+func learnSuggestionCache(suggestionID, action string) error {
+	if !suggestionCacheEnabled() || db == nil {
+		return nil
+	}
+
+	action = normalizeFeedbackAction(action)
+	if action != feedbackActionUse && action != feedbackActionReject {
+		return nil
+	}
+
+	var suggestion Suggestion
+	if err := db.Where("suggestion_id = ?", suggestionID).First(&suggestion).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("查询 suggestion 失败: %w", err)
+	}
+
+	if action == feedbackActionReject {
+		if suggestion.CacheEntryID == 0 {
+			return nil
+		}
+		if err := db.Delete(&SuggestionCacheEntry{}, suggestion.CacheEntryID).Error; err != nil {
+			return fmt.Errorf("删除建议缓存失败: %w", err)
+		}
+		suggestionCache.Invalidate()
+		logger.Info("命中缓存的建议被拒绝，已删除缓存条目",
+			zap.String("suggestion_id", suggestionID),
+			zap.Uint("cache_entry_id", suggestion.CacheEntryID))
+		return nil
+	}
+
+	normalized := normalizeQuestion(suggestion.Question)
+	if normalized == "" || suggestion.OriginalContent == "" || suggestion.ComplianceStatus == complianceStatusBlocked {
+		return nil
+	}
+	if containsPII(suggestion.Question) || containsPII(suggestion.OriginalContent) {
+		logger.Debug("建议包含敏感信息，不写入缓存", zap.String("suggestion_id", suggestionID))
+		return nil
+	}
+
+	now := time.Now()
+	entry := SuggestionCacheEntry{
+		CorpID:             currentCorpID(),
+		Intent:             suggestion.Intent,
+		QuestionHash:       questionHash(normalized),
+		Question:           suggestion.Question,
+		NormalizedQuestion: normalized,
+		Answer:             suggestion.OriginalContent,
+		SuggestionID:       suggestion.SuggestionID,
+		UseCount:           1,
+		ExpiresAt:          now.Add(getEnvDuration("SUGGESTION_CACHE_TTL", 24*time.Hour)),
+	}
+	err := db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "corp_id"}, {Name: "intent"}, {Name: "question_hash"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"answer":        entry.Answer,
+			"suggestion_id": entry.SuggestionID,
+			"use_count":     gorm.Expr("suggestion_cache.use_count + 1"),
+			"expires_at":    entry.ExpiresAt,
+			"updated_at":    now,
+		}),
+	}).Create(&entry).Error
+	if err != nil {
+		return fmt.Errorf("保存建议缓存失败: %w", err)
+	}
+	suggestionCache.Invalidate()
+	return nil
+}
+
+// SuggestionCacheHandler 查询或清空建议缓存
+// GET /api/suggestion-cache?intent=...&limit=100, DELETE /api/suggestion-cache
+func SuggestionCacheHandler(w http.ResponseWriter, r *http.Request) {
+	if db == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "数据库未初始化")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		query := db.Model(&SuggestionCacheEntry{}).
+			Where("corp_id = ? AND expires_at > ?", currentCorpID(), time.Now()).
+			Order("hit_count DESC, id DESC")
+		if intent := r.URL.Query().Get("intent"); intent != "" {
+			query = query.Where("intent = ?", intent)
+		}
+
+		limit := 100
+		if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 1000 {
+			limit = l
+		}
+
+		var entries []SuggestionCacheEntry
+		if err := query.Limit(limit).Find(&entries).Error; err != nil {
+			logger.Error("查询建议缓存失败", zap.Error(err))
+			writeJSONError(w, http.StatusInternalServerError, "查询建议缓存失败")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"entries": entries,
+		})
+
+	case http.MethodDelete:
+		if err := db.Where("corp_id = ?", currentCorpID()).Delete(&SuggestionCacheEntry{}).Error; err != nil {
+			logger.Error("清空建议缓存失败", zap.Error(err))
+			writeJSONError(w, http.StatusInternalServerError, "清空建议缓存失败")
+			return
+		}
+		suggestionCache.Invalidate()
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// SuggestionCacheEntryHandler 删除单个缓存条目
+// DELETE /api/suggestion-cache/{id}
+func SuggestionCacheEntryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if db == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "数据库未初始化")
+		return
+	}
+
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "无效的缓存条目ID")
+		return
+	}
+	result := db.Where("corp_id = ?", currentCorpID()).Delete(&SuggestionCacheEntry{}, id)
+	if result.Error != nil {
+		logger.Error("删除建议缓存失败", zap.Uint64("id", id), zap.Error(result.Error))
+		writeJSONError(w, http.StatusInternalServerError, "删除建议缓存失败")
+		return
+	}
+	if result.RowsAffected == 0 {
+		writeJSONError(w, http.StatusNotFound, "缓存条目不存在")
+		return
+	}
+	suggestionCache.Invalidate()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestNormalizeQuestion(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "", want: ""},
+		{text: "!!!", want: ""},
+		{text: "  Hello,  World!! ", want: "hello world"},
+		{text: "怎么退货？", want: "怎么退货"},
+		{text: "iPhone 15 怎么 退货", want: "iphone 15 怎么退货"},
+		{text: "怎么，退货？", want: "怎么退货"},
+		{text: "订单-123/456", want: "订单 123 456"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeQuestion(tt.text); got != tt.want {
+			t.Errorf("normalizeQuestion(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestQuestionHashIgnoresFormatting(t *testing.T) {
+	a := questionHash(normalizeQuestion("怎么退货？"))
+	b := questionHash(normalizeQuestion("怎么 退货!"))
+	if a != b {
+		t.Error("中文之间的空白和标点不应影响哈希")
+	}
+	if questionHash(normalizeQuestion("How to return?")) != questionHash(normalizeQuestion("how to RETURN")) {
+		t.Error("只有大小写和标点不同的问题应得到相同的哈希")
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// circuitState 熔断器状态
+type circuitState int
+
+const (
+	circuitClosed   circuitState = iota // 关闭：正常放行请求
+	circuitOpen                         // 打开：拒绝所有请求
+	circuitHalfOpen                     // 半开：放行一个探测请求
+)
+
+// CircuitBreaker 后端熔断器
+// 连续失败次数达到阈值后打开熔断，经过冷却时间后进入半开状态放行一个探测请求，
+// 探测成功则关闭熔断，失败则重新打开
+type CircuitBreaker struct {
+	mu               sync.Mutex
+	backend          string
+	state            circuitState
+	failures         int           // 连续失败次数
+	openedAt         time.Time     // 熔断打开时间
+	probing          bool          // 半开状态下是否已有探测请求在进行
+	failureThreshold int           // 打开熔断的连续失败次数
+	openTimeout      time.Duration // 熔断打开后的冷却时间
+}
+
+// circuitBreakers 按后端地址维护熔断器
+var circuitBreakers = struct {
+	mu       sync.Mutex
+	breakers map[string]*CircuitBreaker
+}{
+	breakers: make(map[string]*CircuitBreaker),
+}
+
+// getCircuitBreaker 获取指定后端的熔断器，不存在时创建
+func getCircuitBreaker(backend string) *CircuitBreaker {
+	circuitBreakers.mu.Lock()
+	defer circuitBreakers.mu.Unlock()
+
+	breaker, ok := circuitBreakers.breakers[backend]
+	if !ok {
+		breaker = &CircuitBreaker{
+			backend:          backend,
+			state:            circuitClosed,
+			failureThreshold: getEnvInt("AGENT_CIRCUIT_FAILURE_THRESHOLD", 5),
+			openTimeout:      getEnvDuration("AGENT_CIRCUIT_OPEN_TIMEOUT", 30*time.Second),
+		}
+		circuitBreakers.breakers[backend] = breaker
+	}
+	return breaker
+}
+
+// Allow 判断是否放行请求
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return false
+		}
+		// 冷却时间已过，进入半开状态放行一个探测请求
+		b.state = circuitHalfOpen
+		b.probing = true
+		logger.Info("熔断器进入半开状态", zap.String("backend", b.backend))
+		return true
+	case circuitHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// RecordSuccess 记录一次成功调用
+func (b *CircuitBreaker) RecordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != circuitClosed {
+		logger.Info("熔断器已关闭，后端恢复", zap.String("backend", b.backend))
+	}
+	b.state = circuitClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// RecordFailure 记录一次失败调用
+func (b *CircuitBreaker) RecordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+
+	if b.state == circuitHalfOpen || b.failures >= b.failureThreshold {
+		if b.state != circuitOpen {
+			logger.Warn("熔断器已打开，暂停调用后端",
+				zap.String("backend", b.backend),
+				zap.Int("failures", b.failures),
+				zap.Duration("open_timeout", b.openTimeout))
+		}
+		b.state = circuitOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// Release 释放放行的请求但不记录结果（调用方主动取消时使用）
+func (b *CircuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// RetryAfter 返回熔断打开时距离下一次探测的剩余时间
+func (b *CircuitBreaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != circuitOpen {
+		return 0
+	}
+	remaining := b.openTimeout - time.Since(b.openedAt)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newTestCircuitBreaker(threshold int, timeout time.Duration) *CircuitBreaker {
+	logger = zap.NewNop()
+	return &CircuitBreaker{
+		backend:          "test",
+		state:            circuitClosed,
+		failureThreshold: threshold,
+		openTimeout:      timeout,
+	}
+}
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	b := newTestCircuitBreaker(3, time.Minute)
+	for i := 0; i < 2; i++ {
+		if !b.Allow() {
+			t.Fatalf("第 %d 次失败前应放行", i+1)
+		}
+		b.RecordFailure()
+	}
+	if !b.Allow() {
+		t.Fatal("未达到阈值时应放行")
+	}
+	b.RecordFailure()
+	if b.Allow() {
+		t.Fatal("达到阈值后应拒绝请求")
+	}
+	if b.RetryAfter() <= 0 {
+		t.Error("熔断打开时 RetryAfter 应大于 0")
+	}
+}
+
+func TestCircuitBreakerSuccessResetsFailures(t *testing.T) {
+	b := newTestCircuitBreaker(2, time.Minute)
+	b.RecordFailure()
+	b.RecordSuccess()
+	b.RecordFailure()
+	if !b.Allow() {
+		t.Error("成功调用应重置连续失败次数")
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbe(t *testing.T) {
+	b := newTestCircuitBreaker(1, time.Minute)
+	b.RecordFailure()
+	// 模拟冷却时间已过
+	b.openedAt = time.Now().Add(-2 * time.Minute)
+
+	if !b.Allow() {
+		t.Fatal("冷却后应放行一个探测请求")
+	}
+	if b.Allow() {
+		t.Fatal("探测进行中应拒绝其他请求")
+	}
+
+	// 探测失败重新打开
+	b.RecordFailure()
+	if b.state != circuitOpen || b.Allow() {
+		t.Fatal("探测失败后应重新打开熔断")
+	}
+
+	b.openedAt = time.Now().Add(-2 * time.Minute)
+	if !b.Allow() {
+		t.Fatal("冷却后应再次放行探测请求")
+	}
+	b.RecordSuccess()
+	if b.state != circuitClosed || !b.Allow() || !b.Allow() {
+		t.Error("探测成功后应关闭熔断")
+	}
+	if b.RetryAfter() != 0 {
+		t.Error("熔断关闭时 RetryAfter 应为 0")
+	}
+}
+
+func TestCircuitBreakerReleaseFreesProbe(t *testing.T) {
+	b := newTestCircuitBreaker(1, time.Minute)
+	b.RecordFailure()
+	b.openedAt = time.Now().Add(-2 * time.Minute)
+	if !b.Allow() {
+		t.Fatal("冷却后应放行探测请求")
+	}
+	b.Release()
+	if !b.Allow() {
+		t.Error("释放探测后应允许新的探测请求")
+	}
+}
+
+func TestNotifyAIUnavailablePerBackend(t *testing.T) {
+	logger = zap.NewNop()
+	c := &WeComClient{AgentID: "a1", Send: make(chan []byte, 4)}
+
+	c.notifyAIUnavailable("c1", "http://backend-a")
+	c.notifyAIUnavailable("c1", "http://backend-a")
+	c.notifyAIUnavailable("c1", "http://backend-b")
+
+	if got := len(c.Send); got != 2 {
+		t.Errorf("每个熔断后端应各通知一次，实际 %d 次", got)
+	}
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 合规规则分类
+const (
+	complianceCategoryBannedPhrase  = "banned_phrase"  // 禁用词
+	complianceCategoryRefundPromise = "refund_promise" // 退款承诺
+	complianceCategoryGuarantee     = "guarantee"      // 保证性措辞
+	complianceCategoryCompetitor    = "competitor"     // 竞品名称
+	complianceCategoryRegex         = "regex"          // 自定义正则
+)
+
+// 命中规则后的处理方式
+const (
+	complianceActionBlock   = "block"   // 拦截，不展示给客服
+	complianceActionRewrite = "rewrite" // 替换命中内容后展示
+	complianceActionFlag    = "flag"    // 原样展示并提示客服
+)
+
+// 建议的合规检查结果
+const (
+	complianceStatusPassed    = "passed"
+	complianceStatusFlagged   = "flagged"
+	complianceStatusRewritten = "rewritten"
+	complianceStatusBlocked   = "blocked"
+)
+
+var complianceCategories = map[string]bool{
+	complianceCategoryBannedPhrase:  true,
+	complianceCategoryRefundPromise: true,
+	complianceCategoryGuarantee:     true,
+	complianceCategoryCompetitor:    true,
+	complianceCategoryRegex:         true,
+}
+
+var complianceActions = map[string]bool{
+	complianceActionBlock:   true,
+	complianceActionRewrite: true,
+	complianceActionFlag:    true,
+}
+
+// ComplianceRule compliance_rules 表模型，AI 建议的合规规则
+type ComplianceRule struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name        string    `gorm:"type:varchar(255)" json:"name"`
+	Category    string    `gorm:"type:varchar(50);index;not null" json:"category"`
+	Pattern     string    `gorm:"type:text;not null" json:"pattern"` // 关键词或正则表达式
+	IsRegex     bool      `json:"is_regex"`                          // Pattern 是否为正则，否则按关键词（忽略大小写）匹配
+	Action      string    `gorm:"type:varchar(20);not null" json:"action"`
+	Replacement string    `gorm:"type:text" json:"replacement"` // action=rewrite 时的替换内容，正则规则支持 $1 引用
+	Message     string    `gorm:"type:text" json:"message"`     // 展示给客服的提示
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (ComplianceRule) TableName() string {
+	return "compliance_rules"
+}
+
+// builtinComplianceRules 内置的退款承诺和保证性措辞规则，默认只提示不拦截
+// 设置 COMPLIANCE_BUILTIN_RULES=false 可关闭
+var builtinComplianceRules = []ComplianceRule{
+	{
+		Name:     "内置：退款承诺",
+		Category: complianceCategoryRefundPromise,
+		Pattern:  `(保证|承诺|一定|肯定|马上|立即|立刻)[^，。！？,.!?]{0,10}(退款|退钱|赔偿|全额退)`,
+		IsRegex:  true,
+		Action:   complianceActionFlag,
+		Message:  "包含退款承诺，请确认符合退款政策后再发送",
+	},
+	{
+		Name:     "内置：保证性措辞",
+		Category: complianceCategoryGuarantee,
+		Pattern:  `(百分之百|100%|绝对没问题|包(你|您)满意|保证[^，。！？,.!?]{0,6}(效果|收益|成功|解决|满意))`,
+		IsRegex:  true,
+		Action:   complianceActionFlag,
+		Message:  "包含保证性措辞，请避免做出无法兑现的承诺",
+	},
+}
+
+// ComplianceViolation 建议命中的一条合规规则
+type ComplianceViolation struct {
+	RuleID   uint   `json:"rule_id"` // 内置规则为 0
+	RuleName string `json:"rule_name"`
+	Category string `json:"category"`
+	Action   string `json:"action"`
+	Match    string `json:"match"` // 命中的文本
+	Message  string `json:"message"`
+}
+
+// ComplianceResult 合规检查结果
+type ComplianceResult struct {
+	Status     string                `json:"status"`
+	Text       string                `json:"text"` // 处理后的文本，被拦截时为原文
+	Violations []ComplianceViolation `json:"violations"`
+}
+
+// compileComplianceRule 编译规则的匹配表达式
+func compileComplianceRule(rule ComplianceRule) (*regexp.Regexp, error) {
+	if rule.IsRegex {
+		return regexp.Compile(rule.Pattern)
+	}
+	return regexp.Compile("(?i)" + regexp.QuoteMeta(rule.Pattern))
+}
+
+// ComplianceEngine 合规规则引擎，缓存已编译的规则，规则变更时失效
+type ComplianceEngine struct {
+	mu      sync.RWMutex
+	loaded  bool
+	version uint64 // 每次失效递增，避免加载过程中发生的变更被覆盖
+	rules   []compiledComplianceRule
+}
+
+type compiledComplianceRule struct {
+	rule ComplianceRule
+	re   *regexp.Regexp
+}
+
+var complianceEngine = &ComplianceEngine{}
+
+// Invalidate 使规则缓存失效，下次检查时重新加载
+// 已加载的规则在重新加载成功前继续生效
+func (e *ComplianceEngine) Invalidate() {
+	e.mu.Lock()
+	e.loaded = false
+	e.version++
+	e.mu.Unlock()
+}
+
+// load 加载内置规则和数据库中启用的规则
+func (e *ComplianceEngine) load() error {
+	e.mu.RLock()
+	loaded := e.loaded
+	version := e.version
+	e.mu.RUnlock()
+	if loaded {
+		return nil
+	}
+
+	var rules []ComplianceRule
+	if os.Getenv("COMPLIANCE_BUILTIN_RULES") != "false" {
+		rules = append(rules, builtinComplianceRules...)
+	}
+	if db != nil {
+		var dbRules []ComplianceRule
+		if err := db.Where("enabled = ?", true).Order("id").Find(&dbRules).Error; err != nil {
+			return fmt.Errorf("加载合规规则失败: %w", err)
+		}
+		rules = append(rules, dbRules...)
+	}
+
+	compiled := make([]compiledComplianceRule, 0, len(rules))
+	for _, rule := range rules {
+		re, err := compileComplianceRule(rule)
+		if err != nil {
+			// 写入时已校验，这里只可能是数据库被直接修改
+			logger.Warn("合规规则无法编译，已跳过", zap.Uint("rule_id", rule.ID), zap.String("pattern", rule.Pattern), zap.Error(err))
+			continue
+		}
+		compiled = append(compiled, compiledComplianceRule{rule: rule, re: re})
+	}
+
+	e.mu.Lock()
+	e.rules = compiled
+	e.loaded = e.version == version
+	e.mu.Unlock()
+
+	logger.Info("合规规则已加载", zap.Int("rules", len(compiled)))
+	return nil
+}
+
+// Check 检查文本是否命中合规规则
+// 任一 block 规则命中即拦截；否则依次应用 rewrite 规则的替换；只命中 flag 规则时原样返回并附带提示
+func (e *ComplianceEngine) Check(text string) ComplianceResult {
+	if err := e.load(); err != nil {
+		logger.Warn("加载合规规则失败，使用已缓存的规则", zap.Error(err))
+	}
+
+	result := ComplianceResult{
+		Status:     complianceStatusPassed,
+		Text:       text,
+		Violations: []ComplianceViolation{},
+	}
+
+	e.mu.RLock()
+	rules := e.rules
+	e.mu.RUnlock()
+
+	blocked, rewritten := false, false
+	for _, cr := range rules {
+		match := cr.re.FindString(text)
+		if match == "" {
+			continue
+		}
+
+		result.Violations = append(result.Violations, ComplianceViolation{
+			RuleID:   cr.rule.ID,
+			RuleName: cr.rule.Name,
+			Category: cr.rule.Category,
+			Action:   cr.rule.Action,
+			Match:    match,
+			Message:  cr.rule.Message,
+		})
+
+		switch cr.rule.Action {
+		case complianceActionBlock:
+			blocked = true
+		case complianceActionRewrite:
+			rewritten = true
+			if cr.rule.IsRegex {
+				result.Text = cr.re.ReplaceAllString(result.Text, cr.rule.Replacement)
+			} else {
+				result.Text = cr.re.ReplaceAllLiteralString(result.Text, cr.rule.Replacement)
+			}
+		}
+	}
+
+	switch {
+	case blocked:
+		result.Status = complianceStatusBlocked
+		result.Text = text
+	case rewritten:
+		result.Status = complianceStatusRewritten
+	case len(result.Violations) > 0:
+		result.Status = complianceStatusFlagged
+	}
+	return result
+}
+
+// validateComplianceRule 校验规则字段
+func validateComplianceRule(rule *ComplianceRule) error {
+	rule.Pattern = strings.TrimSpace(rule.Pattern)
+	if rule.Pattern == "" {
+		return fmt.Errorf("pattern 不能为空")
+	}
+	if rule.Category == complianceCategoryRegex {
+		rule.IsRegex = true
+	}
+	if !complianceCategories[rule.Category] {
+		return fmt.Errorf("无效的 category: %s", rule.Category)
+	}
+	if !complianceActions[rule.Action] {
+		return fmt.Errorf("无效的 action: %s", rule.Action)
+	}
+	if _, err := compileComplianceRule(*rule); err != nil {
+		return fmt.Errorf("无效的正则表达式: %v", err)
+	}
+	if rule.Name == "" {
+		rule.Name = rule.Pattern
+	}
+	return nil
+}
+
+// ComplianceRulesHandler 合规规则列表和创建
+// GET /api/compliance/rules[?category=...], POST /api/compliance/rules
+func ComplianceRulesHandler(w http.ResponseWriter, r *http.Request) {
+	if db == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "数据库未初始化")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		query := db.Order("id")
+		if category := r.URL.Query().Get("category"); category != "" {
+			query = query.Where("category = ?", category)
+		}
+		var rules []ComplianceRule
+		if err := query.Find(&rules).Error; err != nil {
+			logger.Error("查询合规规则失败", zap.Error(err))
+			writeJSONError(w, http.StatusInternalServerError, "查询合规规则失败")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"rules":   rules,
+			"builtin": builtinComplianceRules,
+		})
+
+	case http.MethodPost:
+		// 未指定 enabled 时默认启用
+		rule := ComplianceRule{Enabled: true}
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "无效的请求体")
+			return
+		}
+		if err := validateComplianceRule(&rule); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		rule.ID = 0
+		if err := db.Create(&rule).Error; err != nil {
+			logger.Error("创建合规规则失败", zap.Error(err))
+			writeJSONError(w, http.StatusInternalServerError, "创建合规规则失败")
+			return
+		}
+		complianceEngine.Invalidate()
+		writeJSON(w, http.StatusCreated, rule)
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// ComplianceRuleHandler 单条合规规则的查询、更新和删除
+// GET/PUT/DELETE /api/compliance/rules/{id}
+func ComplianceRuleHandler(w http.ResponseWriter, r *http.Request) {
+	if db == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "数据库未初始化")
+		return
+	}
+
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "无效的规则ID")
+		return
+	}
+
+	var existing ComplianceRule
+	if err := db.First(&existing, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSONError(w, http.StatusNotFound, "规则不存在")
+			return
+		}
+		logger.Error("查询合规规则失败", zap.Uint64("id", id), zap.Error(err))
+		writeJSONError(w, http.StatusInternalServerError, "查询合规规则失败")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, existing)
+
+	case http.MethodPut:
+		// 以现有规则为基础，只覆盖请求中提供的字段
+		rule := existing
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "无效的请求体")
+			return
+		}
+		if err := validateComplianceRule(&rule); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		rule.ID = existing.ID
+		rule.CreatedAt = existing.CreatedAt
+		if err := db.Save(&rule).Error; err != nil {
+			logger.Error("更新合规规则失败", zap.Uint64("id", id), zap.Error(err))
+			writeJSONError(w, http.StatusInternalServerError, "更新合规规则失败")
+			return
+		}
+		complianceEngine.Invalidate()
+		writeJSON(w, http.StatusOK, rule)
+
+	case http.MethodDelete:
+		if err := db.Delete(&ComplianceRule{}, id).Error; err != nil {
+			logger.Error("删除合规规则失败", zap.Uint64("id", id), zap.Error(err))
+			writeJSONError(w, http.StatusInternalServerError, "删除合规规则失败")
+			return
+		}
+		complianceEngine.Invalidate()
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// ComplianceCheckHandler 使用当前规则检查一段文本，便于调试规则
+// POST /api/compliance/check {"text": "..."}
+func ComplianceCheckHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "无效的请求体")
+		return
+	}
+	writeJSON(w, http.StatusOK, complianceEngine.Check(req.Text))
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -170,3 +171,45 @@ func WeComConfigHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// getEnvDuration 读取时长类型的环境变量（如 30m、1h），未设置或格式错误时返回默认值
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		logger.Warn("环境变量时长格式错误，使用默认值", zap.String("key", key), zap.String("value", value), zap.Duration("default", defaultValue))
+		return defaultValue
+	}
+	return d
+}
+
+// getEnvInt 读取整数类型的环境变量，未设置或格式错误时返回默认值
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		logger.Warn("环境变量整数格式错误，使用默认值", zap.String("key", key), zap.String("value", value), zap.Int("default", defaultValue))
+		return defaultValue
+	}
+	return n
+}
+
+// getEnvFloat 读取浮点类型的环境变量，未设置或格式错误时返回默认值
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		logger.Warn("环境变量数值格式错误，使用默认值", zap.String("key", key), zap.String("value", value), zap.Float64("default", defaultValue))
+		return defaultValue
+	}
+	return f
+}
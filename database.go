@@ -1,15 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"os"
 	"sort"
-	"strings"
 	"time"
-	"unicode"
 
+	"go.uber.org/zap"
 	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	gormLogger "gorm.io/gorm/logger"
 )
@@ -18,25 +19,35 @@ var db *gorm.DB
 
 // Suggestion suggestion 表模型
 type Suggestion struct {
-	ID              uint    `gorm:"primaryKey;autoIncrement"`
-	SuggestionID    string  `gorm:"type:varchar(255);uniqueIndex;not null"`
-	AgentID         string  `gorm:"type:varchar(255);index;not null"`
-	ChatID          string  `gorm:"type:varchar(255);index"`
-	MsgID           string  `gorm:"type:varchar(255);index"` // 关联的消息ID
-	OriginalContent string  `gorm:"type:text"`
-	EditedContent   string  `gorm:"type:text"`
-	Confidence      float64 `gorm:"type:decimal(5,2)"`
-	Similarity      float64 `gorm:"type:decimal(5,2);default:0"` // 相似率（0-100）
-	Action          string  `gorm:"type:varchar(50)"`            // use, edit, reject
-	CreatedAt       time.Time
-	UpdatedAt       time.Time
+	ID                   uint    `gorm:"primaryKey;autoIncrement"`
+	SuggestionID         string  `gorm:"type:varchar(255);uniqueIndex;not null"`
+	AgentID              string  `gorm:"type:varchar(255);index;not null"`
+	ChatID               string  `gorm:"type:varchar(255);index"`
+	MsgID                string  `gorm:"type:varchar(255);index"` // 关联的消息ID
+	OriginalContent      string  `gorm:"type:text"`
+	EditedContent        string  `gorm:"type:text"`
+	Confidence           float64 `gorm:"type:decimal(5,2)"`
+	Similarity           float64 `gorm:"type:decimal(5,2);default:0"` // 相似率（0-100）
+	Action               string  `gorm:"type:varchar(50)"`            // use, edit, reject, auto（自动回复）
+	KnowledgeIDs         string  `gorm:"type:text"`                   // 生成建议时使用的知识库片段ID（逗号分隔）
+	ComplianceStatus     string  `gorm:"type:varchar(20);index"`      // 合规检查结果：passed, flagged, rewritten, blocked
+	ComplianceViolations string  `gorm:"type:text"`                   // 命中的合规规则（JSON 数组）
+	Intent               string  `gorm:"type:varchar(50);index"`      // 客户消息的意图分类
+	Language             string  `gorm:"type:varchar(10)"`            // 客户语言，与客服语言相同时为空
+	TranslatedContent    string  `gorm:"type:text"`                   // 回译为客户语言的建议
+	Experiment           string  `gorm:"type:varchar(100);index"`     // 命中的 A/B 实验
+	Variant              string  `gorm:"type:varchar(100)"`           // 实验变体
+	Question             string  `gorm:"type:text"`                   // 客服语言的客户问题，用于建议缓存
+	CacheEntryID         uint    `gorm:"index"`                       // 命中的建议缓存条目，未命中为 0
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
 }
 
 // MatchedSuggestion 匹配的 suggestion 结果，包含相似度信息
 type MatchedSuggestion struct {
 	Suggestion
 	Similarity float64 // 相似度（0-100）
-	MatchType  string  // 匹配类型：exact_original, exact_edited, similar
+	MatchType  string  // 匹配类型：exact_original, exact_edited, exact_translated, similar
 }
 
 // TableName 指定表名
@@ -44,8 +55,48 @@ func (Suggestion) TableName() string {
 	return "suggestions"
 }
 
-// initDatabase 初始化数据库连接
-func initDatabase() error {
+// openDatabase 按 DB_DRIVER 连接数据库并创建 suggestion 存储，不执行迁移
+// memory 后端不连接数据库，db 保持为 nil，依赖数据库的其他功能不可用
+func openDatabase() error {
+	var dialector gorm.Dialector
+	switch storageDriver() {
+	case storageDriverMemory:
+		suggestionStore = newMemorySuggestionStore()
+		logger.Info("使用内存存储，suggestion 不会持久化")
+		return nil
+	case storageDriverSQLite:
+		dialector = sqliteDialector()
+	default:
+		dialector = postgresDialector()
+	}
+
+	// 配置 GORM logger
+	gormLog := gormLogger.New(
+		&zapLoggerAdapter{},
+		gormLogger.Config{
+			SlowThreshold:             time.Second,
+			LogLevel:                  gormLogger.Info,
+			IgnoreRecordNotFoundError: true,
+			Colorful:                  false,
+		},
+	)
+
+	// 连接数据库
+	var err error
+	db, err = gorm.Open(dialector, &gorm.Config{
+		Logger: gormLog,
+	})
+	if err != nil {
+		return fmt.Errorf("连接数据库失败: %w", err)
+	}
+	suggestionStore = &gormSuggestionStore{db: db}
+
+	logger.Info("数据库连接成功", zap.String("driver", db.Dialector.Name()))
+	return nil
+}
+
+// postgresDialector 根据 DB_HOST 等环境变量创建 PostgreSQL 连接
+func postgresDialector() gorm.Dialector {
 	// 从环境变量获取数据库连接信息
 	host := os.Getenv("DB_HOST")
 	if host == "" {
@@ -80,33 +131,36 @@ func initDatabase() error {
 	// 构建 DSN
 	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 		host, port, user, password, dbname, sslmode)
+	return postgres.Open(dsn)
+}
 
-	// 配置 GORM logger
-	gormLog := gormLogger.New(
-		&zapLoggerAdapter{},
-		gormLogger.Config{
-			SlowThreshold:             time.Second,
-			LogLevel:                  gormLogger.Info,
-			IgnoreRecordNotFoundError: true,
-			Colorful:                  false,
-		},
-	)
+// sqliteDialector 打开 DB_SQLITE_PATH 指定的 SQLite 文件（默认 sidebar.db），用于单机部署和本地开发
+func sqliteDialector() gorm.Dialector {
+	path := os.Getenv("DB_SQLITE_PATH")
+	if path == "" {
+		path = "sidebar.db"
+	}
+	// WAL 模式允许读写并发，写入冲突时等待而不是立即返回 database is locked
+	return sqlite.Open(path + "?_journal_mode=WAL&_busy_timeout=5000")
+}
 
-	// 连接数据库
-	var err error
-	db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: gormLog,
-	})
-	if err != nil {
-		return fmt.Errorf("连接数据库失败: %w", err)
+// initDatabase 初始化数据库连接，DB_MIGRATE_ON_START 未关闭时执行未完成的迁移
+func initDatabase() error {
+	if err := openDatabase(); err != nil {
+		return err
+	}
+	// memory 后端没有数据库，无需迁移
+	if db == nil || !migrateOnStart() {
+		return nil
 	}
 
-	// 自动迁移表结构
-	if err := db.AutoMigrate(&Suggestion{}); err != nil {
+	count, err := migrateUp(context.Background())
+	if err != nil {
 		return fmt.Errorf("数据库迁移失败: %w", err)
 	}
-
-	logger.Info("数据库连接成功")
+	if count > 0 {
+		logger.Info("数据库迁移完成", zap.Int("count", count))
+	}
 	return nil
 }
 
@@ -129,36 +183,21 @@ func calculateCosineSimilarity(text1, text2 string) float64 {
 	}
 
 	// 分词并构建词频向量
-	words1 := tokenize(text1)
-	words2 := tokenize(text2)
-
-	// 获取所有唯一的词
-	allWords := make(map[string]bool)
-	for word := range words1 {
-		allWords[word] = true
-	}
-	for word := range words2 {
-		allWords[word] = true
-	}
-
-	// 构建向量
-	vector1 := make([]float64, 0, len(allWords))
-	vector2 := make([]float64, 0, len(allWords))
-
-	for word := range allWords {
-		vector1 = append(vector1, float64(words1[word]))
-		vector2 = append(vector2, float64(words2[word]))
-	}
+	return cosineSimilarity(tokenize(text1), tokenize(text2))
+}
 
-	// 计算余弦相似度
+// cosineSimilarity 计算两个词频向量的余弦相似度（返回 0-100 的百分比）
+func cosineSimilarity(words1, words2 map[string]int) float64 {
 	dotProduct := 0.0
 	magnitude1 := 0.0
 	magnitude2 := 0.0
 
-	for i := 0; i < len(vector1); i++ {
-		dotProduct += vector1[i] * vector2[i]
-		magnitude1 += vector1[i] * vector1[i]
-		magnitude2 += vector2[i] * vector2[i]
+	for word, count := range words1 {
+		magnitude1 += float64(count) * float64(count)
+		dotProduct += float64(count) * float64(words2[word])
+	}
+	for _, count := range words2 {
+		magnitude2 += float64(count) * float64(count)
 	}
 
 	if magnitude1 == 0 || magnitude2 == 0 {
@@ -170,87 +209,28 @@ func calculateCosineSimilarity(text1, text2 string) float64 {
 	return similarity * 100.0
 }
 
-// tokenize 将文本分词并返回词频映射
-func tokenize(text string) map[string]int {
-	words := make(map[string]int)
-
-	// 简单的分词：按空格和标点符号分割
-	runes := []rune(text)
-	currentWord := strings.Builder{}
-
-	for _, r := range runes {
-		if unicode.IsLetter(r) || unicode.IsDigit(r) {
-			currentWord.WriteRune(unicode.ToLower(r))
-		} else {
-			if currentWord.Len() > 0 {
-				word := currentWord.String()
-				if len(word) > 1 { // 忽略单字符
-					words[word]++
-				}
-				currentWord.Reset()
-			}
-		}
-	}
-
-	// 处理最后一个词
-	if currentWord.Len() > 0 {
-		word := currentWord.String()
-		if len(word) > 1 {
-			words[word]++
-		}
-	}
-
-	return words
-}
-
 // findSuggestionsByContent 根据内容查询 suggestion 记录并计算相似度
-// 查询时间戳在指定时间之前的 n 条记录，计算与 original_content 或 edited_content 的相似度
+// 查询时间戳在指定时间之前的 n 条记录，用 SUGGESTION_SIMILARITY_ALGORITHM 指定的算法计算与 original_content 或 edited_content 的相似度
 func findSuggestionsByContent(agentID string, chatID string, content string, beforeTime time.Time, limit int) ([]MatchedSuggestion, error) {
-	var suggestions []Suggestion
-
-	// 查询所有符合条件的记录（不限制内容匹配）
-	query := db.Where("agent_id = ? AND chat_id = ? AND created_at < ?", agentID, chatID, beforeTime).
-		Order("created_at DESC").
-		Limit(limit * 2) // 多查询一些，用于相似度筛选
-
-	if err := query.Find(&suggestions).Error; err != nil {
-		return nil, fmt.Errorf("查询 suggestion 失败: %w", err)
+	if suggestionStore == nil {
+		return nil, fmt.Errorf("数据库未初始化")
 	}
 
-	// 获取相似度阈值（默认 80%）
-	similarityThreshold := 80.0
-	if thresholdStr := os.Getenv("SUGGESTION_SIMILARITY_THRESHOLD"); thresholdStr != "" {
-		if threshold, err := fmt.Sscanf(thresholdStr, "%f", &similarityThreshold); err != nil || threshold != 1 {
-			similarityThreshold = 80.0
-		}
+	// 查询所有符合条件的记录（不限制内容匹配），多查询一些，用于相似度筛选
+	suggestions, err := suggestionStore.RecentSuggestions(agentID, chatID, beforeTime, limit*2)
+	if err != nil {
+		return nil, err
 	}
 
+	sim := suggestionSimilarity()
+	similarityThreshold := suggestionSimilarityThreshold(sim.Name())
+
 	var matchedSuggestions []MatchedSuggestion
 
 	for _, sug := range suggestions {
-		var similarity float64
-		var matchType string
-
-		// 检查是否与 original_content 完全相同
-		if sug.OriginalContent == content {
-			similarity = 100.0
-			matchType = "exact_original"
-		} else if sug.EditedContent == content {
-			// 如果与 edited_content 完全相同，计算 edited_content 与 original_content 的相似度
-			if sug.OriginalContent != "" {
-				similarity = calculateCosineSimilarity(sug.EditedContent, sug.OriginalContent)
-			} else {
-				similarity = 100.0 // 如果没有 original_content，认为相似度为 100%
-			}
-			matchType = "exact_edited"
-		} else {
-			// 计算与 original_content 的余弦相似度
-			if sug.OriginalContent != "" {
-				similarity = calculateCosineSimilarity(content, sug.OriginalContent)
-				matchType = "similar"
-			} else {
-				continue // 如果没有 original_content，跳过
-			}
+		similarity, matchType, ok := scoreSuggestion(sim, sug, content)
+		if !ok {
+			continue // 没有 original_content，跳过
 		}
 
 		// 只返回相似度达到阈值的记录
@@ -281,81 +261,46 @@ func findSuggestionsByContent(agentID string, chatID string, content string, bef
 }
 
 // createSuggestion 创建新的 suggestion 记录
-func createSuggestion(suggestionID, agentID, chatID, msgID, text string, confidence float64) error {
-	if db == nil {
+// MsgID、EditedContent、Similarity、Action 初始通常为空，由后续的消息关联和客服反馈更新
+func createSuggestion(suggestion Suggestion) error {
+	if suggestionStore == nil {
 		return fmt.Errorf("数据库未初始化")
 	}
+	return suggestionStore.CreateSuggestion(suggestion)
+}
 
-	suggestion := Suggestion{
-		SuggestionID:    suggestionID,
-		AgentID:         agentID,
-		ChatID:          chatID,
-		MsgID:           msgID, // 初始可能为空，后续关联时更新
-		OriginalContent: text,  // AI 建议的原始内容
-		EditedContent:   "",    // 初始为空，如果客服编辑后会有值
-		Confidence:      confidence,
-		Similarity:      0.0, // 初始为 0，关联消息时计算
-		Action:          "",  // 初始为空，反馈时更新
-	}
-
-	if err := db.Create(&suggestion).Error; err != nil {
-		return fmt.Errorf("创建 suggestion 失败: %w", err)
-	}
+// 客服反馈动作，侧边栏上报 used、edited、rejected，统计时与 use、edit、reject 视为相同
+const (
+	feedbackActionUse    = "use"
+	feedbackActionEdit   = "edit"
+	feedbackActionReject = "reject"
+)
 
-	return nil
+// normalizeFeedbackAction 将反馈动作统一为 use、edit、reject，无法识别时原样返回
+func normalizeFeedbackAction(action string) string {
+	switch action {
+	case "use", "used":
+		return feedbackActionUse
+	case "edit", "edited":
+		return feedbackActionEdit
+	case "reject", "rejected":
+		return feedbackActionReject
+	}
+	return action
 }
 
 // updateSuggestionFeedback 更新 suggestion 的反馈信息
 func updateSuggestionFeedback(suggestionID string, action string, originalContent string, editedContent string) error {
-	if db == nil {
+	if suggestionStore == nil {
 		return fmt.Errorf("数据库未初始化")
 	}
-
-	updates := map[string]interface{}{
-		"action": action,
-	}
-
-	// 如果提供了 original_content，则更新
-	if originalContent != "" {
-		updates["original_content"] = originalContent
-	}
-
-	// 如果提供了 edited_content，则更新
-	if editedContent != "" {
-		updates["edited_content"] = editedContent
-	}
-
-	result := db.Model(&Suggestion{}).
-		Where("suggestion_id = ?", suggestionID).
-		Updates(updates)
-
-	if result.Error != nil {
-		return fmt.Errorf("更新 suggestion 反馈信息失败: %w", result.Error)
-	}
-
-	if result.RowsAffected == 0 {
-		return fmt.Errorf("未找到 suggestion_id: %s", suggestionID)
-	}
-
-	return nil
+	return suggestionStore.UpdateFeedback(suggestionID, action, originalContent, editedContent)
 }
 
 // updateSuggestionMsgID 更新 suggestion 的 msg_id 和相似率
 func updateSuggestionMsgID(suggestionID string, msgID string, similarity float64) error {
-	result := db.Model(&Suggestion{}).
-		Where("suggestion_id = ?", suggestionID).
-		Updates(map[string]interface{}{
-			"msg_id":     msgID,
-			"similarity": similarity,
-		})
-
-	if result.Error != nil {
-		return fmt.Errorf("更新 suggestion msg_id 和相似率失败: %w", result.Error)
-	}
-
-	if result.RowsAffected == 0 {
-		return fmt.Errorf("未找到 suggestion_id: %s", suggestionID)
+	if suggestionStore == nil {
+		return fmt.Errorf("数据库未初始化")
 	}
-
-	return nil
+	return suggestionStore.UpdateMsgID(suggestionID, msgID, similarity)
 }
@@ -0,0 +1,660 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 编辑记录的来源
+const (
+	diffSourceFeedback = "feedback" // 侧边栏上报的编辑后内容
+	diffSourceLink     = "link"     // 关联到的客服实际发送的消息
+)
+
+// 差异操作类型
+const (
+	diffOpEqual  = "equal"
+	diffOpInsert = "insert"
+	diffOpDelete = "delete"
+)
+
+// 编辑分类
+const (
+	editAddedGreeting   = "added_greeting"   // 增加了问候语
+	editRemovedGreeting = "removed_greeting" // 删除了问候语
+	editAddedClosing    = "added_closing"    // 增加了结束语（感谢、祝福等）
+	editRemovedClosing  = "removed_closing"  // 删除了结束语
+	editChangedAmount   = "changed_amount"   // 修改了金额
+	editChangedNumber   = "changed_number"   // 修改了数字（日期、数量、单号等）
+	editChangedLink     = "changed_link"     // 修改了链接
+	editShortened       = "shortened"        // 明显缩短
+	editLengthened      = "lengthened"       // 明显加长
+	editRewritten       = "rewritten"        // 大部分内容被改写
+	editPunctuation     = "punctuation"      // 只修改了标点和空白
+	editMinor           = "minor_edit"       // 少量字词修改
+)
+
+// editCategories 所有编辑分类，统计时逐个汇总
+var editCategories = []string{
+	editAddedGreeting, editRemovedGreeting, editAddedClosing, editRemovedClosing,
+	editChangedAmount, editChangedNumber, editChangedLink, editShortened,
+	editLengthened, editRewritten, editPunctuation, editMinor,
+}
+
+// diffOp 一段差异操作，连续的同类操作合并为一段
+type diffOp struct {
+	Op   string `json:"op"` // equal, insert, delete
+	Text string `json:"text"`
+}
+
+// SuggestionDiff suggestion_diffs 表模型，AI 建议与客服实际发送内容的结构化差异
+type SuggestionDiff struct {
+	ID           uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	SuggestionID string    `gorm:"type:varchar(255);uniqueIndex;not null" json:"suggestion_id"`
+	AgentID      string    `gorm:"type:varchar(255);index" json:"agent_id"`
+	ChatID       string    `gorm:"type:varchar(255)" json:"chat_id"`
+	Intent       string    `gorm:"type:varchar(50);index" json:"intent"`
+	Source       string    `gorm:"type:varchar(20)" json:"source"` // feedback, link
+	Original     string    `gorm:"type:text" json:"original"`
+	Sent         string    `gorm:"type:text" json:"sent"`
+	CharOpsJSON  string    `gorm:"column:char_ops;type:text" json:"-"`
+	WordOpsJSON  string    `gorm:"column:word_ops;type:text" json:"-"`
+	CharOps      []diffOp  `gorm:"-" json:"char_ops"`
+	WordOps      []diffOp  `gorm:"-" json:"word_ops"`
+	CharsAdded   int       `json:"chars_added"`
+	CharsRemoved int       `json:"chars_removed"`
+	WordsAdded   int       `json:"words_added"`
+	WordsRemoved int       `json:"words_removed"`
+	EditRatio    float64   `json:"edit_ratio"`                 // 增删的字符占两段文本总长的比例
+	Categories   string    `gorm:"type:varchar(500)" json:"-"` // 逗号分隔
+	CategoryList []string  `gorm:"-" json:"categories"`        // Categories 拆分后的列表
+	CreatedAt    time.Time `gorm:"index" json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (SuggestionDiff) TableName() string {
+	return "suggestion_diffs"
+}
+
+// BeforeSave 序列化差异操作
+func (d *SuggestionDiff) BeforeSave(tx *gorm.DB) error {
+	charOps, err := json.Marshal(d.CharOps)
+	if err != nil {
+		return err
+	}
+	wordOps, err := json.Marshal(d.WordOps)
+	if err != nil {
+		return err
+	}
+	d.CharOpsJSON = string(charOps)
+	d.WordOpsJSON = string(wordOps)
+	d.Categories = strings.Join(d.CategoryList, ",")
+	return nil
+}
+
+// AfterFind 反序列化差异操作
+func (d *SuggestionDiff) AfterFind(tx *gorm.DB) error {
+	if d.CharOpsJSON != "" {
+		if err := json.Unmarshal([]byte(d.CharOpsJSON), &d.CharOps); err != nil {
+			return err
+		}
+	}
+	if d.WordOpsJSON != "" {
+		if err := json.Unmarshal([]byte(d.WordOpsJSON), &d.WordOps); err != nil {
+			return err
+		}
+	}
+	d.CategoryList = nil
+	if d.Categories != "" {
+		d.CategoryList = strings.Split(d.Categories, ",")
+	}
+	return nil
+}
+
+// maxDiffCells 差异计算的最大动态规划规模，超过时整体视为删除原文、插入新文本
+const maxDiffCells = 1_000_000
+
+// diffTokens 基于最长公共子序列计算两个序列的差异，连续的同类操作合并
+func diffTokens(a, b []string) []diffOp {
+	var ops []diffOp
+	appendOp := func(op, text string) {
+		if n := len(ops); n > 0 && ops[n-1].Op == op {
+			ops[n-1].Text += text
+			return
+		}
+		ops = append(ops, diffOp{Op: op, Text: text})
+	}
+
+	// 去掉公共前后缀，缩小计算规模
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	if prefix > 0 {
+		appendOp(diffOpEqual, strings.Join(a[:prefix], ""))
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	if len(midA)*len(midB) > maxDiffCells {
+		if len(midA) > 0 {
+			appendOp(diffOpDelete, strings.Join(midA, ""))
+		}
+		if len(midB) > 0 {
+			appendOp(diffOpInsert, strings.Join(midB, ""))
+		}
+	} else {
+		// lcs[i][j] 为 midA[i:] 与 midB[j:] 的最长公共子序列长度
+		lcs := make([][]int, len(midA)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(midB)+1)
+		}
+		for i := len(midA) - 1; i >= 0; i-- {
+			for j := len(midB) - 1; j >= 0; j-- {
+				if midA[i] == midB[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(midA) && j < len(midB) {
+			switch {
+			case midA[i] == midB[j]:
+				appendOp(diffOpEqual, midA[i])
+				i++
+				j++
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				appendOp(diffOpDelete, midA[i])
+				i++
+			default:
+				appendOp(diffOpInsert, midB[j])
+				j++
+			}
+		}
+		for ; i < len(midA); i++ {
+			appendOp(diffOpDelete, midA[i])
+		}
+		for ; j < len(midB); j++ {
+			appendOp(diffOpInsert, midB[j])
+		}
+	}
+
+	if suffix > 0 {
+		appendOp(diffOpEqual, strings.Join(a[len(a)-suffix:], ""))
+	}
+	return ops
+}
+
+// charTokens 按字符切分
+func charTokens(text string) []string {
+	tokens := make([]string, 0, len(text))
+	for _, r := range text {
+		tokens = append(tokens, string(r))
+	}
+	return tokens
+}
+
+// wordTokens 按词切分：英文、数字的连续片段为一个词，中日韩文字每字一个词，空白和标点各自成词
+// 拼接所有词可还原原文
+func wordTokens(text string) []string {
+	var tokens []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range text {
+		if !isCJK(r) && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			word.WriteRune(r)
+			continue
+		}
+		flush()
+		tokens = append(tokens, string(r))
+	}
+	flush()
+	return tokens
+}
+
+// isWordToken 是否为有意义的词（非空白、非标点）
+func isWordToken(token string) bool {
+	for _, r := range token {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	greetingPattern = regexp.MustCompile(`(?i)(您好|你好|亲[，,！!]|亲爱的|早上好|上午好|下午好|晚上好|\bhello\b|\bhi\b|\bdear\b)`)
+	closingPattern  = regexp.MustCompile(`(?i)(谢谢|感谢|祝您|如有.{0,6}(问题|疑问)|随时联系|\bthanks?\b|\bthank you\b|\bregards\b)`)
+	numberPattern   = regexp.MustCompile(`\d+(?:[.,]\d+)*`)
+	currencyPattern = regexp.MustCompile(`(?i)([¥￥$€£]|元|块|rmb|cny|usd)`)
+	linkPattern     = regexp.MustCompile(`https?://[^\s，。]+`)
+)
+
+// sameStrings 两个字符串列表作为多重集合是否相同
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := make(map[string]int, len(a))
+	for _, s := range a {
+		counts[s]++
+	}
+	for _, s := range b {
+		if counts[s]--; counts[s] < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// categorizeEdit 根据原文、发送内容和字符级差异归纳编辑类型
+func categorizeEdit(original, sent string, charsAdded, charsRemoved int) []string {
+	var categories []string
+
+	hadGreeting, hasGreeting := greetingPattern.MatchString(original), greetingPattern.MatchString(sent)
+	if !hadGreeting && hasGreeting {
+		categories = append(categories, editAddedGreeting)
+	} else if hadGreeting && !hasGreeting {
+		categories = append(categories, editRemovedGreeting)
+	}
+
+	hadClosing, hasClosing := closingPattern.MatchString(original), closingPattern.MatchString(sent)
+	if !hadClosing && hasClosing {
+		categories = append(categories, editAddedClosing)
+	} else if hadClosing && !hasClosing {
+		categories = append(categories, editRemovedClosing)
+	}
+
+	if !sameStrings(numberPattern.FindAllString(original, -1), numberPattern.FindAllString(sent, -1)) {
+		if currencyPattern.MatchString(original) || currencyPattern.MatchString(sent) {
+			categories = append(categories, editChangedAmount)
+		} else {
+			categories = append(categories, editChangedNumber)
+		}
+	}
+
+	if !sameStrings(linkPattern.FindAllString(original, -1), linkPattern.FindAllString(sent, -1)) {
+		categories = append(categories, editChangedLink)
+	}
+
+	originalLen, sentLen := utf8.RuneCountInString(original), utf8.RuneCountInString(sent)
+	switch {
+	case sentLen < originalLen*7/10:
+		categories = append(categories, editShortened)
+	case sentLen > originalLen*13/10:
+		categories = append(categories, editLengthened)
+	}
+
+	// 原文保留不到 40%，且新增内容与原文规模相当
+	switch {
+	case float64(originalLen-charsRemoved) < 0.4*float64(originalLen) && float64(charsAdded) >= 0.4*float64(originalLen):
+		categories = append(categories, editRewritten)
+	case normalizeQuestion(original) == normalizeQuestion(sent):
+		categories = append(categories, editPunctuation)
+	case len(categories) == 0 && charsAdded+charsRemoved <= 10:
+		categories = append(categories, editMinor)
+	}
+	return categories
+}
+
+// buildSuggestionDiff 计算 AI 建议与客服实际发送内容的差异，内容相同时返回 false
+func buildSuggestionDiff(original, sent string) (SuggestionDiff, bool) {
+	if original == "" || sent == "" || original == sent {
+		return SuggestionDiff{}, false
+	}
+
+	diff := SuggestionDiff{
+		Original: original,
+		Sent:     sent,
+		CharOps:  diffTokens(charTokens(original), charTokens(sent)),
+		WordOps:  diffTokens(wordTokens(original), wordTokens(sent)),
+	}
+	for _, op := range diff.CharOps {
+		switch op.Op {
+		case diffOpInsert:
+			diff.CharsAdded += utf8.RuneCountInString(op.Text)
+		case diffOpDelete:
+			diff.CharsRemoved += utf8.RuneCountInString(op.Text)
+		}
+	}
+	for _, op := range diff.WordOps {
+		if op.Op == diffOpEqual {
+			continue
+		}
+		count := 0
+		for _, token := range wordTokens(op.Text) {
+			if isWordToken(token) {
+				count++
+			}
+		}
+		if op.Op == diffOpInsert {
+			diff.WordsAdded += count
+		} else {
+			diff.WordsRemoved += count
+		}
+	}
+
+	total := utf8.RuneCountInString(original) + utf8.RuneCountInString(sent)
+	diff.EditRatio = math.Round(float64(diff.CharsAdded+diff.CharsRemoved)/float64(total)*1000) / 1000
+	diff.CategoryList = categorizeEdit(original, sent, diff.CharsAdded, diff.CharsRemoved)
+	return diff, true
+}
+
+// recordSuggestionDiff 计算并保存 suggestion 与客服实际发送内容的差异，同一 suggestion 只保留最新一次
+func recordSuggestionDiff(suggestionID, sent, source string) error {
+	if db == nil || sent == "" {
+		return nil
+	}
+
+	var suggestion Suggestion
+	if err := db.Where("suggestion_id = ?", suggestionID).First(&suggestion).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("查询 suggestion 失败: %w", err)
+	}
+
+	// 双语模式下客服可能发送的是回译后的建议，与更接近的版本比较
+	original := suggestion.OriginalContent
+	if suggestion.TranslatedContent != "" &&
+		calculateCosineSimilarity(sent, suggestion.TranslatedContent) > calculateCosineSimilarity(sent, original) {
+		original = suggestion.TranslatedContent
+	}
+
+	diff, ok := buildSuggestionDiff(original, sent)
+	if !ok {
+		return nil
+	}
+	diff.SuggestionID = suggestion.SuggestionID
+	diff.AgentID = suggestion.AgentID
+	diff.ChatID = suggestion.ChatID
+	diff.Intent = suggestion.Intent
+	diff.Source = source
+
+	err := db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "suggestion_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"source", "original", "sent", "char_ops", "word_ops",
+			"chars_added", "chars_removed", "words_added", "words_removed",
+			"edit_ratio", "categories", "updated_at",
+		}),
+	}).Create(&diff).Error
+	if err != nil {
+		return fmt.Errorf("保存 suggestion 差异失败: %w", err)
+	}
+	return nil
+}
+
+// suggestionDiffsQuery 根据查询参数构造 suggestion_diffs 查询
+// 支持 agent_id、intent、category 以及 RFC3339 格式的 since、until
+func suggestionDiffsQuery(r *http.Request) (*gorm.DB, error) {
+	query := db.Model(&SuggestionDiff{})
+	params := r.URL.Query()
+	if agentID := params.Get("agent_id"); agentID != "" {
+		query = query.Where("agent_id = ?", agentID)
+	}
+	if intent := params.Get("intent"); intent != "" {
+		query = query.Where("intent = ?", intent)
+	}
+	if category := params.Get("category"); category != "" {
+		query = query.Where("(',' || categories || ',') LIKE ?", "%,"+category+",%")
+	}
+	if since := params.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 since: %s", since)
+		}
+		query = query.Where("created_at >= ?", t)
+	}
+	if until := params.Get("until"); until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 until: %s", until)
+		}
+		query = query.Where("created_at < ?", t)
+	}
+	return query, nil
+}
+
+// SuggestionDiffsHandler 查询 suggestion 差异记录
+// GET /api/suggestion-diffs?agent_id=...&intent=...&category=...&since=...&until=...&limit=100
+func SuggestionDiffsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if db == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "数据库未初始化")
+		return
+	}
+
+	query, err := suggestionDiffsQuery(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	limit := 100
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 1000 {
+		limit = l
+	}
+
+	var diffs []SuggestionDiff
+	if err := query.Order("id DESC").Limit(limit).Find(&diffs).Error; err != nil {
+		logger.Error("查询 suggestion 差异失败", zap.Error(err))
+		writeJSONError(w, http.StatusInternalServerError, "查询 suggestion 差异失败")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"diffs": diffs,
+	})
+}
+
+// editFragment 被增加或删除的片段及次数
+type editFragment struct {
+	Text  string `json:"text"`
+	Count int    `json:"count"`
+}
+
+// editGroupStats 一个客服或意图的编辑统计
+type editGroupStats struct {
+	Key             string         `json:"key"`
+	Edits           int            `json:"edits"`
+	AvgEditRatio    float64        `json:"avg_edit_ratio"`
+	AvgCharsAdded   float64        `json:"avg_chars_added"`
+	AvgCharsRemoved float64        `json:"avg_chars_removed"`
+	Categories      map[string]int `json:"categories"`
+	TopInsertions   []editFragment `json:"top_insertions"`
+	TopDeletions    []editFragment `json:"top_deletions"`
+}
+
+// topFragments 按次数取前 n 个片段
+func topFragments(counts map[string]int, n int) []editFragment {
+	fragments := make([]editFragment, 0, len(counts))
+	for text, count := range counts {
+		fragments = append(fragments, editFragment{Text: text, Count: count})
+	}
+	sort.Slice(fragments, func(i, j int) bool {
+		if fragments[i].Count != fragments[j].Count {
+			return fragments[i].Count > fragments[j].Count
+		}
+		return fragments[i].Text < fragments[j].Text
+	})
+	if len(fragments) > n {
+		fragments = fragments[:n]
+	}
+	return fragments
+}
+
+// SuggestionDiffStatsHandler 按客服或意图汇总最常见的编辑
+// GET /api/suggestion-diffs/stats?group_by=agent|intent&agent_id=...&intent=...&since=...&until=...&top=10
+// 计数、均值和分类在数据库中汇总；增删片段分批读取统计。未指定 since 时统计最近 STATS_DEFAULT_WINDOW 内的记录
+func SuggestionDiffStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if db == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "数据库未初始化")
+		return
+	}
+
+	groupBy := r.URL.Query().Get("group_by")
+	if groupBy == "" {
+		groupBy = "agent"
+	}
+	if groupBy != "agent" && groupBy != "intent" {
+		writeJSONError(w, http.StatusBadRequest, "group_by 只支持 agent 或 intent")
+		return
+	}
+	keyColumn := "agent_id"
+	if groupBy == "intent" {
+		keyColumn = "intent"
+	}
+	top := 10
+	if t, err := strconv.Atoi(r.URL.Query().Get("top")); err == nil && t > 0 && t <= 100 {
+		top = t
+	}
+
+	query, err := suggestionDiffsQuery(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	query, since := withDefaultSince(query, r)
+	query = query.Session(&gorm.Session{})
+
+	columns := []string{
+		keyColumn + " AS group_key",
+		"COUNT(*) AS edits",
+		"COALESCE(AVG(edit_ratio), 0) AS avg_edit_ratio",
+		"COALESCE(AVG(chars_added), 0) AS avg_chars_added",
+		"COALESCE(AVG(chars_removed), 0) AS avg_chars_removed",
+	}
+	for i, category := range editCategories {
+		columns = append(columns, fmt.Sprintf("SUM(CASE WHEN (',' || categories || ',') LIKE '%%,%s,%%' THEN 1 ELSE 0 END) AS category_%d", category, i))
+	}
+	rows, err := query.Select(strings.Join(columns, ", ")).Group(keyColumn).Rows()
+	if err != nil {
+		logger.Error("统计 suggestion 差异失败", zap.Error(err))
+		writeJSONError(w, http.StatusInternalServerError, "统计 suggestion 差异失败")
+		return
+	}
+	defer rows.Close()
+
+	type accumulator struct {
+		stats      editGroupStats
+		insertions map[string]int
+		deletions  map[string]int
+	}
+	groups := make(map[string]*accumulator)
+	total := 0
+	for rows.Next() {
+		stats := editGroupStats{Categories: make(map[string]int)}
+		counts := make([]int, len(editCategories))
+		dest := []interface{}{&stats.Key, &stats.Edits, &stats.AvgEditRatio, &stats.AvgCharsAdded, &stats.AvgCharsRemoved}
+		for i := range counts {
+			dest = append(dest, &counts[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			logger.Error("统计 suggestion 差异失败", zap.Error(err))
+			writeJSONError(w, http.StatusInternalServerError, "统计 suggestion 差异失败")
+			return
+		}
+		for i, count := range counts {
+			if count > 0 {
+				stats.Categories[editCategories[i]] = count
+			}
+		}
+		total += stats.Edits
+		groups[stats.Key] = &accumulator{
+			stats:      stats,
+			insertions: make(map[string]int),
+			deletions:  make(map[string]int),
+		}
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error("统计 suggestion 差异失败", zap.Error(err))
+		writeJSONError(w, http.StatusInternalServerError, "统计 suggestion 差异失败")
+		return
+	}
+
+	// 词级差异为 JSON 文本，分批读取统计增删片段，内存只随不同片段的数量增长
+	var batch []SuggestionDiff
+	err = query.Select("id, agent_id, intent, word_ops").FindInBatches(&batch, 1000, func(tx *gorm.DB, _ int) error {
+		for _, diff := range batch {
+			key := diff.AgentID
+			if groupBy == "intent" {
+				key = diff.Intent
+			}
+			acc, ok := groups[key]
+			if !ok {
+				continue
+			}
+			for _, op := range diff.WordOps {
+				text := strings.TrimSpace(op.Text)
+				if text == "" || !isWordToken(text) || utf8.RuneCountInString(text) > 50 {
+					continue
+				}
+				switch op.Op {
+				case diffOpInsert:
+					acc.insertions[text]++
+				case diffOpDelete:
+					acc.deletions[text]++
+				}
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		logger.Error("统计 suggestion 差异失败", zap.Error(err))
+		writeJSONError(w, http.StatusInternalServerError, "统计 suggestion 差异失败")
+		return
+	}
+
+	result := make([]editGroupStats, 0, len(groups))
+	for _, acc := range groups {
+		stats := acc.stats
+		stats.TopInsertions = topFragments(acc.insertions, top)
+		stats.TopDeletions = topFragments(acc.deletions, top)
+		result = append(result, stats)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Edits != result[j].Edits {
+			return result[i].Edits > result[j].Edits
+		}
+		return result[i].Key < result[j].Key
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"group_by": groupBy,
+		"since":    since,
+		"total":    total,
+		"groups":   result,
+	})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []diffOp
+	}{
+		{name: "都为空", a: "", b: "", want: nil},
+		{name: "相同", a: "abc", b: "abc", want: []diffOp{{diffOpEqual, "abc"}}},
+		{name: "插入", a: "abc", b: "abxc", want: []diffOp{{diffOpEqual, "ab"}, {diffOpInsert, "x"}, {diffOpEqual, "c"}}},
+		{name: "删除", a: "abc", b: "ac", want: []diffOp{{diffOpEqual, "a"}, {diffOpDelete, "b"}, {diffOpEqual, "c"}}},
+		{name: "替换时先删除后插入", a: "abc", b: "axc", want: []diffOp{{diffOpEqual, "a"}, {diffOpDelete, "b"}, {diffOpInsert, "x"}, {diffOpEqual, "c"}}},
+		{name: "原文为空", a: "", b: "ab", want: []diffOp{{diffOpInsert, "ab"}}},
+		{name: "新文本为空", a: "ab", b: "", want: []diffOp{{diffOpDelete, "ab"}}},
+		{name: "中文", a: "请稍等片刻", b: "请稍等一下", want: []diffOp{{diffOpEqual, "请稍等"}, {diffOpDelete, "片刻"}, {diffOpInsert, "一下"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffTokens(charTokens(tt.a), charTokens(tt.b)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffTokens(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffTokensWords(t *testing.T) {
+	got := diffTokens(wordTokens("please check order 123"), wordTokens("please check order 456"))
+	want := []diffOp{{diffOpEqual, "please check order "}, {diffOpDelete, "123"}, {diffOpInsert, "456"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diffTokens = %v, want %v", got, want)
+	}
+}
+
+func TestCategorizeEdit(t *testing.T) {
+	tests := []struct {
+		name                     string
+		original, sent           string
+		charsAdded, charsRemoved int
+		want                     []string
+	}{
+		{name: "增加问候语", original: "订单已发货", sent: "您好，订单已发货", charsAdded: 3, want: []string{editAddedGreeting, editLengthened}},
+		{name: "删除结束语", original: "已处理，谢谢", sent: "已处理", charsRemoved: 3, want: []string{editRemovedClosing, editShortened}},
+		{name: "修改金额", original: "退款 100 元", sent: "退款 120 元", charsAdded: 1, charsRemoved: 1, want: []string{editChangedAmount}},
+		{name: "修改数字", original: "单号 12345", sent: "单号 12346", charsAdded: 1, charsRemoved: 1, want: []string{editChangedNumber}},
+		{name: "修改链接", original: "详见 https://a.com/x", sent: "详见 https://a.com/y", charsAdded: 1, charsRemoved: 1, want: []string{editChangedLink}},
+		{name: "只修改标点", original: "好的，马上处理", sent: "好的。马上处理！", charsAdded: 2, charsRemoved: 1, want: []string{editPunctuation}},
+		{name: "少量修改", original: "请稍等片刻", sent: "请稍等一下", charsAdded: 2, charsRemoved: 2, want: []string{editMinor}},
+		{name: "大部分改写", original: "abcdefghij", sent: "zyxwvutsrq", charsAdded: 10, charsRemoved: 10, want: []string{editRewritten}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := categorizeEdit(tt.original, tt.sent, tt.charsAdded, tt.charsRemoved)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("categorizeEdit(%q, %q) = %v, want %v", tt.original, tt.sent, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildSuggestionDiff(t *testing.T) {
+	if _, ok := buildSuggestionDiff("相同", "相同"); ok {
+		t.Error("内容相同时不应生成差异")
+	}
+
+	diff, ok := buildSuggestionDiff("请稍等片刻", "请稍等一下")
+	if !ok {
+		t.Fatal("内容不同时应生成差异")
+	}
+	if diff.CharsAdded != 2 || diff.CharsRemoved != 2 {
+		t.Errorf("chars added, removed = %d, %d, want 2, 2", diff.CharsAdded, diff.CharsRemoved)
+	}
+	if diff.EditRatio != 0.4 {
+		t.Errorf("edit ratio = %v, want 0.4", diff.EditRatio)
+	}
+	if !reflect.DeepEqual(diff.CategoryList, []string{editMinor}) {
+		t.Errorf("categories = %v, want [%s]", diff.CategoryList, editMinor)
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// 评估样本的标注来源
+const (
+	// evaluationLabelsFeedback 按客服反馈标注，与关联算法无关
+	evaluationLabelsFeedback = "feedback"
+	// evaluationLabelsLinker 以 suggestions.msg_id 的现有关联为标注，现有关联由当时配置的算法产生
+	evaluationLabelsLinker = "linker"
+)
+
+// evaluationSample 一条客服消息及其候选 suggestion
+type evaluationSample struct {
+	Content    string
+	Candidates []Suggestion // 消息之前创建的 suggestion，按创建时间倒序
+	Linked     string       // 标注的 suggestion_id，没有关联为空
+}
+
+// evaluationResult 一个算法在一个阈值下的关联效果
+type evaluationResult struct {
+	Algorithm string  `json:"algorithm"`
+	Threshold float64 `json:"threshold"`
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+	F1        float64 `json:"f1"`
+	TP        int     `json:"tp"`
+	FP        int     `json:"fp"`
+	FN        int     `json:"fn"`
+}
+
+// loadEvaluationSamples 读取 since 之后的客服消息（最多 limit 条）及同一会话中的 suggestion，按 labels 标注
+// 返回样本和无法确定标注、未参与评估的消息数
+func loadEvaluationSamples(since time.Time, limit, window int, labels string) ([]evaluationSample, int, error) {
+	chats := db.Model(&Suggestion{}).Distinct("chat_id").Where("created_at >= ? AND chat_id <> ''", since)
+
+	var messages []ChatMessage
+	if err := db.Where("role = ? AND msg_time >= ? AND chat_id IN (?)", roleAgent, since, chats).
+		Order("msg_time DESC").
+		Limit(limit).
+		Find(&messages).Error; err != nil {
+		return nil, 0, fmt.Errorf("查询会话消息失败: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	var chatIDs []string
+	for _, m := range messages {
+		if !seen[m.ChatID] {
+			seen[m.ChatID] = true
+			chatIDs = append(chatIDs, m.ChatID)
+		}
+	}
+
+	byChat := make(map[string][]Suggestion)
+	for start := 0; start < len(chatIDs); start += 500 {
+		end := min(start+500, len(chatIDs))
+		var suggestions []Suggestion
+		if err := db.Where("chat_id IN ?", chatIDs[start:end]).Order("created_at DESC").Find(&suggestions).Error; err != nil {
+			return nil, 0, fmt.Errorf("查询 suggestion 失败: %w", err)
+		}
+		for _, sug := range suggestions {
+			byChat[sug.ChatID] = append(byChat[sug.ChatID], sug)
+		}
+	}
+
+	samples := make([]evaluationSample, 0, len(messages))
+	for _, m := range messages {
+		sample := evaluationSample{Content: m.Content}
+		for _, sug := range byChat[m.ChatID] {
+			// 现有关联中被客服拒绝（reject）的 suggestion 不算作正确关联
+			if labels == evaluationLabelsLinker && sug.MsgID == m.MsgID && normalizeFeedbackAction(sug.Action) != feedbackActionReject {
+				sample.Linked = sug.SuggestionID
+			}
+			// 与线上关联一致，只把发送消息的客服的 suggestion 作为候选；早期记录的消息没有 agent_id，不过滤
+			if m.AgentID != "" && sug.AgentID != m.AgentID {
+				continue
+			}
+			if sug.CreatedAt.Before(m.MsgTime) && len(sample.Candidates) < window {
+				sample.Candidates = append(sample.Candidates, sug)
+			}
+		}
+		samples = append(samples, sample)
+	}
+	if labels != evaluationLabelsFeedback {
+		return samples, 0, nil
+	}
+	labeled := labelSamplesByFeedback(samples)
+	return labeled, len(samples) - len(labeled), nil
+}
+
+// adoptedText 客服采用 suggestion 时发送的文本：直接使用或自动回复为原文（双语模式下为回译文本），编辑后使用为 edited_content
+// 没有被采用时返回 false
+func adoptedText(sug Suggestion) ([]string, bool) {
+	switch normalizeFeedbackAction(sug.Action) {
+	case feedbackActionUse, feedbackActionAuto:
+		return []string{sug.OriginalContent, sug.TranslatedContent}, true
+	case feedbackActionEdit:
+		return []string{sug.EditedContent}, true
+	}
+	return nil, false
+}
+
+// labelSamplesByFeedback 按客服反馈标注样本，不依赖任何相似度算法：
+// 被采用的候选的发送文本与消息完全一致时，标注为该候选（多个时取最新的）；
+// 候选都没有被采用，或被采用的候选已与其他消息完全一致时，标注为不关联；
+// 有被采用的候选但文本都不一致时无法确定，不参与评估
+func labelSamplesByFeedback(samples []evaluationSample) []evaluationSample {
+	exact := make([]string, len(samples))
+	matched := make(map[string]bool)
+	for i, sample := range samples {
+		content := strings.TrimSpace(sample.Content)
+	candidates:
+		for _, sug := range sample.Candidates {
+			texts, ok := adoptedText(sug)
+			if !ok {
+				continue
+			}
+			for _, text := range texts {
+				if text != "" && strings.TrimSpace(text) == content {
+					exact[i] = sug.SuggestionID
+					matched[sug.SuggestionID] = true
+					break candidates
+				}
+			}
+		}
+	}
+
+	labeled := make([]evaluationSample, 0, len(samples))
+	for i, sample := range samples {
+		if exact[i] == "" {
+			ambiguous := false
+			for _, sug := range sample.Candidates {
+				if _, ok := adoptedText(sug); ok && !matched[sug.SuggestionID] {
+					ambiguous = true
+					break
+				}
+			}
+			if ambiguous {
+				continue
+			}
+		}
+		sample.Linked = exact[i]
+		labeled = append(labeled, sample)
+	}
+	return labeled
+}
+
+// evaluateSimilarity 按线上关联逻辑回放样本：选相似度最高的候选，达到阈值才关联
+func evaluateSimilarity(samples []evaluationSample, sim Similarity, thresholds []float64) []evaluationResult {
+	type prediction struct {
+		suggestionID string
+		score        float64
+	}
+	predictions := make([]prediction, len(samples))
+	for i, sample := range samples {
+		best := prediction{score: -1}
+		// 候选按创建时间倒序，相似度相同时保留最新的
+		for _, sug := range sample.Candidates {
+			score, _, ok := scoreSuggestion(sim, sug, sample.Content)
+			if ok && score > best.score {
+				best = prediction{suggestionID: sug.SuggestionID, score: score}
+			}
+		}
+		predictions[i] = best
+	}
+
+	results := make([]evaluationResult, 0, len(thresholds))
+	for _, threshold := range thresholds {
+		result := evaluationResult{Algorithm: sim.Name(), Threshold: threshold}
+		for i, sample := range samples {
+			predicted := ""
+			if predictions[i].suggestionID != "" && predictions[i].score >= threshold {
+				predicted = predictions[i].suggestionID
+			}
+			switch {
+			case predicted != "" && predicted == sample.Linked:
+				result.TP++
+			case predicted != "":
+				result.FP++
+				if sample.Linked != "" {
+					result.FN++
+				}
+			case sample.Linked != "":
+				result.FN++
+			}
+		}
+		if result.TP+result.FP > 0 {
+			result.Precision = float64(result.TP) / float64(result.TP+result.FP)
+		}
+		if result.TP+result.FN > 0 {
+			result.Recall = float64(result.TP) / float64(result.TP+result.FN)
+		}
+		if result.Precision+result.Recall > 0 {
+			result.F1 = 2 * result.Precision * result.Recall / (result.Precision + result.Recall)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// parseThresholds 解析逗号分隔的阈值列表
+func parseThresholds(value string) ([]float64, error) {
+	var thresholds []float64
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		t, err := strconv.ParseFloat(part, 64)
+		if err != nil || t < 0 || t > 100 {
+			return nil, fmt.Errorf("无效的阈值: %s", part)
+		}
+		thresholds = append(thresholds, t)
+	}
+	if len(thresholds) == 0 {
+		return nil, fmt.Errorf("缺少阈值")
+	}
+	sort.Float64s(thresholds)
+	return thresholds, nil
+}
+
+// runEvaluateCommand 执行 evaluate 子命令，用历史关联数据评估各相似度算法，返回进程退出码
+// 用法: sidebar-server evaluate [-algorithms cosine,jaccard] [-thresholds 60,70,80] [-days 30] [-limit 5000] [-labels feedback] [-json]
+func runEvaluateCommand(args []string) int {
+	fs := flag.NewFlagSet("evaluate", flag.ContinueOnError)
+	algorithms := fs.String("algorithms", strings.Join(similarityAlgorithmNames(), ","), "要评估的相似度算法（逗号分隔）")
+	thresholdList := fs.String("thresholds", "50,60,70,80,90,95", "要评估的阈值（0-100，逗号分隔）")
+	days := fs.Int("days", 30, "评估最近多少天的客服消息")
+	limit := fs.Int("limit", 5000, "最多评估的客服消息数")
+	window := fs.Int("window", getEnvInt("SUGGESTION_QUERY_LIMIT", 10)*2, "每条消息比较的候选 suggestion 数，与线上关联一致")
+	labels := fs.String("labels", evaluationLabelsFeedback, "标注来源：feedback（客服反馈，与关联算法无关）或 linker（现有关联，结果偏向当前算法）")
+	asJSON := fs.Bool("json", false, "以 JSON 输出")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *labels != evaluationLabelsFeedback && *labels != evaluationLabelsLinker {
+		fmt.Fprintf(os.Stderr, "无效的标注来源: %s\n", *labels)
+		return 2
+	}
+
+	thresholds, err := parseThresholds(*thresholdList)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+	var sims []Similarity
+	for _, name := range strings.Split(*algorithms, ",") {
+		sim, err := similarityByName(strings.TrimSpace(name))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 2
+		}
+		sims = append(sims, sim)
+	}
+
+	if err := openDatabase(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	since := time.Now().AddDate(0, 0, -*days)
+	samples, excluded, err := loadEvaluationSamples(since, *limit, *window, *labels)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	linked := 0
+	for _, sample := range samples {
+		if sample.Linked != "" {
+			linked++
+		}
+	}
+
+	var results []evaluationResult
+	for _, sim := range sims {
+		results = append(results, evaluateSimilarity(samples, sim, thresholds)...)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(map[string]interface{}{
+			"labels":   *labels,
+			"messages": len(samples),
+			"excluded": excluded,
+			"linked":   linked,
+			"results":  results,
+		}); err != nil {
+			fmt.Fprintf(os.Stderr, "输出结果失败: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Printf("标注来源: %s，客服消息: %d，已关联: %d", *labels, len(samples), linked)
+	if *labels == evaluationLabelsFeedback {
+		fmt.Printf("，无法确定标注未参与评估: %d", excluded)
+	} else {
+		fmt.Print("\n注意: 标注来自当前关联算法写入的 msg_id，结果只反映与现有关联的一致程度")
+	}
+	fmt.Print("\n\n")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "algorithm\tthreshold\tprecision\trecall\tf1\ttp\tfp\tfn\t")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%.0f\t%.3f\t%.3f\t%.3f\t%d\t%d\t%d\t\n",
+			r.Algorithm, r.Threshold, r.Precision, r.Recall, r.F1, r.TP, r.FP, r.FN)
+	}
+	w.Flush()
+	return 0
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadEvaluationSamplesFiltersByAgent(t *testing.T) {
+	newTestSQLiteStore(t)
+
+	now := time.Now()
+	for _, sug := range []Suggestion{
+		{SuggestionID: "s1", AgentID: "a1", ChatID: "c1", OriginalContent: "您好，已为您退款", Action: feedbackActionUse, CreatedAt: now.Add(-3 * time.Minute)},
+		{SuggestionID: "s2", AgentID: "a2", ChatID: "c1", OriginalContent: "您好，已为您退款", Action: feedbackActionUse, CreatedAt: now.Add(-2 * time.Minute)},
+	} {
+		if err := suggestionStore.CreateSuggestion(sug); err != nil {
+			t.Fatalf("CreateSuggestion: %v", err)
+		}
+	}
+	recordChatMessage("c1", ChatHistoryEntry{MsgID: "m1", Role: roleAgent, AgentID: "a1", Content: "您好，已为您退款", Time: now.Add(-time.Minute)})
+	// 早期记录的消息没有 agent_id
+	recordChatMessage("c1", ChatHistoryEntry{MsgID: "m2", Role: roleAgent, Content: "请稍等", Time: now})
+
+	samples, _, err := loadEvaluationSamples(now.Add(-time.Hour), 100, 10, evaluationLabelsLinker)
+	if err != nil {
+		t.Fatalf("loadEvaluationSamples: %v", err)
+	}
+	candidates := make(map[string][]string)
+	for _, sample := range samples {
+		for _, sug := range sample.Candidates {
+			candidates[sample.Content] = append(candidates[sample.Content], sug.SuggestionID)
+		}
+	}
+	if got := candidates["您好，已为您退款"]; !equalStrings(got, []string{"s1"}) {
+		t.Errorf("候选 = %v, 只应包含发送消息的客服的 suggestion", got)
+	}
+	if got := candidates["请稍等"]; !equalStrings(got, []string{"s2", "s1"}) {
+		t.Errorf("候选 = %v, 没有 agent_id 的消息不按客服过滤", got)
+	}
+}
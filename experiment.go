@@ -0,0 +1,544 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 实验分组的单位
+const (
+	experimentAssignByChat  = "chat"  // 按会话分组，同一会话始终命中同一变体
+	experimentAssignByAgent = "agent" // 按客服分组
+)
+
+// ExperimentVariant 实验变体，未配置的字段使用默认值
+type ExperimentVariant struct {
+	Name             string `json:"name"`
+	Weight           int    `json:"weight"`                      // 流量权重，默认 1
+	AgentURL         string `json:"agent_url,omitempty"`         // Agent API 地址（后端）
+	AgentID          string `json:"agent_id,omitempty"`          // AgentInfo.AgentID / CustomID
+	PublishedVersion string `json:"published_version,omitempty"` // AgentInfo.PublishedVersion
+	Prompt           string `json:"prompt,omitempty"`            // 附加给 Agent 的提示词
+}
+
+// Experiment experiments 表模型，A/B 实验
+type Experiment struct {
+	ID           uint                `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name         string              `gorm:"type:varchar(100);uniqueIndex;not null" json:"name"`
+	Description  string              `gorm:"type:text" json:"description"`
+	AssignBy     string              `gorm:"type:varchar(20);not null" json:"assign_by"` // chat, agent
+	VariantsJSON string              `gorm:"column:variants;type:text" json:"-"`
+	Variants     []ExperimentVariant `gorm:"-" json:"variants"`
+	Enabled      bool                `gorm:"index" json:"enabled"`
+	CreatedAt    time.Time           `json:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Experiment) TableName() string {
+	return "experiments"
+}
+
+// BeforeSave 序列化变体配置
+func (e *Experiment) BeforeSave(tx *gorm.DB) error {
+	data, err := json.Marshal(e.Variants)
+	if err != nil {
+		return fmt.Errorf("序列化实验变体失败: %w", err)
+	}
+	e.VariantsJSON = string(data)
+	return nil
+}
+
+// AfterFind 解析变体配置
+func (e *Experiment) AfterFind(tx *gorm.DB) error {
+	if e.VariantsJSON == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(e.VariantsJSON), &e.Variants); err != nil {
+		return fmt.Errorf("解析实验变体失败: %w", err)
+	}
+	return nil
+}
+
+// validateExperiment 校验实验配置
+func validateExperiment(e *Experiment) error {
+	if e.Name == "" {
+		return fmt.Errorf("name 不能为空")
+	}
+	if e.AssignBy == "" {
+		e.AssignBy = experimentAssignByChat
+	}
+	if e.AssignBy != experimentAssignByChat && e.AssignBy != experimentAssignByAgent {
+		return fmt.Errorf("无效的 assign_by: %s", e.AssignBy)
+	}
+	if len(e.Variants) < 2 {
+		return fmt.Errorf("至少需要两个变体")
+	}
+	seen := make(map[string]bool)
+	for i := range e.Variants {
+		v := &e.Variants[i]
+		if v.Name == "" {
+			return fmt.Errorf("变体 name 不能为空")
+		}
+		if seen[v.Name] {
+			return fmt.Errorf("变体 name 重复: %s", v.Name)
+		}
+		seen[v.Name] = true
+		if v.Weight == 0 {
+			v.Weight = 1
+		}
+		if v.Weight < 0 {
+			return fmt.Errorf("变体 %s 的 weight 不能为负数", v.Name)
+		}
+	}
+	return nil
+}
+
+// pickVariant 根据实验名称和分组单位的哈希确定性地选择变体
+func (e Experiment) pickVariant(unitID string) ExperimentVariant {
+	total := 0
+	for _, v := range e.Variants {
+		total += v.Weight
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(e.Name + ":" + unitID))
+	bucket := int(h.Sum32() % uint32(total))
+	for _, v := range e.Variants {
+		if bucket < v.Weight {
+			return v
+		}
+		bucket -= v.Weight
+	}
+	return e.Variants[len(e.Variants)-1]
+}
+
+// experimentAssignment 请求命中的实验变体
+type experimentAssignment struct {
+	Experiment string
+	Variant    ExperimentVariant
+}
+
+// apply 将变体配置应用到 Agent 调用
+func (a *experimentAssignment) apply(call *agentCallRequest) {
+	if a == nil {
+		return
+	}
+
+	agent := defaultAgentInfo()
+	if call.Agent != nil {
+		agent = *call.Agent
+	}
+	if a.Variant.AgentID != "" {
+		agent.AgentID = a.Variant.AgentID
+		agent.CustomID = a.Variant.AgentID
+	}
+	if a.Variant.PublishedVersion != "" {
+		agent.PublishedVersion = a.Variant.PublishedVersion
+	}
+	call.Agent = &agent
+
+	if a.Variant.AgentURL != "" {
+		call.AgentURL = a.Variant.AgentURL
+	}
+	if a.Variant.Prompt != "" {
+		call.Contents = append(call.Contents, AgentCallContent{Type: "prompt", Content: a.Variant.Prompt})
+	}
+}
+
+// ExperimentStore 缓存启用中的实验，变更时失效
+type ExperimentStore struct {
+	mu      sync.RWMutex
+	loaded  bool
+	version uint64
+	active  *Experiment
+}
+
+var experiments = &ExperimentStore{}
+
+// Invalidate 使缓存失效
+func (s *ExperimentStore) Invalidate() {
+	s.mu.Lock()
+	s.loaded = false
+	s.version++
+	s.mu.Unlock()
+}
+
+// Active 获取当前启用的实验，同时启用多个时使用最新创建的
+func (s *ExperimentStore) Active() *Experiment {
+	if db == nil {
+		return nil
+	}
+
+	s.mu.RLock()
+	if s.loaded {
+		active := s.active
+		s.mu.RUnlock()
+		return active
+	}
+	version := s.version
+	s.mu.RUnlock()
+
+	var list []Experiment
+	if err := db.Where("enabled = ?", true).Order("id DESC").Limit(1).Find(&list).Error; err != nil {
+		logger.Warn("加载实验配置失败", zap.Error(err))
+		return nil
+	}
+	var active *Experiment
+	if len(list) > 0 {
+		active = &list[0]
+	}
+
+	s.mu.Lock()
+	s.active = active
+	s.loaded = s.version == version
+	s.mu.Unlock()
+	return active
+}
+
+// assignExperiment 为请求分配实验变体，没有启用的实验时返回 nil
+func assignExperiment(agentID, chatID string) *experimentAssignment {
+	exp := experiments.Active()
+	if exp == nil || len(exp.Variants) == 0 {
+		return nil
+	}
+
+	unitID := chatID
+	if exp.AssignBy == experimentAssignByAgent {
+		unitID = agentID
+	}
+	return &experimentAssignment{
+		Experiment: exp.Name,
+		Variant:    exp.pickVariant(unitID),
+	}
+}
+
+// defaultPublishedVersion 默认 Agent 的发布版本
+func defaultPublishedVersion() string {
+	if version := os.Getenv("AGENT_PUBLISHED_VERSION"); version != "" {
+		return version
+	}
+	return "1.0.0"
+}
+
+// ExperimentsHandler 实验列表和创建
+// GET /api/experiments, POST /api/experiments
+func ExperimentsHandler(w http.ResponseWriter, r *http.Request) {
+	if db == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "数据库未初始化")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var list []Experiment
+		if err := db.Order("id DESC").Find(&list).Error; err != nil {
+			logger.Error("查询实验失败", zap.Error(err))
+			writeJSONError(w, http.StatusInternalServerError, "查询实验失败")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"experiments": list,
+		})
+
+	case http.MethodPost:
+		var exp Experiment
+		if err := json.NewDecoder(r.Body).Decode(&exp); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "无效的请求体")
+			return
+		}
+		if err := validateExperiment(&exp); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		exp.ID = 0
+		if err := db.Create(&exp).Error; err != nil {
+			logger.Error("创建实验失败", zap.Error(err))
+			writeJSONError(w, http.StatusInternalServerError, "创建实验失败")
+			return
+		}
+		experiments.Invalidate()
+		writeJSON(w, http.StatusCreated, exp)
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// ExperimentHandler 单个实验的查询、更新和删除
+// GET/PUT/DELETE /api/experiments/{id}
+// 实验开始后修改变体或权重会改变分组，通常只应修改 enabled
+func ExperimentHandler(w http.ResponseWriter, r *http.Request) {
+	if db == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "数据库未初始化")
+		return
+	}
+
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "无效的实验ID")
+		return
+	}
+
+	var existing Experiment
+	if err := db.First(&existing, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSONError(w, http.StatusNotFound, "实验不存在")
+			return
+		}
+		logger.Error("查询实验失败", zap.Uint64("id", id), zap.Error(err))
+		writeJSONError(w, http.StatusInternalServerError, "查询实验失败")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, existing)
+
+	case http.MethodPut:
+		exp := existing
+		if err := json.NewDecoder(r.Body).Decode(&exp); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "无效的请求体")
+			return
+		}
+		if err := validateExperiment(&exp); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		exp.ID = existing.ID
+		exp.CreatedAt = existing.CreatedAt
+		if err := db.Save(&exp).Error; err != nil {
+			logger.Error("更新实验失败", zap.Uint64("id", id), zap.Error(err))
+			writeJSONError(w, http.StatusInternalServerError, "更新实验失败")
+			return
+		}
+		experiments.Invalidate()
+		writeJSON(w, http.StatusOK, exp)
+
+	case http.MethodDelete:
+		if err := db.Delete(&Experiment{}, id).Error; err != nil {
+			logger.Error("删除实验失败", zap.Uint64("id", id), zap.Error(err))
+			writeJSONError(w, http.StatusInternalServerError, "删除实验失败")
+			return
+		}
+		experiments.Invalidate()
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// confidenceZ 95% 置信区间的 z 值
+const confidenceZ = 1.96
+
+// RateEstimate 比例及其 95% Wilson 置信区间
+type RateEstimate struct {
+	Count int     `json:"count"`
+	Rate  float64 `json:"rate"`
+	Lower float64 `json:"ci_lower"`
+	Upper float64 `json:"ci_upper"`
+}
+
+// wilsonInterval 计算比例的 Wilson 置信区间，样本量较小或比例接近 0/1 时比正态近似更稳定
+func wilsonInterval(count, n int) RateEstimate {
+	estimate := RateEstimate{Count: count}
+	if n == 0 {
+		return estimate
+	}
+	p := float64(count) / float64(n)
+	nf := float64(n)
+	z2 := confidenceZ * confidenceZ
+	center := (p + z2/(2*nf)) / (1 + z2/nf)
+	margin := confidenceZ * math.Sqrt(p*(1-p)/nf+z2/(4*nf*nf)) / (1 + z2/nf)
+	estimate.Rate = p
+	estimate.Lower = math.Max(0, center-margin)
+	estimate.Upper = math.Min(1, center+margin)
+	return estimate
+}
+
+// MeanEstimate 均值及其 95% 置信区间（正态近似）
+type MeanEstimate struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+	Lower float64 `json:"ci_lower"`
+	Upper float64 `json:"ci_upper"`
+}
+
+// meanInterval 根据样本数、和与平方和计算均值的置信区间
+func meanInterval(n int, sum, sumSquares float64) MeanEstimate {
+	estimate := MeanEstimate{Count: n}
+	if n == 0 {
+		return estimate
+	}
+	nf := float64(n)
+	mean := sum / nf
+	estimate.Mean, estimate.Lower, estimate.Upper = mean, mean, mean
+	if n > 1 {
+		variance := math.Max(0, (sumSquares-nf*mean*mean)/(nf-1))
+		margin := confidenceZ * math.Sqrt(variance/nf)
+		estimate.Lower, estimate.Upper = mean-margin, mean+margin
+	}
+	return estimate
+}
+
+// DiffEstimate 与对照组的差值及其 95% 置信区间
+type DiffEstimate struct {
+	Diff  float64 `json:"diff"`
+	Lower float64 `json:"ci_lower"`
+	Upper float64 `json:"ci_upper"`
+}
+
+// rateDiff 计算两个比例之差的置信区间（正态近似）
+func rateDiff(a, b RateEstimate, na, nb int) *DiffEstimate {
+	if na == 0 || nb == 0 {
+		return nil
+	}
+	diff := a.Rate - b.Rate
+	margin := confidenceZ * math.Sqrt(a.Rate*(1-a.Rate)/float64(na)+b.Rate*(1-b.Rate)/float64(nb))
+	return &DiffEstimate{Diff: diff, Lower: diff - margin, Upper: diff + margin}
+}
+
+// VariantReport 单个变体的效果统计
+type VariantReport struct {
+	Variant     string        `json:"variant"`
+	Suggestions int           `json:"suggestions"` // 生成的建议数
+	Decisions   int           `json:"decisions"`   // 有反馈（使用、编辑、拒绝）的建议数，作为比例的分母
+	Use         RateEstimate  `json:"use"`
+	Edit        RateEstimate  `json:"edit"`
+	Reject      RateEstimate  `json:"reject"`
+	Similarity  MeanEstimate  `json:"similarity"`            // 已关联消息的建议与实际发送内容的相似率
+	UseDiff     *DiffEstimate `json:"use_diff,omitempty"`    // 使用率与对照组（第一个变体）之差
+	RejectDiff  *DiffEstimate `json:"reject_diff,omitempty"` // 拒绝率与对照组之差
+}
+
+// buildExperimentReport 统计实验各变体的使用、编辑、拒绝率和相似率
+func buildExperimentReport(exp Experiment) ([]VariantReport, error) {
+	var actionRows []struct {
+		Variant string
+		Action  string
+		Count   int
+	}
+	err := db.Model(&Suggestion{}).
+		Select("variant, action, COUNT(*) AS count").
+		Where("experiment = ?", exp.Name).
+		Group("variant, action").
+		Scan(&actionRows).Error
+	if err != nil {
+		return nil, fmt.Errorf("统计建议反馈失败: %w", err)
+	}
+
+	var similarityRows []struct {
+		Variant    string
+		Count      int
+		Sum        float64
+		SumSquares float64
+	}
+	err = db.Model(&Suggestion{}).
+		Select("variant, COUNT(*) AS count, SUM(similarity) AS sum, SUM(similarity * similarity) AS sum_squares").
+		Where("experiment = ? AND msg_id <> ''", exp.Name).
+		Group("variant").
+		Scan(&similarityRows).Error
+	if err != nil {
+		return nil, fmt.Errorf("统计相似率失败: %w", err)
+	}
+
+	type counts struct{ total, use, edit, reject int }
+	byVariant := make(map[string]*counts)
+	for _, v := range exp.Variants {
+		byVariant[v.Name] = &counts{}
+	}
+	for _, row := range actionRows {
+		c, ok := byVariant[row.Variant]
+		if !ok {
+			continue // 已从实验中移除的变体
+		}
+		c.total += row.Count
+		switch normalizeFeedbackAction(row.Action) {
+		case feedbackActionUse:
+			c.use += row.Count
+		case feedbackActionEdit:
+			c.edit += row.Count
+		case feedbackActionReject:
+			c.reject += row.Count
+		}
+	}
+
+	reports := make([]VariantReport, 0, len(exp.Variants))
+	for _, v := range exp.Variants {
+		c := byVariant[v.Name]
+		decisions := c.use + c.edit + c.reject
+		report := VariantReport{
+			Variant:     v.Name,
+			Suggestions: c.total,
+			Decisions:   decisions,
+			Use:         wilsonInterval(c.use, decisions),
+			Edit:        wilsonInterval(c.edit, decisions),
+			Reject:      wilsonInterval(c.reject, decisions),
+		}
+		for _, row := range similarityRows {
+			if row.Variant == v.Name {
+				report.Similarity = meanInterval(row.Count, row.Sum, row.SumSquares)
+			}
+		}
+		if len(reports) > 0 {
+			control := reports[0]
+			report.UseDiff = rateDiff(report.Use, control.Use, decisions, control.Decisions)
+			report.RejectDiff = rateDiff(report.Reject, control.Reject, decisions, control.Decisions)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// ExperimentReportHandler 实验报告
+// GET /api/experiments/{id}/report
+func ExperimentReportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if db == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "数据库未初始化")
+		return
+	}
+
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "无效的实验ID")
+		return
+	}
+
+	var exp Experiment
+	if err := db.First(&exp, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSONError(w, http.StatusNotFound, "实验不存在")
+			return
+		}
+		logger.Error("查询实验失败", zap.Uint64("id", id), zap.Error(err))
+		writeJSONError(w, http.StatusInternalServerError, "查询实验失败")
+		return
+	}
+
+	reports, err := buildExperimentReport(exp)
+	if err != nil {
+		logger.Error("生成实验报告失败", zap.Uint64("id", id), zap.Error(err))
+		writeJSONError(w, http.StatusInternalServerError, "生成实验报告失败")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"experiment": exp,
+		"variants":   reports,
+	})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestValidateExperimentDefaults(t *testing.T) {
+	exp := Experiment{Name: "prompt-v2", Variants: []ExperimentVariant{{Name: "control"}, {Name: "treatment", Weight: 3}}}
+	if err := validateExperiment(&exp); err != nil {
+		t.Fatalf("validateExperiment: %v", err)
+	}
+	if exp.AssignBy != experimentAssignByChat {
+		t.Errorf("AssignBy = %q, 默认应按会话分组", exp.AssignBy)
+	}
+	if exp.Variants[0].Weight != 1 || exp.Variants[1].Weight != 3 {
+		t.Errorf("Weights = %d, %d, 未配置的权重默认为 1", exp.Variants[0].Weight, exp.Variants[1].Weight)
+	}
+
+	invalid := []Experiment{
+		{Variants: []ExperimentVariant{{Name: "a"}, {Name: "b"}}},
+		{Name: "x", AssignBy: "user", Variants: []ExperimentVariant{{Name: "a"}, {Name: "b"}}},
+		{Name: "x", Variants: []ExperimentVariant{{Name: "a"}}},
+		{Name: "x", Variants: []ExperimentVariant{{Name: "a"}, {Name: "a"}}},
+		{Name: "x", Variants: []ExperimentVariant{{Name: "a"}, {Name: "b", Weight: -1}}},
+	}
+	for i := range invalid {
+		if err := validateExperiment(&invalid[i]); err == nil {
+			t.Errorf("validateExperiment(%+v) 应返回错误", invalid[i])
+		}
+	}
+}
+
+func TestPickVariantDeterministicAndWeighted(t *testing.T) {
+	exp := Experiment{Name: "prompt-v2", Variants: []ExperimentVariant{{Name: "control", Weight: 1}, {Name: "treatment", Weight: 3}}}
+
+	if a, b := exp.pickVariant("chat-1"), exp.pickVariant("chat-1"); a.Name != b.Name {
+		t.Errorf("同一分组单位应始终命中同一变体: %s, %s", a.Name, b.Name)
+	}
+
+	counts := make(map[string]int)
+	const units = 4000
+	for i := 0; i < units; i++ {
+		counts[exp.pickVariant("chat-"+strconv.Itoa(i)).Name]++
+	}
+	share := float64(counts["treatment"]) / units
+	if math.Abs(share-0.75) > 0.05 {
+		t.Errorf("treatment 占比 %.3f, 期望约 0.75（%v）", share, counts)
+	}
+}
+
+func TestExperimentAssignmentApply(t *testing.T) {
+	assignment := &experimentAssignment{
+		Experiment: "prompt-v2",
+		Variant:    ExperimentVariant{Name: "treatment", AgentURL: "http://agent-b", AgentID: "agent-b", PublishedVersion: "v2", Prompt: "简洁回答"},
+	}
+	call := agentCallRequest{}
+	assignment.apply(&call)
+
+	if call.AgentURL != "http://agent-b" || call.Agent == nil || call.Agent.AgentID != "agent-b" || call.Agent.CustomID != "agent-b" || call.Agent.PublishedVersion != "v2" {
+		t.Errorf("apply 后的调用 = %+v, Agent = %+v", call, call.Agent)
+	}
+	if len(call.Contents) != 1 || call.Contents[0].Type != "prompt" {
+		t.Errorf("Contents = %+v, 应附加提示词", call.Contents)
+	}
+
+	var none *experimentAssignment
+	untouched := agentCallRequest{AgentURL: "http://agent-a"}
+	none.apply(&untouched)
+	if untouched.AgentURL != "http://agent-a" || untouched.Agent != nil {
+		t.Error("未命中实验时不应修改调用")
+	}
+}
+
+func TestWilsonInterval(t *testing.T) {
+	tests := []struct {
+		count, n     int
+		lower, upper float64
+	}{
+		{5, 10, 0.2366, 0.7634},
+		{0, 10, 0, 0.2775},
+		{10, 10, 0.7225, 1},
+		{80, 100, 0.7112, 0.8666},
+	}
+	for _, tt := range tests {
+		got := wilsonInterval(tt.count, tt.n)
+		if math.Abs(got.Lower-tt.lower) > 1e-3 || math.Abs(got.Upper-tt.upper) > 1e-3 {
+			t.Errorf("wilsonInterval(%d, %d) = [%.4f, %.4f], want [%.4f, %.4f]", tt.count, tt.n, got.Lower, got.Upper, tt.lower, tt.upper)
+		}
+		if got.Rate != float64(tt.count)/float64(tt.n) {
+			t.Errorf("wilsonInterval(%d, %d).Rate = %v", tt.count, tt.n, got.Rate)
+		}
+	}
+
+	if got := wilsonInterval(0, 0); got.Rate != 0 || got.Lower != 0 || got.Upper != 0 {
+		t.Errorf("wilsonInterval(0, 0) = %+v, 样本为空时应为 0", got)
+	}
+}
+
+func TestMeanInterval(t *testing.T) {
+	// 样本 1, 2, 3：均值 2，样本方差 1
+	got := meanInterval(3, 6, 14)
+	margin := confidenceZ * math.Sqrt(1.0/3)
+	if got.Mean != 2 || math.Abs(got.Lower-(2-margin)) > 1e-9 || math.Abs(got.Upper-(2+margin)) > 1e-9 {
+		t.Errorf("meanInterval = %+v", got)
+	}
+
+	if got := meanInterval(1, 0.5, 0.25); got.Lower != 0.5 || got.Upper != 0.5 {
+		t.Errorf("单个样本时区间应退化为均值: %+v", got)
+	}
+}
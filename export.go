@@ -0,0 +1,515 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// exportBatchSize 导出时每批读取的 suggestion 数
+const exportBatchSize = 500
+
+// 最终发送内容的来源
+const (
+	finalSourceEdited     = "edited"     // 侧边栏上报的编辑后内容
+	finalSourceMessage    = "message"    // 关联到的客服消息
+	finalSourceOriginal   = "original"   // 直接使用或自动回复，与 AI 原文相同
+	finalSourceTranslated = "translated" // 双语模式下直接使用或自动回复，为回译为客户语言的建议
+)
+
+// exportFilter 训练数据导出的筛选条件
+type exportFilter struct {
+	Since         time.Time // 为零值时不限制
+	Until         time.Time // 为零值时不限制
+	AfterID       uint      // 从该 suggestion 记录ID之后开始，用于断点续传
+	Limit         int       // 最多导出的记录数，0 表示不限制
+	Actions       []string  // 只导出这些反馈动作（已归一化），为空时不限制
+	MinSimilarity float64   // 已关联消息的建议的最低相似率（0-100）
+	MinConfidence float64   // 最低置信度（0-1）
+	ContextSize   int       // 每条记录附带的会话消息数
+}
+
+// exportMessage 会话上下文中的一条消息
+type exportMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// TrainingRecord 一条训练数据，文本均已脱敏
+type TrainingRecord struct {
+	ID               uint            `json:"id"` // suggestions 表记录ID，按升序输出，可作为断点续传的 after_id
+	SuggestionID     string          `json:"suggestion_id"`
+	CreatedAt        time.Time       `json:"created_at"`
+	AgentID          string          `json:"agent_id"`
+	ChatHash         string          `json:"chat_hash"` // 会话ID的哈希，不导出客户的外部联系人ID
+	Context          []exportMessage `json:"context"`   // 生成建议前的会话消息，按时间顺序
+	Question         string          `json:"question,omitempty"`
+	Original         string          `json:"original"`     // AI 原始建议
+	Final            string          `json:"final"`        // 客服最终发送的内容
+	FinalSource      string          `json:"final_source"` // edited, message, original, translated
+	Action           string          `json:"action"`
+	Similarity       float64         `json:"similarity"`
+	Confidence       float64         `json:"confidence"`
+	Intent           string          `json:"intent,omitempty"`
+	Language         string          `json:"language,omitempty"`
+	ComplianceStatus string          `json:"compliance_status,omitempty"`
+	Experiment       string          `json:"experiment,omitempty"`
+	Variant          string          `json:"variant,omitempty"`
+	CacheHit         bool            `json:"cache_hit"`
+}
+
+// chatHash 会话ID的短哈希，同一会话的记录哈希相同
+func chatHash(chatID string) string {
+	sum := sha256.Sum256([]byte(chatID))
+	return hex.EncodeToString(sum[:8])
+}
+
+// exportQuery 根据筛选条件构造 afterID 之后的 suggestions 查询，按记录ID升序保证输出稳定
+func exportQuery(filter exportFilter, afterID uint) *gorm.DB {
+	query := db.Model(&Suggestion{}).
+		Where("id > ?", afterID).
+		Where("compliance_status IS NULL OR compliance_status <> ?", complianceStatusBlocked).
+		Where("original_content <> ''")
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+	if filter.MinConfidence > 0 {
+		query = query.Where("confidence >= ?", filter.MinConfidence)
+	}
+	if filter.MinSimilarity > 0 {
+		// 只有关联到消息的建议才有相似率，未关联但直接使用的建议不受限制
+		query = query.Where("msg_id = '' OR msg_id IS NULL OR similarity >= ?", filter.MinSimilarity)
+	}
+	return query.Order("id ASC")
+}
+
+// buildTrainingRecord 构造一条训练数据，没有可用的最终发送内容时返回 false
+// 同一条记录中的上下文、原文和最终内容使用同一个脱敏器，同一敏感值对应同一占位符
+func buildTrainingRecord(sug Suggestion, linked map[string]string, transcript []ChatMessage) (TrainingRecord, bool) {
+	action := normalizeFeedbackAction(sug.Action)
+
+	var final, source string
+	switch {
+	case action == feedbackActionEdit && sug.EditedContent != "":
+		final, source = sug.EditedContent, finalSourceEdited
+	case sug.MsgID != "" && linked[sug.MsgID] != "":
+		final, source = linked[sug.MsgID], finalSourceMessage
+	case (action == feedbackActionUse || action == feedbackActionAuto) && sug.Language != "" && sug.TranslatedContent != "":
+		// 双语模式下客服发送的是回译后的文本
+		final, source = sug.TranslatedContent, finalSourceTranslated
+	case action == feedbackActionUse || action == feedbackActionAuto:
+		final, source = sug.OriginalContent, finalSourceOriginal
+	default:
+		return TrainingRecord{}, false
+	}
+
+	redactor := newStrictPIIRedactor()
+	record := TrainingRecord{
+		ID:               sug.ID,
+		SuggestionID:     sug.SuggestionID,
+		CreatedAt:        sug.CreatedAt,
+		AgentID:          sug.AgentID,
+		ChatHash:         chatHash(sug.ChatID),
+		Context:          make([]exportMessage, 0, len(transcript)),
+		Action:           action,
+		Similarity:       sug.Similarity,
+		Confidence:       sug.Confidence,
+		Intent:           sug.Intent,
+		Language:         sug.Language,
+		ComplianceStatus: sug.ComplianceStatus,
+		Experiment:       sug.Experiment,
+		Variant:          sug.Variant,
+		CacheHit:         sug.CacheEntryID != 0,
+		FinalSource:      source,
+	}
+	for _, m := range transcript {
+		record.Context = append(record.Context, exportMessage{Role: m.Role, Content: redactor.Redact(m.Content)})
+	}
+	record.Question = redactor.Redact(sug.Question)
+	record.Original = redactor.Redact(sug.OriginalContent)
+	record.Final = redactor.Redact(final)
+	return record, true
+}
+
+// loadExportTranscripts 按会话批量读取一批 suggestion 生成前的会话消息（按时间顺序），避免逐条查询
+// 每个会话读取最早的 suggestion 之前的 n 条消息，以及最早与最晚的 suggestion 之间的消息，
+// 再由 transcriptBefore 为每条 suggestion 截取
+func loadExportTranscripts(suggestions []Suggestion, n int) (map[string][]ChatMessage, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	type span struct {
+		first, last time.Time
+	}
+	spans := make(map[string]*span)
+	for _, sug := range suggestions {
+		if sug.ChatID == "" {
+			continue
+		}
+		s, ok := spans[sug.ChatID]
+		if !ok {
+			spans[sug.ChatID] = &span{first: sug.CreatedAt, last: sug.CreatedAt}
+			continue
+		}
+		if sug.CreatedAt.Before(s.first) {
+			s.first = sug.CreatedAt
+		}
+		if sug.CreatedAt.After(s.last) {
+			s.last = sug.CreatedAt
+		}
+	}
+
+	transcripts := make(map[string][]ChatMessage, len(spans))
+	for chatID, s := range spans {
+		var before []ChatMessage
+		if err := db.Where("chat_id = ? AND msg_time <= ?", chatID, s.first).
+			Order("msg_time DESC, id DESC").
+			Limit(n).
+			Find(&before).Error; err != nil {
+			return nil, fmt.Errorf("查询会话消息失败: %w", err)
+		}
+		for i, j := 0, len(before)-1; i < j; i, j = i+1, j-1 {
+			before[i], before[j] = before[j], before[i]
+		}
+
+		var during []ChatMessage
+		if s.last.After(s.first) {
+			if err := db.Where("chat_id = ? AND msg_time > ? AND msg_time <= ?", chatID, s.first, s.last).
+				Order("msg_time ASC, id ASC").
+				Find(&during).Error; err != nil {
+				return nil, fmt.Errorf("查询会话消息失败: %w", err)
+			}
+		}
+		transcripts[chatID] = append(before, during...)
+	}
+	return transcripts, nil
+}
+
+// transcriptBefore 从按时间顺序排列的会话消息中取 before 之前（含）的最近 n 条
+func transcriptBefore(messages []ChatMessage, before time.Time, n int) []ChatMessage {
+	end := sort.Search(len(messages), func(i int) bool {
+		return messages[i].MsgTime.After(before)
+	})
+	return messages[max(0, end-n):end]
+}
+
+// exportTrainingData 按筛选条件以 JSONL 输出训练数据，每批写完后调用 flush
+// 返回导出的记录数和最后一条记录的ID，中断后可用该ID作为 AfterID 继续导出
+func exportTrainingData(ctx context.Context, w io.Writer, filter exportFilter, flush func()) (int, uint, error) {
+	count := 0
+	lastID := filter.AfterID
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return count, lastID, err
+		}
+
+		batch := exportBatchSize
+		if filter.Limit > 0 {
+			batch = min(batch, filter.Limit-count)
+		}
+		var suggestions []Suggestion
+		if err := exportQuery(filter, lastID).Limit(batch).Find(&suggestions).Error; err != nil {
+			return count, lastID, fmt.Errorf("查询 suggestion 失败: %w", err)
+		}
+		if len(suggestions) == 0 {
+			return count, lastID, nil
+		}
+
+		msgIDs := make([]string, 0, len(suggestions))
+		for _, sug := range suggestions {
+			if sug.MsgID != "" {
+				msgIDs = append(msgIDs, sug.MsgID)
+			}
+		}
+		linked := make(map[string]string, len(msgIDs))
+		if len(msgIDs) > 0 {
+			var messages []ChatMessage
+			if err := db.Where("msg_id IN ?", msgIDs).Find(&messages).Error; err != nil {
+				return count, lastID, fmt.Errorf("查询关联消息失败: %w", err)
+			}
+			for _, m := range messages {
+				linked[m.MsgID] = m.Content
+			}
+		}
+
+		selected := make([]Suggestion, 0, len(suggestions))
+		for _, sug := range suggestions {
+			if len(filter.Actions) == 0 || containsString(filter.Actions, normalizeFeedbackAction(sug.Action)) {
+				selected = append(selected, sug)
+			}
+		}
+		transcripts, err := loadExportTranscripts(selected, filter.ContextSize)
+		if err != nil {
+			return count, lastID, err
+		}
+
+		// lastID 只在记录写出或确定跳过后前移，出错时从未完成的记录重新开始
+		for _, sug := range suggestions {
+			if len(filter.Actions) > 0 && !containsString(filter.Actions, normalizeFeedbackAction(sug.Action)) {
+				lastID = sug.ID
+				continue
+			}
+			transcript := transcriptBefore(transcripts[sug.ChatID], sug.CreatedAt, filter.ContextSize)
+			record, ok := buildTrainingRecord(sug, linked, transcript)
+			if ok {
+				if err := encoder.Encode(record); err != nil {
+					return count, lastID, fmt.Errorf("写入导出记录失败: %w", err)
+				}
+				count++
+			}
+			lastID = sug.ID
+		}
+		if flush != nil {
+			flush()
+		}
+
+		if len(suggestions) < batch || (filter.Limit > 0 && count >= filter.Limit) {
+			return count, lastID, nil
+		}
+	}
+}
+
+// containsString 切片中是否包含字符串
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// parseExportActions 解析逗号分隔的反馈动作并归一化
+func parseExportActions(value string) []string {
+	var actions []string
+	for _, action := range strings.Split(value, ",") {
+		if action = strings.TrimSpace(action); action != "" {
+			actions = append(actions, normalizeFeedbackAction(action))
+		}
+	}
+	return actions
+}
+
+// parseExportFilter 根据 HTTP 查询参数构造导出筛选条件
+func parseExportFilter(r *http.Request) (exportFilter, error) {
+	params := r.URL.Query()
+	filter := exportFilter{
+		Actions:     parseExportActions(params.Get("actions")),
+		ContextSize: 10,
+	}
+	if since := params.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return filter, fmt.Errorf("无效的 since: %s", since)
+		}
+		filter.Since = t
+	}
+	if until := params.Get("until"); until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return filter, fmt.Errorf("无效的 until: %s", until)
+		}
+		filter.Until = t
+	}
+	if afterID := params.Get("after_id"); afterID != "" {
+		id, err := strconv.ParseUint(afterID, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("无效的 after_id: %s", afterID)
+		}
+		filter.AfterID = uint(id)
+	}
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return filter, fmt.Errorf("无效的 limit: %s", limit)
+		}
+		filter.Limit = n
+	}
+	if minSimilarity := params.Get("min_similarity"); minSimilarity != "" {
+		f, err := strconv.ParseFloat(minSimilarity, 64)
+		if err != nil {
+			return filter, fmt.Errorf("无效的 min_similarity: %s", minSimilarity)
+		}
+		filter.MinSimilarity = f
+	}
+	if minConfidence := params.Get("min_confidence"); minConfidence != "" {
+		f, err := strconv.ParseFloat(minConfidence, 64)
+		if err != nil {
+			return filter, fmt.Errorf("无效的 min_confidence: %s", minConfidence)
+		}
+		filter.MinConfidence = f
+	}
+	if contextSize := params.Get("context"); contextSize != "" {
+		n, err := strconv.Atoi(contextSize)
+		if err != nil || n < 0 || n > 100 {
+			return filter, fmt.Errorf("无效的 context: %s", contextSize)
+		}
+		filter.ContextSize = n
+	}
+	return filter, nil
+}
+
+// TrainingExportHandler 以 JSONL 流式导出训练数据
+// GET /api/export/training?since=...&until=...&after_id=0&limit=...&actions=use,edit&min_similarity=...&min_confidence=...&context=10
+func TrainingExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if db == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "数据库未初始化")
+		return
+	}
+
+	filter, err := parseExportFilter(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	// 响应头已发送，出错时只能中断输出，客户端用最后一条记录的 id 作为 after_id 续传
+	count, lastID, err := exportTrainingData(r.Context(), w, filter, flush)
+	if err != nil {
+		logger.Warn("导出训练数据中断", zap.Int("count", count), zap.Uint("last_id", lastID), zap.Error(err))
+		return
+	}
+	logger.Info("导出训练数据完成", zap.Int("count", count), zap.Uint("last_id", lastID))
+}
+
+// lastExportedID 读取已有导出文件最后一条记录的ID，文件不存在或为空时返回 0
+func lastExportedID(path string) (uint, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	data = bytes.TrimRight(data, "\n")
+	if len(data) == 0 {
+		return 0, nil
+	}
+	line := data[bytes.LastIndexByte(data, '\n')+1:]
+	var record struct {
+		ID uint `json:"id"`
+	}
+	if err := json.Unmarshal(line, &record); err != nil {
+		return 0, fmt.Errorf("解析最后一条记录失败（文件可能未写完整，请删除最后一行后重试）: %w", err)
+	}
+	return record.ID, nil
+}
+
+// runExportCommand 执行 export 子命令，导出训练数据，返回进程退出码
+// 用法: sidebar-server export [-since 2024-01-01T00:00:00Z] [-until ...] [-out file.jsonl] [-resume] [-after-id N]
+func runExportCommand(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	since := fs.String("since", "", "开始时间（RFC3339）")
+	until := fs.String("until", "", "结束时间（RFC3339，不含）")
+	out := fs.String("out", "", "输出文件，默认输出到标准输出")
+	resume := fs.Bool("resume", false, "从输出文件最后一条记录之后继续导出并追加写入")
+	afterID := fs.Uint("after-id", 0, "从该 suggestion 记录ID之后开始导出")
+	limit := fs.Int("limit", 0, "最多导出的记录数，0 表示不限制")
+	actions := fs.String("actions", "", "只导出这些反馈动作（逗号分隔，如 use,edit）")
+	minSimilarity := fs.Float64("min-similarity", 0, "已关联消息的建议的最低相似率（0-100）")
+	minConfidence := fs.Float64("min-confidence", 0, "最低置信度（0-1）")
+	contextSize := fs.Int("context", 10, "每条记录附带的会话消息数")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	filter := exportFilter{
+		AfterID:       *afterID,
+		Limit:         *limit,
+		Actions:       parseExportActions(*actions),
+		MinSimilarity: *minSimilarity,
+		MinConfidence: *minConfidence,
+		ContextSize:   *contextSize,
+	}
+	for _, t := range []struct {
+		value string
+		dst   *time.Time
+		name  string
+	}{{*since, &filter.Since, "since"}, {*until, &filter.Until, "until"}} {
+		if t.value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, t.value)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "无效的 %s: %s\n", t.name, t.value)
+			return 2
+		}
+		*t.dst = parsed
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if *resume {
+			id, err := lastExportedID(*out)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "读取 %s 失败: %v\n", *out, err)
+				return 1
+			}
+			filter.AfterID = max(filter.AfterID, id)
+			flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		}
+		f, err := os.OpenFile(*out, flags, 0o600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "打开 %s 失败: %v\n", *out, err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	} else if *resume {
+		fmt.Fprintln(os.Stderr, "-resume 需要同时指定 -out")
+		return 2
+	}
+
+	if err := openDatabase(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	buffered := bufio.NewWriter(w)
+	count, lastID, err := exportTrainingData(context.Background(), buffered, filter, func() { buffered.Flush() })
+	if flushErr := buffered.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "导出中断（已导出 %d 条，最后的记录ID %d）: %v\n", count, lastID, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "已导出 %d 条，最后的记录ID %d\n", count, lastID)
+	return 0
+}
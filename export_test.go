@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildTrainingRecordFinal(t *testing.T) {
+	linked := map[string]string{"m1": "已为您退款"}
+	tests := []struct {
+		name       string
+		sug        Suggestion
+		wantFinal  string
+		wantSource string
+		wantOK     bool
+	}{
+		{"编辑后使用", Suggestion{Action: "edited", OriginalContent: "原文", EditedContent: "编辑后"}, "编辑后", finalSourceEdited, true},
+		{"关联到消息", Suggestion{MsgID: "m1", OriginalContent: "原文"}, "已为您退款", finalSourceMessage, true},
+		{"直接使用", Suggestion{Action: feedbackActionUse, OriginalContent: "原文"}, "原文", finalSourceOriginal, true},
+		{"双语模式直接使用", Suggestion{Action: feedbackActionUse, Language: langEnglish, OriginalContent: "已发货", TranslatedContent: "Shipped"}, "Shipped", finalSourceTranslated, true},
+		{"双语模式自动回复", Suggestion{Action: feedbackActionAuto, Language: langEnglish, OriginalContent: "已发货", TranslatedContent: "Shipped"}, "Shipped", finalSourceTranslated, true},
+		{"回译失败时使用原文", Suggestion{Action: feedbackActionUse, Language: langEnglish, OriginalContent: "已发货"}, "已发货", finalSourceOriginal, true},
+		{"拒绝", Suggestion{Action: feedbackActionReject, OriginalContent: "原文"}, "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record, ok := buildTrainingRecord(tt.sug, linked, nil)
+			if ok != tt.wantOK || record.Final != tt.wantFinal || record.FinalSource != tt.wantSource {
+				t.Errorf("buildTrainingRecord = (%q, %q, %v), want (%q, %q, %v)", record.Final, record.FinalSource, ok, tt.wantFinal, tt.wantSource, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestTranscriptBefore(t *testing.T) {
+	base := time.Now()
+	messages := make([]ChatMessage, 5)
+	for i := range messages {
+		messages[i] = ChatMessage{MsgID: string(rune('a' + i)), MsgTime: base.Add(time.Duration(i) * time.Minute)}
+	}
+
+	got := transcriptBefore(messages, base.Add(2*time.Minute), 2)
+	if len(got) != 2 || got[0].MsgID != "b" || got[1].MsgID != "c" {
+		t.Errorf("transcriptBefore = %+v, want b, c", got)
+	}
+	if got := transcriptBefore(messages, base.Add(-time.Minute), 2); len(got) != 0 {
+		t.Errorf("最早的消息之前应没有上下文: %+v", got)
+	}
+}
+
+// exportRecords 导出训练数据，返回解析后的记录和最后一条记录的ID
+func exportRecords(t *testing.T, filter exportFilter) ([]TrainingRecord, uint) {
+	t.Helper()
+	var buf bytes.Buffer
+	_, lastID, err := exportTrainingData(context.Background(), &buf, filter, nil)
+	if err != nil {
+		t.Fatalf("exportTrainingData: %v", err)
+	}
+	var records []TrainingRecord
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record TrainingRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("解析导出记录失败: %v", err)
+		}
+		records = append(records, record)
+	}
+	return records, lastID
+}
+
+func TestExportTrainingDataResume(t *testing.T) {
+	newTestSQLiteStore(t)
+
+	base := time.Now().Add(-time.Hour)
+	recordChatMessage("c1", ChatHistoryEntry{MsgID: "q1", Role: roleCustomer, Content: "怎么退货", Time: base})
+	recordChatMessage("c1", ChatHistoryEntry{MsgID: "q2", Role: roleCustomer, Content: "多久到账", Time: base.Add(2 * time.Minute)})
+	recordChatMessage("c2", ChatHistoryEntry{MsgID: "q3", Role: roleCustomer, Content: "发货了吗", Time: base})
+	for _, sug := range []Suggestion{
+		{SuggestionID: "s1", AgentID: "a1", ChatID: "c1", OriginalContent: "可以在订单页申请退货", Action: feedbackActionUse, CreatedAt: base.Add(time.Minute)},
+		{SuggestionID: "s2", AgentID: "a1", ChatID: "c2", OriginalContent: "已发货", Action: feedbackActionReject, CreatedAt: base.Add(time.Minute)},
+		{SuggestionID: "s3", AgentID: "a1", ChatID: "c1", OriginalContent: "1-3 个工作日到账", Action: feedbackActionUse, CreatedAt: base.Add(3 * time.Minute)},
+		{SuggestionID: "s4", AgentID: "a1", ChatID: "c2", OriginalContent: "今天发货", Action: "edited", EditedContent: "今天下午发货", CreatedAt: base.Add(4 * time.Minute)},
+	} {
+		if err := suggestionStore.CreateSuggestion(sug); err != nil {
+			t.Fatalf("CreateSuggestion: %v", err)
+		}
+	}
+
+	all, _ := exportRecords(t, exportFilter{ContextSize: 10})
+	var allIDs []string
+	for _, r := range all {
+		allIDs = append(allIDs, r.SuggestionID)
+	}
+	if !equalStrings(allIDs, []string{"s1", "s3", "s4"}) {
+		t.Fatalf("导出 = %v, 被拒绝的建议不应导出", allIDs)
+	}
+
+	// 每条建议只带生成前的会话消息
+	if len(all[0].Context) != 1 || all[0].Context[0].Content != "怎么退货" {
+		t.Errorf("s1 context = %+v", all[0].Context)
+	}
+	if len(all[1].Context) != 2 || all[1].Context[1].Content != "多久到账" {
+		t.Errorf("s3 context = %+v", all[1].Context)
+	}
+
+	// 分两次导出，第二次从第一次返回的ID之后继续，结果与一次导出相同
+	first, lastID := exportRecords(t, exportFilter{ContextSize: 10, Limit: 1})
+	if len(first) != 1 || first[0].SuggestionID != "s1" {
+		t.Fatalf("第一次导出 = %+v", first)
+	}
+	rest, _ := exportRecords(t, exportFilter{ContextSize: 10, AfterID: lastID})
+	var resumed []string
+	for _, r := range append(first, rest...) {
+		resumed = append(resumed, r.SuggestionID)
+	}
+	if !equalStrings(resumed, allIDs) {
+		t.Errorf("断点续传导出 = %v, want %v", resumed, allIDs)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm/clause"
+)
+
+// 会话消息角色
+const (
+	roleCustomer = "customer" // 客户发送的消息
+	roleAgent    = "agent"    // 客服发送的消息
+)
+
+// ChatHistoryEntry 会话历史中的一条消息
+type ChatHistoryEntry struct {
+	MsgID   string    `json:"msg_id"`
+	Role    string    `json:"role"`               // customer, agent
+	AgentID string    `json:"agent_id,omitempty"` // 客服消息的发送客服
+	Content string    `json:"content"`
+	Time    time.Time `json:"time"`
+}
+
+// ChatHistory 按 chatId 缓存最近的会话消息，作为 AI 分析的上下文
+type ChatHistory struct {
+	mu         sync.RWMutex
+	chats      map[string][]ChatHistoryEntry // chatID -> 按时间顺序排列的消息
+	lastActive map[string]time.Time          // chatID -> 最近一次追加消息的时间
+}
+
+var chatHistory = &ChatHistory{
+	chats:      make(map[string][]ChatHistoryEntry),
+	lastActive: make(map[string]time.Time),
+}
+
+// chatHistoryLimit 每个会话在内存中保留的最大消息条数（默认 50）
+func chatHistoryLimit() int {
+	return getEnvInt("CHAT_HISTORY_LIMIT", 50)
+}
+
+// chatHistoryIdleTTL 会话无新消息超过该时长后从内存中移除（默认 24 小时）
+func chatHistoryIdleTTL() time.Duration {
+	return getEnvDuration("CHAT_HISTORY_IDLE_TTL", 24*time.Hour)
+}
+
+// Append 追加一条消息，超过上限时丢弃最早的消息
+// 返回消息是否为新消息（未被重复追加）
+func (h *ChatHistory) Append(chatID string, entry ChatHistoryEntry) bool {
+	if chatID == "" || entry.Content == "" {
+		return false
+	}
+
+	limit := chatHistoryLimit()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := h.chats[chatID]
+	// 同一条消息可能被多个客服的轮询重复拉取，按 msgID 去重
+	if entry.MsgID != "" {
+		for _, e := range entries {
+			if e.MsgID == entry.MsgID {
+				return false
+			}
+		}
+	}
+
+	entries = append(entries, entry)
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	h.chats[chatID] = entries
+	h.lastActive[chatID] = time.Now()
+	return true
+}
+
+// cleanup 移除空闲超过 ttl 的会话，避免会话数增长导致内存占用持续增加
+// 数据库可用时会话记录已持久化，摘要等功能从数据库读取，不受影响
+func (h *ChatHistory) cleanup(ttl time.Duration) {
+	cutoff := time.Now().Add(-ttl)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for chatID, active := range h.lastActive {
+		if active.Before(cutoff) {
+			delete(h.chats, chatID)
+			delete(h.lastActive, chatID)
+		}
+	}
+}
+
+// RunCleanup 定期清理空闲的会话
+func (h *ChatHistory) RunCleanup() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		h.cleanup(chatHistoryIdleTTL())
+	}
+}
+
+// Recent 获取会话最近的 n 条消息（按时间顺序）
+func (h *ChatHistory) Recent(chatID string, n int) []ChatHistoryEntry {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	entries := h.chats[chatID]
+	if n > 0 && len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+
+	result := make([]ChatHistoryEntry, len(entries))
+	copy(result, entries)
+	return result
+}
+
+// ChatMessage chat_messages 表模型，持久化的会话消息
+// 内存中的 ChatHistory 只保留最近的消息且重启后丢失，生成会话摘要时从这里读取完整的会话记录
+type ChatMessage struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	ChatID    string    `gorm:"type:varchar(255);uniqueIndex:idx_chat_messages_chat_msg;not null"`
+	MsgID     string    `gorm:"type:varchar(255);uniqueIndex:idx_chat_messages_chat_msg;not null"`
+	Role      string    `gorm:"type:varchar(20)"`
+	AgentID   string    `gorm:"type:varchar(255)"` // 客服消息的发送客服，客户消息和早期记录为空
+	Content   string    `gorm:"type:text"`
+	MsgTime   time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+// TableName 指定表名
+func (ChatMessage) TableName() string {
+	return "chat_messages"
+}
+
+// recordChatMessage 记录一条会话消息：追加到内存历史、持久化到数据库，并使会话摘要失效
+// 返回是否为首次记录的消息；重连后重新拉取的已保存消息返回 false
+func recordChatMessage(chatID string, entry ChatHistoryEntry) bool {
+	if !chatHistory.Append(chatID, entry) {
+		return false
+	}
+
+	if db == nil || entry.MsgID == "" {
+		chatSummaries.Invalidate(chatID)
+		return true
+	}
+	message := ChatMessage{
+		ChatID:  chatID,
+		MsgID:   entry.MsgID,
+		Role:    entry.Role,
+		AgentID: entry.AgentID,
+		Content: entry.Content,
+		MsgTime: entry.Time,
+	}
+	// 多个客服的轮询或重连后的轮询可能拉取到同一条消息，重复时忽略
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&message)
+	if result.Error != nil {
+		logger.Warn("保存会话消息失败", zap.String("chat_id", chatID), zap.String("msg_id", entry.MsgID), zap.Error(result.Error))
+		chatSummaries.Invalidate(chatID)
+		return true
+	}
+	if result.RowsAffected == 0 {
+		return false
+	}
+	chatSummaries.Invalidate(chatID)
+	return true
+}
+
+// loadChatTranscript 获取会话最近的 n 条消息（按时间顺序），数据库可用时从数据库读取
+func loadChatTranscript(chatID string, n int) ([]ChatHistoryEntry, error) {
+	if db == nil {
+		return chatHistory.Recent(chatID, n), nil
+	}
+
+	var messages []ChatMessage
+	if err := db.Where("chat_id = ?", chatID).Order("msg_time DESC, id DESC").Limit(n).Find(&messages).Error; err != nil {
+		return nil, fmt.Errorf("查询会话消息失败: %w", err)
+	}
+
+	entries := make([]ChatHistoryEntry, len(messages))
+	for i, m := range messages {
+		entries[len(messages)-1-i] = ChatHistoryEntry{
+			MsgID:   m.MsgID,
+			Role:    m.Role,
+			AgentID: m.AgentID,
+			Content: m.Content,
+			Time:    m.MsgTime,
+		}
+	}
+	return entries, nil
+}
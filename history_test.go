@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestChatHistory() *ChatHistory {
+	return &ChatHistory{
+		chats:      make(map[string][]ChatHistoryEntry),
+		lastActive: make(map[string]time.Time),
+	}
+}
+
+func TestChatHistoryAppendDeduplicatesAndLimits(t *testing.T) {
+	t.Setenv("CHAT_HISTORY_LIMIT", "2")
+	h := newTestChatHistory()
+
+	if !h.Append("c1", ChatHistoryEntry{MsgID: "m1", Content: "a"}) {
+		t.Fatal("新消息应追加成功")
+	}
+	if h.Append("c1", ChatHistoryEntry{MsgID: "m1", Content: "a"}) {
+		t.Error("重复的 msgID 不应再次追加")
+	}
+	h.Append("c1", ChatHistoryEntry{MsgID: "m2", Content: "b"})
+	h.Append("c1", ChatHistoryEntry{MsgID: "m3", Content: "c"})
+
+	recent := h.Recent("c1", 0)
+	if len(recent) != 2 || recent[0].MsgID != "m2" || recent[1].MsgID != "m3" {
+		t.Errorf("Recent = %+v, 期望只保留最近 2 条", recent)
+	}
+}
+
+func TestChatHistoryCleanupEvictsIdleChats(t *testing.T) {
+	h := newTestChatHistory()
+	h.Append("idle", ChatHistoryEntry{MsgID: "m1", Content: "a"})
+	h.Append("active", ChatHistoryEntry{MsgID: "m2", Content: "b"})
+	h.lastActive["idle"] = time.Now().Add(-2 * time.Hour)
+
+	h.cleanup(time.Hour)
+
+	if len(h.Recent("idle", 0)) != 0 {
+		t.Error("空闲会话应被移除")
+	}
+	if len(h.Recent("active", 0)) != 1 {
+		t.Error("活跃会话不应被移除")
+	}
+	if _, ok := h.lastActive["idle"]; ok {
+		t.Error("空闲会话的活跃时间应一并移除")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// writeJSON 以 JSON 格式返回响应
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		logger.Error("编码响应失败", zap.Error(err))
+	}
+}
+
+// writeJSONError 以 JSON 格式返回错误信息
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": message,
+	})
+}
+
+// withDefaultSince 统计接口未指定 since 时只统计最近 STATS_DEFAULT_WINDOW（默认 7 天）内的数据，避免扫描全表
+// 返回添加了条件的查询和实际的统计起始时间
+func withDefaultSince(query *gorm.DB, r *http.Request) (*gorm.DB, string) {
+	if since := r.URL.Query().Get("since"); since != "" {
+		return query, since
+	}
+	since := time.Now().Add(-getEnvDuration("STATS_DEFAULT_WINDOW", 7*24*time.Hour))
+	return query.Where("created_at >= ?", since), since.Format(time.RFC3339)
+}
+
+// requireAdmin 校验管理接口的访问令牌
+// 要求请求头携带 Authorization: Bearer <ADMIN_API_TOKEN>，未设置 ADMIN_API_TOKEN 时管理接口不可用
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	token := os.Getenv("ADMIN_API_TOKEN")
+	if token == "" {
+		writeJSONError(w, http.StatusServiceUnavailable, "管理接口未启用，请设置 ADMIN_API_TOKEN")
+		return false
+	}
+
+	provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !adminTokenMatches(provided, token) {
+		writeJSONError(w, http.StatusUnauthorized, "未授权")
+		return false
+	}
+	return true
+}
+
+// adminTokenMatches 以常量时间比较访问令牌
+func adminTokenMatches(provided, token string) bool {
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
+
+// adminCORSOrigin 允许跨域访问管理接口的来源，由 ADMIN_CORS_ORIGIN 配置，为空时不允许跨域
+func adminCORSOrigin(r *http.Request) string {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return ""
+	}
+	for _, allowed := range strings.Split(os.Getenv("ADMIN_CORS_ORIGIN"), ",") {
+		if strings.TrimSpace(allowed) == origin {
+			return origin
+		}
+	}
+	return ""
+}
+
+// adminHandler 包装管理接口：为配置的来源设置 CORS 头、处理 OPTIONS 预检请求并校验访问令牌
+func adminHandler(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		if origin := adminCORSOrigin(r); origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		}
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		if !requireAdmin(w, r) {
+			return
+		}
+
+		handler(w, r)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// inflightAIRequest 会话中正在进行的 AI 协助请求
+type inflightAIRequest struct {
+	generation uint64
+	cancel     context.CancelFunc
+}
+
+// beginAIRequest 为会话开始一次新的 AI 协助请求
+// 会取消该会话中仍在进行的旧请求，并通知侧边栏已展示的旧建议被取代。
+// 返回的 ctx 在客户端断开或出现更新的请求时取消，done 用于请求结束时释放资源
+func (c *WeComClient) beginAIRequest(chatID string) (ctx context.Context, generation uint64, done func()) {
+	ctx, cancel := context.WithCancel(c.ctx)
+
+	c.aiMu.Lock()
+	if prev, ok := c.aiRequests[chatID]; ok {
+		prev.cancel()
+		logger.Info("会话有新消息，取消进行中的AI请求",
+			zap.String("agent_id", c.AgentID),
+			zap.String("chat_id", chatID),
+			zap.Uint64("generation", prev.generation))
+	}
+
+	c.aiGeneration++
+	generation = c.aiGeneration
+	c.aiRequests[chatID] = &inflightAIRequest{generation: generation, cancel: cancel}
+
+	// 已展示但未处理的建议基于旧的上下文，通知侧边栏被取代
+	superseded := c.shownSuggestions[chatID]
+	delete(c.shownSuggestions, chatID)
+	for _, suggestionID := range superseded {
+		if err := c.SendMessage(map[string]interface{}{
+			"type":          "suggestion_superseded",
+			"agent_id":      c.AgentID,
+			"chat_id":       chatID,
+			"suggestion_id": suggestionID,
+		}); err != nil {
+			logger.Error("发送 suggestion_superseded 消息失败", zap.String("agent_id", c.AgentID), zap.Error(err))
+		}
+	}
+	c.aiMu.Unlock()
+
+	done = func() {
+		cancel()
+		c.aiMu.Lock()
+		if current, ok := c.aiRequests[chatID]; ok && current.generation == generation {
+			delete(c.aiRequests, chatID)
+		}
+		c.aiMu.Unlock()
+	}
+	return ctx, generation, done
+}
+
+// publishSuggestion 在请求仍是会话最新请求时发送建议给侧边栏并记录为已展示
+// 请求已被取代或已取消时丢弃结果并返回 false
+func (c *WeComClient) publishSuggestion(ctx context.Context, chatID string, generation uint64, suggestionID string, payload map[string]interface{}) (bool, error) {
+	// 在锁内检查并发送，保证 suggestion_superseded 不会先于对应的建议到达侧边栏
+	c.aiMu.Lock()
+	defer c.aiMu.Unlock()
+
+	current, ok := c.aiRequests[chatID]
+	if ctx.Err() != nil || !ok || current.generation != generation {
+		return false, nil
+	}
+
+	if err := c.SendMessage(payload); err != nil {
+		return false, err
+	}
+	c.shownSuggestions[chatID] = append(c.shownSuggestions[chatID], suggestionID)
+	return true, nil
+}
+
+// resolveSuggestion 客服已处理建议（使用、编辑或拒绝）后不再需要通知取代
+func (c *WeComClient) resolveSuggestion(suggestionID string) {
+	c.aiMu.Lock()
+	defer c.aiMu.Unlock()
+
+	for chatID, shown := range c.shownSuggestions {
+		for i, id := range shown {
+			if id != suggestionID {
+				continue
+			}
+			shown = append(shown[:i], shown[i+1:]...)
+			if len(shown) == 0 {
+				delete(c.shownSuggestions, chatID)
+			} else {
+				c.shownSuggestions[chatID] = shown
+			}
+			return
+		}
+	}
+}
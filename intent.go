@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// intentGeneral 未命中任何意图时的默认意图
+const intentGeneral = "general"
+
+// IntentDefinition 意图定义
+type IntentDefinition struct {
+	Name     string     `json:"name"`            // 意图标识，如 refund
+	Label    string     `json:"label"`           // 展示名称，如 退款
+	Keywords []string   `json:"keywords"`        // 关键词（忽略大小写）
+	Patterns []string   `json:"patterns"`        // 正则表达式
+	Agent    *AgentInfo `json:"agent,omitempty"` // 处理该意图的 Agent，未配置时使用默认 Agent
+
+	patterns []*regexp.Regexp
+}
+
+// defaultIntentDefinitions 内置的意图定义，可通过 INTENT_CONFIG_FILE 指定 JSON 文件覆盖
+var defaultIntentDefinitions = []IntentDefinition{
+	{
+		Name:     "refund",
+		Label:    "退款",
+		Keywords: []string{"退款", "退货", "退钱", "退费", "退回", "取消订单"},
+	},
+	{
+		Name:     "logistics",
+		Label:    "物流",
+		Keywords: []string{"物流", "快递", "发货", "到货", "单号", "配送", "签收"},
+		Patterns: []string{`(到|在)哪(了|里)`, `什么时候(能)?(到|发)`},
+	},
+	{
+		Name:     "complaint",
+		Label:    "投诉",
+		Keywords: []string{"投诉", "差评", "骗子", "12315", "举报", "太差", "态度"},
+	},
+	{
+		Name:     "presales",
+		Label:    "售前咨询",
+		Keywords: []string{"多少钱", "价格", "优惠", "有货", "怎么买", "折扣", "活动", "区别"},
+	},
+}
+
+var (
+	intentDefinitionsOnce sync.Once
+	intentDefinitions     []IntentDefinition
+)
+
+// getIntentDefinitions 获取意图定义，首次调用时加载 INTENT_CONFIG_FILE
+func getIntentDefinitions() []IntentDefinition {
+	intentDefinitionsOnce.Do(func() {
+		defs := append([]IntentDefinition(nil), defaultIntentDefinitions...)
+		if path := os.Getenv("INTENT_CONFIG_FILE"); path != "" {
+			loaded, err := loadIntentDefinitions(path)
+			if err != nil {
+				logger.Error("加载意图配置失败，使用内置意图", zap.String("path", path), zap.Error(err))
+			} else {
+				defs = loaded
+			}
+		}
+
+		for i := range defs {
+			defs[i].patterns = nil
+			for _, pattern := range defs[i].Patterns {
+				re, err := regexp.Compile(pattern)
+				if err != nil {
+					logger.Warn("意图正则无法编译，已跳过", zap.String("intent", defs[i].Name), zap.String("pattern", pattern), zap.Error(err))
+					continue
+				}
+				defs[i].patterns = append(defs[i].patterns, re)
+			}
+		}
+		intentDefinitions = defs
+		logger.Info("意图配置已加载", zap.Int("intents", len(defs)))
+	})
+	return intentDefinitions
+}
+
+// loadIntentDefinitions 从 JSON 文件加载意图定义
+func loadIntentDefinitions(path string) ([]IntentDefinition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取意图配置文件失败: %w", err)
+	}
+	var defs []IntentDefinition
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return nil, fmt.Errorf("解析意图配置文件失败: %w", err)
+	}
+	for _, def := range defs {
+		if def.Name == "" {
+			return nil, fmt.Errorf("意图 name 不能为空")
+		}
+	}
+	return defs, nil
+}
+
+// findIntentDefinition 按名称查找意图定义
+func findIntentDefinition(name string) (IntentDefinition, bool) {
+	for _, def := range getIntentDefinitions() {
+		if def.Name == name {
+			return def, true
+		}
+	}
+	return IntentDefinition{}, false
+}
+
+// intentLabel 获取意图的展示名称
+func intentLabel(name string) string {
+	if def, ok := findIntentDefinition(name); ok && def.Label != "" {
+		return def.Label
+	}
+	return name
+}
+
+// IntentResult 意图分类结果
+type IntentResult struct {
+	Intent     string  `json:"intent"`
+	Confidence float64 `json:"confidence"` // 0-1
+	Source     string  `json:"source"`     // keyword, ai
+}
+
+// intentRequest 一次意图分类的参数
+type intentRequest struct {
+	Client   *WeComClient // AI 分类器通过客户端调用 Agent
+	ChatID   string
+	Text     string
+	Redactor *PIIRedactor
+}
+
+// IntentClassifier 意图分类器
+type IntentClassifier interface {
+	Classify(ctx context.Context, req intentRequest) (IntentResult, error)
+}
+
+// keywordIntentClassifier 基于关键词和正则的意图分类器，命中次数最多的意图胜出
+type keywordIntentClassifier struct{}
+
+func (keywordIntentClassifier) Classify(ctx context.Context, req intentRequest) (IntentResult, error) {
+	text := strings.ToLower(req.Text)
+
+	best, bestScore, total := intentGeneral, 0, 0
+	for _, def := range getIntentDefinitions() {
+		score := 0
+		for _, keyword := range def.Keywords {
+			if keyword != "" && strings.Contains(text, strings.ToLower(keyword)) {
+				score++
+			}
+		}
+		for _, re := range def.patterns {
+			if re.MatchString(req.Text) {
+				score++
+			}
+		}
+		total += score
+		if score > bestScore {
+			best, bestScore = def.Name, score
+		}
+	}
+
+	result := IntentResult{Intent: best, Source: "keyword"}
+	if total > 0 {
+		result.Confidence = float64(bestScore) / float64(total)
+	}
+	return result, nil
+}
+
+// aiIntentClassifier 由 Agent 判断意图，调用失败或返回未知意图时退回关键词分类
+type aiIntentClassifier struct {
+	fallback IntentClassifier
+}
+
+func (a aiIntentClassifier) Classify(ctx context.Context, req intentRequest) (IntentResult, error) {
+	result, err := a.classify(ctx, req)
+	if err == nil {
+		return result, nil
+	}
+	if ctx.Err() != nil {
+		return IntentResult{}, err
+	}
+	logger.Warn("AI 意图分类失败，使用关键词分类",
+		zap.String("chat_id", req.ChatID),
+		zap.Error(err))
+	return a.fallback.Classify(ctx, req)
+}
+
+func (a aiIntentClassifier) classify(ctx context.Context, req intentRequest) (IntentResult, error) {
+	candidates := make([]map[string]string, 0, len(getIntentDefinitions())+1)
+	for _, def := range getIntentDefinitions() {
+		candidates = append(candidates, map[string]string{"name": def.Name, "label": def.Label})
+	}
+	candidates = append(candidates, map[string]string{"name": intentGeneral, "label": "其他"})
+
+	agentResp, err := req.Client.callAgentAPI(ctx, agentCallRequest{
+		ChatID:    req.ChatID,
+		EventType: "intent_classification",
+		Contents: []AgentCallContent{
+			{Type: "text", Content: req.Text},
+			{Type: "intents", Content: candidates},
+		},
+		Redactor:  req.Redactor,
+		Stateless: true,
+	})
+	if err != nil {
+		return IntentResult{}, err
+	}
+
+	// 支持 data.intent 或 data["0"].content 为意图名称 / {"intent": ..., "confidence": ...}
+	result := IntentResult{Confidence: 1, Source: "ai"}
+	if intent, ok := agentResp.Data["intent"].(string); ok {
+		result.Intent = intent
+		if confidence, ok := agentResp.Data["confidence"].(float64); ok {
+			result.Confidence = confidence
+		}
+	} else {
+		text := strings.TrimSpace(agentResponseText(agentResp))
+		if err := json.Unmarshal([]byte(text), &result); err != nil {
+			result.Intent = text
+		}
+		result.Source = "ai"
+	}
+
+	if _, ok := findIntentDefinition(result.Intent); !ok && result.Intent != intentGeneral {
+		return IntentResult{}, fmt.Errorf("Agent 返回未知意图: %q", result.Intent)
+	}
+	return result, nil
+}
+
+// getIntentClassifier 根据 INTENT_CLASSIFIER 选择分类器：keyword（默认）或 ai
+func getIntentClassifier() IntentClassifier {
+	if os.Getenv("INTENT_CLASSIFIER") == "ai" {
+		return aiIntentClassifier{fallback: keywordIntentClassifier{}}
+	}
+	return keywordIntentClassifier{}
+}
+
+// ConversationTag conversation_tags 表模型，会话中出现过的意图标签
+type ConversationTag struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	AgentID   string    `gorm:"type:varchar(255);index" json:"agent_id"`
+	ChatID    string    `gorm:"type:varchar(255);uniqueIndex:idx_conversation_tags_chat_intent;not null" json:"chat_id"`
+	Intent    string    `gorm:"type:varchar(50);uniqueIndex:idx_conversation_tags_chat_intent;not null" json:"intent"`
+	Count     int       `gorm:"not null;default:1" json:"count"` // 该意图在会话中出现的次数
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `gorm:"index" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (ConversationTag) TableName() string {
+	return "conversation_tags"
+}
+
+// tagConversation 为会话打上意图标签，已存在时累加次数
+func tagConversation(agentID, chatID, intent string) error {
+	if db == nil {
+		return nil
+	}
+
+	tag := ConversationTag{
+		AgentID: agentID,
+		ChatID:  chatID,
+		Intent:  intent,
+		Count:   1,
+	}
+	err := db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "chat_id"}, {Name: "intent"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"agent_id":   agentID,
+			"count":      gorm.Expr("conversation_tags.count + 1"),
+			"updated_at": time.Now(),
+		}),
+	}).Create(&tag).Error
+	if err != nil {
+		return fmt.Errorf("保存会话标签失败: %w", err)
+	}
+	return nil
+}
+
+// ConversationTagsHandler 查询会话意图标签
+// GET /api/conversation-tags?chat_id=...&intent=...&limit=100
+func ConversationTagsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if db == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "数据库未初始化")
+		return
+	}
+
+	query := db.Model(&ConversationTag{}).Order("updated_at DESC")
+	if chatID := r.URL.Query().Get("chat_id"); chatID != "" {
+		query = query.Where("chat_id = ?", chatID)
+	}
+	if intent := r.URL.Query().Get("intent"); intent != "" {
+		query = query.Where("intent = ?", intent)
+	}
+
+	limit := 100
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 1000 {
+		limit = l
+	}
+
+	var tags []ConversationTag
+	if err := query.Limit(limit).Find(&tags).Error; err != nil {
+		logger.Error("查询会话标签失败", zap.Error(err))
+		writeJSONError(w, http.StatusInternalServerError, "查询会话标签失败")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"tags": tags,
+	})
+}
+
+// classifyIntent 对客户消息进行意图分类，为会话打标签并通知侧边栏
+// 分类失败时返回 general 意图
+func (c *WeComClient) classifyIntent(ctx context.Context, chatID, text string, redactor *PIIRedactor) IntentResult {
+	result, err := getIntentClassifier().Classify(ctx, intentRequest{
+		Client:   c,
+		ChatID:   chatID,
+		Text:     text,
+		Redactor: redactor,
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Warn("意图分类失败", zap.String("agent_id", c.AgentID), zap.String("chat_id", chatID), zap.Error(err))
+		}
+		return IntentResult{Intent: intentGeneral}
+	}
+
+	logger.Info("意图分类完成",
+		zap.String("agent_id", c.AgentID),
+		zap.String("chat_id", chatID),
+		zap.String("intent", result.Intent),
+		zap.Float64("confidence", result.Confidence),
+		zap.String("source", result.Source))
+
+	if result.Intent != intentGeneral {
+		if err := tagConversation(c.AgentID, chatID, result.Intent); err != nil {
+			logger.Warn("保存会话标签失败", zap.String("agent_id", c.AgentID), zap.String("chat_id", chatID), zap.Error(err))
+		}
+	}
+
+	if err := c.SendMessage(map[string]interface{}{
+		"type":         "intent_classified",
+		"agent_id":     c.AgentID,
+		"chat_id":      chatID,
+		"intent":       result.Intent,
+		"intent_label": intentLabel(result.Intent),
+		"confidence":   result.Confidence,
+	}); err != nil {
+		logger.Error("发送 intent_classified 消息失败", zap.String("agent_id", c.AgentID), zap.Error(err))
+	}
+	return result
+}
@@ -4,6 +4,7 @@ class WeComSidebarAssistant {
     this.agentId = null;
     this.chatId = null;
     this.autoAI = false;
+    this.autoReply = false;
     this.websocket = null;
     this.isConnected = false;
     
@@ -381,8 +382,42 @@ class WeComSidebarAssistant {
   handleServerMessage(data) {
     switch (data.type) {
       case 'ai_suggestion':
+        this.hideAIUnavailable();
         this.displayAISuggestion(data);
         break;
+      case 'customer_message_translated':
+        this.displayCustomerTranslation(data);
+        break;
+      case 'chat_summary':
+        this.displayChatSummary(data);
+        break;
+      case 'chat_summary_error':
+        console.error('生成会话摘要失败:', data.error);
+        break;
+      case 'intent_classified':
+        this.showIntent(data);
+        break;
+      case 'ai_suggestion_blocked':
+        this.displayBlockedSuggestion(data);
+        break;
+      case 'ai_unavailable':
+        this.showAIUnavailable(data);
+        break;
+      case 'ai_auto_replied':
+        this.displayAutoReply(data);
+        break;
+      case 'auto_reply_status':
+        this.updateAutoReplyStatus(data.enabled);
+        break;
+      case 'ai_throttled':
+        this.showAIThrottled(data);
+        break;
+      case 'ai_analysis':
+        this.displayAIAnalysis(data);
+        break;
+      case 'suggestion_superseded':
+        this.markSuggestionSuperseded(data.suggestion_id);
+        break;
       case 'customer_message':
         if (this.autoAI) {
           // 自动触发AI分析
@@ -415,7 +450,9 @@ class WeComSidebarAssistant {
         <div class="suggestion-text">
           <strong>🤖 AI建议：</strong>
           <p>${data.text}</p>
-          <small>置信度: ${(data.confidence * 100).toFixed(1)}%</small>
+          ${data.translated_text ? `<p class="translated-text" lang="${data.customer_language}">${data.translated_text}</p>` : ''}
+          <small>置信度: ${(data.confidence * 100).toFixed(1)}%${data.intent_label ? ` · 意图: ${data.intent_label}` : ''}${data.cache_hit ? ' · 常见问题（已采用过的回复）' : ''}</small>
+          ${this.renderComplianceWarnings(data.compliance_warnings)}
         </div>
         <div class="suggestion-actions">
           <button class="action-btn primary" onclick="sideBarAssistant.useSuggestion('${suggestionId}')">
@@ -441,11 +478,198 @@ class WeComSidebarAssistant {
     }
   }
   
+  displayCustomerTranslation(data) {
+    const translationHTML = `
+      <div class="ai-suggestion customer-translation" data-msg-id="${data.msg_id || ''}">
+        <div class="suggestion-text">
+          <strong>🌐 客户消息（${data.customer_language}）：</strong>
+          <p>${data.original}</p>
+          <p class="translated-text">${data.translation}</p>
+        </div>
+      </div>
+    `;
+
+    const container = document.getElementById('suggestionsContainer');
+    container.insertAdjacentHTML('afterbegin', translationHTML);
+  }
+
+  setAutoReply(enabled) {
+    this.sendToServer({
+      type: 'set_auto_reply',
+      agent_id: this.agentId,
+      content: JSON.stringify({ enabled: enabled }),
+      timestamp: Date.now()
+    });
+  }
+
+  updateAutoReplyStatus(enabled) {
+    this.autoReply = enabled;
+    const statusElement = document.getElementById('autoReplyStatus');
+    if (!statusElement) return;
+    statusElement.textContent = enabled ? '开启' : '关闭';
+    statusElement.style.color = enabled ? '#10b981' : '#6b7280';
+  }
+
+  displayAutoReply(data) {
+    // 服务端已直接回复客户，只展示记录，不需要客服操作
+    const autoReplyHTML = `
+      <div class="ai-suggestion auto-replied" data-suggestion-id="${data.suggestion_id}">
+        <div class="suggestion-text">
+          <strong>⚡ 已自动回复：</strong>
+          <p></p>
+          <small>置信度: ${(data.confidence * 100).toFixed(1)}% · 可点击"自动回复"按钮随时关闭</small>
+        </div>
+      </div>
+    `;
+
+    const container = document.getElementById('suggestionsContainer');
+    container.insertAdjacentHTML('afterbegin', autoReplyHTML);
+    container.querySelector(`[data-suggestion-id="${data.suggestion_id}"] .suggestion-text p`).textContent = data.text;
+  }
+
+  requestChatSummary() {
+    this.sendToServer({
+      type: 'summarize_chat',
+      agent_id: this.agentId,
+      chat_id: this.chatId,
+      timestamp: Date.now()
+    });
+  }
+
+  displayChatSummary(data) {
+    const summary = data.summary || {};
+    const promises = (summary.promises || []).map(p => `<li>${p}</li>`).join('');
+    const openItems = (summary.open_items || []).map(i => `<li>${i}</li>`).join('');
+
+    const existing = document.getElementById('chatSummary');
+    if (existing) existing.remove();
+
+    const summaryHTML = `
+      <div class="ai-suggestion ai-summary" id="chatSummary">
+        <div class="suggestion-text">
+          <strong>📝 会话摘要：</strong>
+          <p>客户问题：${summary.customer_issue || '-'}</p>
+          ${promises ? `<p>已承诺：</p><ul>${promises}</ul>` : ''}
+          ${openItems ? `<p>待处理：</p><ul>${openItems}</ul>` : ''}
+          <small>基于 ${summary.message_count} 条消息${data.cached ? '（缓存）' : ''}</small>
+        </div>
+      </div>
+    `;
+
+    const container = document.getElementById('suggestionsContainer');
+    container.insertAdjacentHTML('afterbegin', summaryHTML);
+  }
+
+  showIntent(data) {
+    const container = document.getElementById('suggestionsContainer');
+    if (!container) return;
+
+    let tag = document.getElementById('intentTag');
+    if (!tag) {
+      container.insertAdjacentHTML('beforebegin', '<div id="intentTag" class="intent-tag"></div>');
+      tag = document.getElementById('intentTag');
+    }
+    tag.textContent = `🏷️ 客户意图：${data.intent_label || data.intent}`;
+  }
+
+  renderComplianceWarnings(warnings) {
+    if (!warnings || warnings.length === 0) return '';
+    const items = warnings.map(w => `<li>${w.message || w.rule_name}（${w.match}）</li>`).join('');
+    return `<div class="compliance-warning">⚠️ 合规提示：<ul>${items}</ul></div>`;
+  }
+
+  displayBlockedSuggestion(data) {
+    // 建议未通过合规检查，不展示内容，只提示客服原因
+    const blockedHTML = `
+      <div class="ai-suggestion" data-suggestion-id="${data.suggestion_id}">
+        <div class="suggestion-text">
+          <strong>🚫 AI建议已被合规规则拦截</strong>
+          ${this.renderComplianceWarnings(data.compliance_warnings)}
+        </div>
+      </div>
+    `;
+
+    const container = document.getElementById('suggestionsContainer');
+    container.insertAdjacentHTML('afterbegin', blockedHTML);
+  }
+
+  markSuggestionSuperseded(suggestionId) {
+    const suggestionElement = document.querySelector(`[data-suggestion-id="${suggestionId}"]`);
+    if (!suggestionElement) return;
+
+    // 客户有了新消息，旧建议基于过期的上下文，标记后淡出
+    suggestionElement.style.opacity = '0.5';
+    suggestionElement.querySelector('.suggestion-text small')?.insertAdjacentText('afterend', '（已过期）');
+    setTimeout(() => {
+      suggestionElement.remove();
+    }, 3000);
+  }
+
+  displayAIAnalysis(data) {
+    const hints = (data.next_step_hints || []).map(h => `<li>${h}</li>`).join('');
+    const missing = (data.missing_info || []).map(m => `<li>${m}</li>`).join('');
+
+    const analysisHTML = `
+      <div class="ai-suggestion ai-analysis" data-msg-id="${data.msg_id || ''}">
+        <div class="suggestion-text">
+          <strong>📊 回复分析：</strong>
+          ${hints ? `<p>下一步提示：</p><ul>${hints}</ul>` : ''}
+          ${missing ? `<p>可能缺失的信息：</p><ul>${missing}</ul>` : ''}
+          <small>回复质量: ${data.quality_score}</small>
+        </div>
+      </div>
+    `;
+
+    const container = document.getElementById('suggestionsContainer');
+    container.insertAdjacentHTML('afterbegin', analysisHTML);
+  }
+
+  showAIUnavailable(data) {
+    console.warn('AI建议已暂停:', data.reason, '预计', data.retry_after, '秒后重试');
+    const container = document.getElementById('suggestionsContainer');
+    if (!container || document.getElementById('aiUnavailableNotice')) return;
+
+    container.insertAdjacentHTML('beforebegin', `
+      <div id="aiUnavailableNotice" class="ai-unavailable">
+        ⚠️ AI服务暂不可用，建议已暂停，恢复后将自动继续
+      </div>
+    `);
+  }
+
+  showAIThrottled(data) {
+    console.warn('AI协助请求被限流:', data.scope, '预计', data.retry_after, '秒后重试');
+    const container = document.getElementById('suggestionsContainer');
+    if (!container) return;
+
+    let notice = document.getElementById('aiThrottledNotice');
+    if (!notice) {
+      notice = document.createElement('div');
+      notice.id = 'aiThrottledNotice';
+      notice.className = 'ai-unavailable';
+      container.parentNode.insertBefore(notice, container);
+    }
+    notice.textContent = `⏳ ${data.reason || 'AI协助请求过于频繁'}`;
+
+    // 限流解除后移除提示（每日配额用完时不自动移除）
+    if (data.scope !== 'corp' && data.retry_after > 0) {
+      setTimeout(() => {
+        const notice = document.getElementById('aiThrottledNotice');
+        if (notice) notice.remove();
+      }, data.retry_after * 1000);
+    }
+  }
+
+  hideAIUnavailable() {
+    const notice = document.getElementById('aiUnavailableNotice');
+    if (notice) notice.remove();
+  }
+  
   useSuggestion(suggestionId) {
     const suggestionElement = document.querySelector(`[data-suggestion-id="${suggestionId}"]`);
     if (!suggestionElement) return;
     
-    const textElement = suggestionElement.querySelector('.suggestion-text p');
+    // 双语模式下发送回译为客户语言的文本
+    const textElement = suggestionElement.querySelector('.translated-text') || suggestionElement.querySelector('.suggestion-text p');
     const text = textElement?.textContent || '';
     
     if (text.trim()) {
@@ -477,7 +701,8 @@ class WeComSidebarAssistant {
     const suggestionElement = document.querySelector(`[data-suggestion-id="${suggestionId}"]`);
     if (!suggestionElement) return;
     
-    const textElement = suggestionElement.querySelector('.suggestion-text p');
+    // 双语模式下发送回译为客户语言的文本
+    const textElement = suggestionElement.querySelector('.translated-text') || suggestionElement.querySelector('.suggestion-text p');
     const originalText = textElement?.textContent || '';
     
     // 直接显示编辑输入框（完全替代 prompt）
@@ -805,6 +1030,10 @@ window.requestAIHelp = function() {
   sideBarAssistant.requestAIAssistance("this is test for send into chat");
 };
 
+window.requestChatSummary = function() {
+  sideBarAssistant.requestChatSummary();
+};
+
 window.toggleAutoAI = function() {
   sideBarAssistant.autoAI = !sideBarAssistant.autoAI;
   const statusElement = document.getElementById('autoAIStatus');
@@ -812,6 +1041,11 @@ window.toggleAutoAI = function() {
   statusElement.style.color = sideBarAssistant.autoAI ? '#10b981' : '#6b7280';
 };
 
+// 开启或关闭自动回复，以服务端返回的 auto_reply_status 为准
+window.toggleAutoReply = function() {
+  sideBarAssistant.setAutoReply(!sideBarAssistant.autoReply);
+};
+
 // 设置轮询间隔（全局函数）
 window.setPollInterval = function(interval) {
   sideBarAssistant.setPollInterval(interval);
@@ -0,0 +1,730 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// KnowledgeDocument knowledge_documents 表模型，知识库文档（如一篇 FAQ 或一条问答）
+type KnowledgeDocument struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Title     string    `gorm:"type:varchar(255)" json:"title"`
+	Source    string    `gorm:"type:varchar(50)" json:"source"` // manual, markdown, csv
+	Content   string    `gorm:"type:text" json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (KnowledgeDocument) TableName() string {
+	return "knowledge_documents"
+}
+
+// KnowledgeChunk knowledge_chunks 表模型，文档切分后的检索单元
+type KnowledgeChunk struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	DocumentID uint      `gorm:"index;not null" json:"document_id"`
+	Seq        int       `gorm:"not null" json:"seq"`            // 在文档中的顺序
+	Title      string    `gorm:"type:varchar(255)" json:"title"` // 所属标题（Markdown 标题路径或问答的问题）
+	Content    string    `gorm:"type:text" json:"content"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (KnowledgeChunk) TableName() string {
+	return "knowledge_chunks"
+}
+
+// KnowledgePassage 检索到的知识库片段
+type KnowledgePassage struct {
+	ID         uint    `json:"id"`
+	DocumentID uint    `json:"document_id"`
+	Title      string  `json:"title"`
+	Content    string  `json:"content"`
+	Score      float64 `json:"score"` // 相似度（0-100）
+}
+
+// knowledgeChunkSize 单个片段的最大字符数（默认 500）
+func knowledgeChunkSize() int {
+	return getEnvInt("KNOWLEDGE_CHUNK_SIZE", 500)
+}
+
+// chunkText 将 Markdown 或纯文本切分为片段
+// 按标题分节、按空行分段，段落累积到不超过 maxRunes 为一个片段，
+// 超长段落按句子切分，单句仍超长时按字符数截断
+func chunkText(defaultTitle, content string, maxRunes int) []KnowledgeChunk {
+	var chunks []KnowledgeChunk
+	var headings []string // 当前的标题路径
+	var paragraphs []string
+	var current strings.Builder
+
+	title := func() string {
+		if len(headings) == 0 {
+			return defaultTitle
+		}
+		return strings.Join(headings, " / ")
+	}
+
+	flush := func() {
+		text := strings.TrimSpace(current.String())
+		current.Reset()
+		if text == "" {
+			return
+		}
+		chunks = append(chunks, KnowledgeChunk{
+			Seq:     len(chunks),
+			Title:   title(),
+			Content: text,
+		})
+	}
+
+	addParagraph := func(p string) {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			return
+		}
+		for _, piece := range splitLongText(p, maxRunes) {
+			if current.Len() > 0 && utf8.RuneCountInString(current.String())+utf8.RuneCountInString(piece)+1 > maxRunes {
+				flush()
+			}
+			if current.Len() > 0 {
+				current.WriteString("\n")
+			}
+			current.WriteString(piece)
+		}
+	}
+
+	flushParagraph := func() {
+		addParagraph(strings.Join(paragraphs, "\n"))
+		paragraphs = paragraphs[:0]
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		// Markdown 标题：结束当前片段并更新标题路径
+		if level := markdownHeadingLevel(trimmed); level > 0 {
+			flushParagraph()
+			flush()
+			if level <= len(headings) {
+				headings = headings[:level-1]
+			}
+			for len(headings) < level-1 {
+				headings = append(headings, "")
+			}
+			headings = append(headings, strings.TrimSpace(trimmed[level:]))
+			continue
+		}
+
+		if trimmed == "" {
+			flushParagraph()
+			continue
+		}
+		paragraphs = append(paragraphs, trimmed)
+	}
+	flushParagraph()
+	flush()
+
+	return chunks
+}
+
+// markdownHeadingLevel 返回 Markdown 标题级别，不是标题时返回 0
+func markdownHeadingLevel(line string) int {
+	level := 0
+	for level < len(line) && level < 6 && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level >= len(line) || line[level] != ' ' {
+		return 0
+	}
+	return level
+}
+
+// splitLongText 将超过 maxRunes 的文本按句子切分，单句超长时按字符数截断
+func splitLongText(text string, maxRunes int) []string {
+	if maxRunes <= 0 || utf8.RuneCountInString(text) <= maxRunes {
+		return []string{text}
+	}
+
+	var pieces []string
+	var sentence []rune
+	for _, r := range text {
+		sentence = append(sentence, r)
+		if strings.ContainsRune("。！？!?；;\n", r) || len(sentence) >= maxRunes {
+			pieces = append(pieces, string(sentence))
+			sentence = sentence[:0]
+		}
+	}
+	if len(sentence) > 0 {
+		pieces = append(pieces, string(sentence))
+	}
+
+	// 合并过短的句子
+	var merged []string
+	var current []rune
+	for _, piece := range pieces {
+		runes := []rune(piece)
+		if len(current)+len(runes) > maxRunes && len(current) > 0 {
+			merged = append(merged, strings.TrimSpace(string(current)))
+			current = current[:0]
+		}
+		current = append(current, runes...)
+	}
+	if len(current) > 0 {
+		merged = append(merged, strings.TrimSpace(string(current)))
+	}
+	return merged
+}
+
+// KnowledgeIndex 知识库检索索引
+// 所有片段及其词频向量缓存在内存中，知识库变更后失效并在下次检索时重新加载
+type KnowledgeIndex struct {
+	mu      sync.RWMutex
+	loaded  bool
+	version uint64 // 每次失效递增，避免加载过程中发生的变更被覆盖
+	chunks  []indexedChunk
+}
+
+type indexedChunk struct {
+	chunk KnowledgeChunk
+	words map[string]int
+}
+
+var knowledgeIndex = &KnowledgeIndex{}
+
+// Invalidate 使索引失效
+func (k *KnowledgeIndex) Invalidate() {
+	k.mu.Lock()
+	k.loaded = false
+	k.version++
+	k.chunks = nil
+	k.mu.Unlock()
+}
+
+// load 从数据库加载所有片段
+func (k *KnowledgeIndex) load() error {
+	k.mu.RLock()
+	loaded := k.loaded
+	version := k.version
+	k.mu.RUnlock()
+	if loaded {
+		return nil
+	}
+
+	var chunks []KnowledgeChunk
+	if err := db.Order("document_id, seq").Find(&chunks).Error; err != nil {
+		return fmt.Errorf("加载知识库片段失败: %w", err)
+	}
+
+	indexed := make([]indexedChunk, 0, len(chunks))
+	for _, chunk := range chunks {
+		indexed = append(indexed, indexedChunk{
+			chunk: chunk,
+			words: tokenize(chunk.Title + "\n" + chunk.Content),
+		})
+	}
+
+	k.mu.Lock()
+	k.chunks = indexed
+	// 加载期间知识库发生了变更时，本次结果仍可使用，但下次检索会重新加载
+	k.loaded = k.version == version
+	k.mu.Unlock()
+
+	logger.Info("知识库索引已加载", zap.Int("chunks", len(indexed)))
+	return nil
+}
+
+// Search 检索与查询最相关的 topK 个片段，只返回相似度不低于 minScore 的结果
+func (k *KnowledgeIndex) Search(query string, topK int, minScore float64) ([]KnowledgePassage, error) {
+	if db == nil {
+		return nil, fmt.Errorf("数据库未初始化")
+	}
+	if strings.TrimSpace(query) == "" || topK <= 0 {
+		return nil, nil
+	}
+
+	if err := k.load(); err != nil {
+		return nil, err
+	}
+
+	queryWords := tokenize(query)
+
+	k.mu.RLock()
+	var passages []KnowledgePassage
+	for _, ic := range k.chunks {
+		score := cosineSimilarity(queryWords, ic.words)
+		if score < minScore || score == 0 {
+			continue
+		}
+		passages = append(passages, KnowledgePassage{
+			ID:         ic.chunk.ID,
+			DocumentID: ic.chunk.DocumentID,
+			Title:      ic.chunk.Title,
+			Content:    ic.chunk.Content,
+			Score:      score,
+		})
+	}
+	k.mu.RUnlock()
+
+	sort.Slice(passages, func(i, j int) bool {
+		return passages[i].Score > passages[j].Score
+	})
+	if len(passages) > topK {
+		passages = passages[:topK]
+	}
+	return passages, nil
+}
+
+// searchKnowledgeForAgent 为 Agent 调用检索参考资料，使用 KNOWLEDGE_TOP_K 和 KNOWLEDGE_MIN_SCORE 配置
+func searchKnowledgeForAgent(query string) []KnowledgePassage {
+	if db == nil {
+		return nil
+	}
+
+	passages, err := knowledgeIndex.Search(query, getEnvInt("KNOWLEDGE_TOP_K", 3), getEnvFloat("KNOWLEDGE_MIN_SCORE", 10))
+	if err != nil {
+		logger.Warn("检索知识库失败", zap.Error(err))
+		return nil
+	}
+	return passages
+}
+
+// createKnowledgeDocument 创建知识库文档并切分片段
+func createKnowledgeDocument(doc *KnowledgeDocument) error {
+	if db == nil {
+		return fmt.Errorf("数据库未初始化")
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(doc).Error; err != nil {
+			return fmt.Errorf("创建知识库文档失败: %w", err)
+		}
+		return saveKnowledgeChunks(tx, doc)
+	})
+	if err != nil {
+		return err
+	}
+
+	knowledgeIndex.Invalidate()
+	return nil
+}
+
+// updateKnowledgeDocument 更新知识库文档并重新切分片段
+func updateKnowledgeDocument(doc *KnowledgeDocument) error {
+	if db == nil {
+		return fmt.Errorf("数据库未初始化")
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&KnowledgeDocument{}).
+			Where("id = ?", doc.ID).
+			Updates(map[string]interface{}{
+				"title":   doc.Title,
+				"content": doc.Content,
+			})
+		if result.Error != nil {
+			return fmt.Errorf("更新知识库文档失败: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Where("document_id = ?", doc.ID).Delete(&KnowledgeChunk{}).Error; err != nil {
+			return fmt.Errorf("删除旧片段失败: %w", err)
+		}
+		return saveKnowledgeChunks(tx, doc)
+	})
+	if err != nil {
+		return err
+	}
+
+	knowledgeIndex.Invalidate()
+	return nil
+}
+
+// deleteKnowledgeDocument 删除知识库文档及其片段
+func deleteKnowledgeDocument(id uint) error {
+	if db == nil {
+		return fmt.Errorf("数据库未初始化")
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("document_id = ?", id).Delete(&KnowledgeChunk{}).Error; err != nil {
+			return fmt.Errorf("删除知识库片段失败: %w", err)
+		}
+		result := tx.Delete(&KnowledgeDocument{}, id)
+		if result.Error != nil {
+			return fmt.Errorf("删除知识库文档失败: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	knowledgeIndex.Invalidate()
+	return nil
+}
+
+// saveKnowledgeChunks 切分文档并保存片段
+func saveKnowledgeChunks(tx *gorm.DB, doc *KnowledgeDocument) error {
+	chunks := chunkText(doc.Title, doc.Content, knowledgeChunkSize())
+	if len(chunks) == 0 {
+		return nil
+	}
+	for i := range chunks {
+		chunks[i].DocumentID = doc.ID
+	}
+	if err := tx.Create(&chunks).Error; err != nil {
+		return fmt.Errorf("保存知识库片段失败: %w", err)
+	}
+	return nil
+}
+
+// parseKnowledgeCSV 解析 CSV 格式的问答，每行生成一个文档
+// 第一行为表头，需包含问题列（question/title/问题/标题）和答案列（answer/content/答案/内容）
+func parseKnowledgeCSV(r io.Reader) ([]KnowledgeDocument, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("读取 CSV 表头失败: %w", err)
+	}
+
+	titleCol, contentCol := -1, -1
+	for i, name := range header {
+		switch strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))) {
+		case "question", "title", "问题", "标题":
+			titleCol = i
+		case "answer", "content", "答案", "内容":
+			contentCol = i
+		}
+	}
+	if contentCol < 0 {
+		return nil, errors.New("CSV 表头缺少答案列（answer/content/答案/内容）")
+	}
+
+	var docs []KnowledgeDocument
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取 CSV 失败: %w", err)
+		}
+		if contentCol >= len(record) || strings.TrimSpace(record[contentCol]) == "" {
+			continue
+		}
+
+		doc := KnowledgeDocument{
+			Source:  "csv",
+			Content: strings.TrimSpace(record[contentCol]),
+		}
+		if titleCol >= 0 && titleCol < len(record) {
+			doc.Title = strings.TrimSpace(record[titleCol])
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// markdownTitle 获取 Markdown 文档的一级标题
+func markdownTitle(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if markdownHeadingLevel(trimmed) == 1 {
+			return strings.TrimSpace(trimmed[1:])
+		}
+	}
+	return ""
+}
+
+// usedKnowledgeIDs 获取生成建议时使用的知识库片段ID
+// Agent 响应的 data.knowledge_ids 标明了实际引用的片段时以其为准，否则视为全部附带的片段都被使用
+func usedKnowledgeIDs(agentResp *AgentResponse, passages []KnowledgePassage) []uint {
+	attached := make(map[uint]bool, len(passages))
+	for _, p := range passages {
+		attached[p.ID] = true
+	}
+
+	if agentResp != nil && agentResp.Data != nil {
+		if refs, ok := agentResp.Data["knowledge_ids"].([]interface{}); ok {
+			ids := make([]uint, 0, len(refs))
+			for _, ref := range refs {
+				if id, ok := ref.(float64); ok && attached[uint(id)] {
+					ids = append(ids, uint(id))
+				}
+			}
+			return ids
+		}
+	}
+
+	ids := make([]uint, 0, len(passages))
+	for _, p := range passages {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+// joinKnowledgeIDs 将片段ID列表转为逗号分隔的字符串
+func joinKnowledgeIDs(ids []uint) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+// KnowledgeDocumentsHandler 知识库文档列表和创建
+// GET /api/knowledge/documents, POST /api/knowledge/documents
+func KnowledgeDocumentsHandler(w http.ResponseWriter, r *http.Request) {
+	if db == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "数据库未初始化")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var docs []KnowledgeDocument
+		if err := db.Order("id DESC").Find(&docs).Error; err != nil {
+			logger.Error("查询知识库文档失败", zap.Error(err))
+			writeJSONError(w, http.StatusInternalServerError, "查询知识库文档失败")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"documents": docs,
+		})
+
+	case http.MethodPost:
+		var doc KnowledgeDocument
+		if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "无效的请求体")
+			return
+		}
+		if strings.TrimSpace(doc.Content) == "" {
+			writeJSONError(w, http.StatusBadRequest, "content 不能为空")
+			return
+		}
+		doc.ID = 0
+		doc.Source = "manual"
+		if err := createKnowledgeDocument(&doc); err != nil {
+			logger.Error("创建知识库文档失败", zap.Error(err))
+			writeJSONError(w, http.StatusInternalServerError, "创建知识库文档失败")
+			return
+		}
+		writeJSON(w, http.StatusCreated, doc)
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// KnowledgeDocumentHandler 单个知识库文档的查询、更新和删除
+// GET/PUT/DELETE /api/knowledge/documents/{id}
+func KnowledgeDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	if db == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "数据库未初始化")
+		return
+	}
+
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "无效的文档ID")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var doc KnowledgeDocument
+		if err := db.First(&doc, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				writeJSONError(w, http.StatusNotFound, "文档不存在")
+				return
+			}
+			logger.Error("查询知识库文档失败", zap.Uint64("id", id), zap.Error(err))
+			writeJSONError(w, http.StatusInternalServerError, "查询知识库文档失败")
+			return
+		}
+		var chunks []KnowledgeChunk
+		if err := db.Where("document_id = ?", id).Order("seq").Find(&chunks).Error; err != nil {
+			logger.Error("查询知识库片段失败", zap.Uint64("id", id), zap.Error(err))
+			writeJSONError(w, http.StatusInternalServerError, "查询知识库片段失败")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"document": doc,
+			"chunks":   chunks,
+		})
+
+	case http.MethodPut:
+		var doc KnowledgeDocument
+		if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "无效的请求体")
+			return
+		}
+		if strings.TrimSpace(doc.Content) == "" {
+			writeJSONError(w, http.StatusBadRequest, "content 不能为空")
+			return
+		}
+		doc.ID = uint(id)
+		if err := updateKnowledgeDocument(&doc); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				writeJSONError(w, http.StatusNotFound, "文档不存在")
+				return
+			}
+			logger.Error("更新知识库文档失败", zap.Uint64("id", id), zap.Error(err))
+			writeJSONError(w, http.StatusInternalServerError, "更新知识库文档失败")
+			return
+		}
+		writeJSON(w, http.StatusOK, doc)
+
+	case http.MethodDelete:
+		if err := deleteKnowledgeDocument(uint(id)); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				writeJSONError(w, http.StatusNotFound, "文档不存在")
+				return
+			}
+			logger.Error("删除知识库文档失败", zap.Uint64("id", id), zap.Error(err))
+			writeJSONError(w, http.StatusInternalServerError, "删除知识库文档失败")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// KnowledgeImportHandler 批量导入知识库
+// POST /api/knowledge/import?format=markdown|csv[&title=...]
+// 请求体为文件内容，或 multipart/form-data 的 file 字段
+func KnowledgeImportHandler(w http.ResponseWriter, r *http.Request) {
+	if db == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "数据库未初始化")
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// 最大 10MB
+	r.Body = http.MaxBytesReader(w, r.Body, 10<<20)
+
+	var body io.Reader = r.Body
+	filename := ""
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "读取上传文件失败")
+			return
+		}
+		defer file.Close()
+		body = file
+		filename = header.Filename
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case ".csv":
+			format = "csv"
+		default:
+			format = "markdown"
+		}
+	}
+
+	var docs []KnowledgeDocument
+	switch format {
+	case "csv":
+		parsed, err := parseKnowledgeCSV(body)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		docs = parsed
+
+	case "markdown", "md":
+		data, err := io.ReadAll(body)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "读取请求体失败")
+			return
+		}
+		content := string(data)
+		title := r.URL.Query().Get("title")
+		if title == "" {
+			title = markdownTitle(content)
+		}
+		if title == "" && filename != "" {
+			title = strings.TrimSuffix(filename, filepath.Ext(filename))
+		}
+		if strings.TrimSpace(content) != "" {
+			docs = append(docs, KnowledgeDocument{Title: title, Source: "markdown", Content: content})
+		}
+
+	default:
+		writeJSONError(w, http.StatusBadRequest, "不支持的格式，仅支持 markdown 和 csv")
+		return
+	}
+
+	ids := make([]uint, 0, len(docs))
+	for i := range docs {
+		if err := createKnowledgeDocument(&docs[i]); err != nil {
+			logger.Error("导入知识库文档失败", zap.String("title", docs[i].Title), zap.Error(err))
+			writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+				"error":        "导入知识库文档失败",
+				"imported_ids": ids,
+			})
+			return
+		}
+		ids = append(ids, docs[i].ID)
+	}
+
+	logger.Info("知识库导入完成", zap.String("format", format), zap.Int("documents", len(ids)))
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"imported":     len(ids),
+		"imported_ids": ids,
+	})
+}
+
+// KnowledgeSearchHandler 知识库检索调试接口
+// GET /api/knowledge/search?q=...&k=3
+func KnowledgeSearchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	topK := getEnvInt("KNOWLEDGE_TOP_K", 3)
+	if k, err := strconv.Atoi(r.URL.Query().Get("k")); err == nil && k > 0 {
+		topK = k
+	}
+
+	passages, err := knowledgeIndex.Search(r.URL.Query().Get("q"), topK, getEnvFloat("KNOWLEDGE_MIN_SCORE", 10))
+	if err != nil {
+		logger.Error("检索知识库失败", zap.Error(err))
+		writeJSONError(w, http.StatusInternalServerError, "检索知识库失败")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"passages": passages,
+	})
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"go.uber.org/zap"
+)
+
+// 支持的语言
+const (
+	langChinese    = "zh"
+	langEnglish    = "en"
+	langJapanese   = "ja"
+	langVietnamese = "vi"
+)
+
+// bilingualEnabled 是否启用双语模式，设置 BILINGUAL_MODE=true 开启
+func bilingualEnabled() bool {
+	return os.Getenv("BILINGUAL_MODE") == "true"
+}
+
+// defaultAgentLanguage 客服默认使用的语言（默认中文），侧边栏认证时可通过 language 字段覆盖
+func defaultAgentLanguage() string {
+	if lang := os.Getenv("AGENT_LANGUAGE"); lang != "" {
+		return lang
+	}
+	return langChinese
+}
+
+// agentLanguage 获取客服使用的语言
+func (c *WeComClient) agentLanguage() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Language != "" {
+		return c.Language
+	}
+	return defaultAgentLanguage()
+}
+
+// isVietnameseLetter 判断是否为越南语特有的字母（带附加符号的拉丁字母）
+func isVietnameseLetter(r rune) bool {
+	if r >= 0x1EA0 && r <= 0x1EF9 {
+		// 拉丁文扩展附加区中的越南语声调字母
+		return true
+	}
+	return strings.ContainsRune("ăâđêôơưĂÂĐÊÔƠƯ", r)
+}
+
+// 判断拉丁字母语言所需的最少单词数和字母数
+// "ok"、"SF1234567" 这类短回复或单号不足以判断语言，避免被误判为英语而触发翻译
+const (
+	minLatinWords   = 2
+	minLatinLetters = 5
+)
+
+// detectLanguage 根据文字的书写系统判断文本语言，无法判断时返回空字符串
+// 含假名判断为日语；汉字数量不少于拉丁单词数量判断为中文；
+// 以拉丁字母为主且单词数、字母数达到下限时，含越南语特有字母判断为越南语，否则为英语
+func detectLanguage(text string) string {
+	han, kana, latinWords, latinLetters, vietnamese := 0, 0, 0, 0, 0
+	inLatinWord := false
+	for _, r := range text {
+		isLatin := unicode.Is(unicode.Latin, r)
+		switch {
+		case unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case isLatin && isVietnameseLetter(r):
+			vietnamese++
+		}
+		if isLatin {
+			latinLetters++
+			if !inLatinWord {
+				latinWords++
+			}
+		}
+		inLatinWord = isLatin
+	}
+
+	switch {
+	case kana > 0:
+		return langJapanese
+	case han > 0 && han >= latinWords:
+		return langChinese
+	case latinWords < minLatinWords || latinLetters < minLatinLetters:
+		return ""
+	case vietnamese > 0:
+		return langVietnamese
+	default:
+		return langEnglish
+	}
+}
+
+// translate 通过 Agent 将文本从 from 语言翻译为 to 语言
+// 翻译请求不复用会话；文本中的敏感信息经 redactor 脱敏后发送，译文中的占位符会被还原
+func (c *WeComClient) translate(ctx context.Context, chatID, text, from, to string, redactor *PIIRedactor) (string, error) {
+	agentResp, err := c.callAgentAPI(ctx, agentCallRequest{
+		ChatID:    chatID,
+		EventType: "translate",
+		Contents: []AgentCallContent{
+			{Type: "text", Content: text},
+			{Type: "translation", Content: map[string]string{
+				"source_language": from,
+				"target_language": to,
+			}},
+		},
+		Redactor:  redactor,
+		Stateless: true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// 支持 data.translation 或 data["0"].content 为译文
+	translated, _ := agentResp.Data["translation"].(string)
+	if translated == "" {
+		translated = agentResponseText(agentResp)
+	}
+	translated = strings.TrimSpace(translated)
+	if translated == "" {
+		return "", fmt.Errorf("Agent 未返回译文")
+	}
+	return redactor.Restore(translated), nil
+}
+
+// translateCustomerMessage 双语模式下将客户消息翻译为客服语言，并把译文发送给侧边栏
+// 返回客户语言和译文；未启用双语模式、客户与客服语言相同或翻译失败时返回空字符串
+// 无法识别客户语言或翻译失败时 ok 为 false，此时无法确定建议能被客户读懂
+func (c *WeComClient) translateCustomerMessage(ctx context.Context, chatID string, msg WeComMessage, text string, redactor *PIIRedactor) (customerLang, translated string, ok bool) {
+	if !bilingualEnabled() {
+		return "", "", true
+	}
+
+	customerLang = msg.Language
+	if customerLang == "" {
+		customerLang = detectLanguage(text)
+	}
+	if customerLang == "" {
+		return "", "", false
+	}
+	agentLang := c.agentLanguage()
+	if customerLang == agentLang {
+		return "", "", true
+	}
+
+	translated, err := c.translate(ctx, chatID, text, customerLang, agentLang, redactor)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Warn("翻译客户消息失败",
+				zap.String("agent_id", c.AgentID),
+				zap.String("chat_id", chatID),
+				zap.String("language", customerLang),
+				zap.Error(err))
+		}
+		return "", "", false
+	}
+
+	if err := c.SendMessage(map[string]interface{}{
+		"type":              "customer_message_translated",
+		"agent_id":          c.AgentID,
+		"chat_id":           chatID,
+		"msg_id":            msg.MsgID,
+		"customer_language": customerLang,
+		"agent_language":    agentLang,
+		"original":          text,
+		"translation":       translated,
+	}); err != nil {
+		logger.Error("发送 customer_message_translated 消息失败", zap.String("agent_id", c.AgentID), zap.Error(err))
+	}
+	return customerLang, translated, true
+}
@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"我想退货", langChinese},
+		{"请问 iPhone 15 有货吗", langChinese},
+		{"こんにちは", langJapanese},
+		{"商品はいつ届きますか", langJapanese},
+		{"I want to return my order", langEnglish},
+		{"Tôi muốn trả hàng", langVietnamese},
+		{"xin chào bạn", langVietnamese},
+		// 过短或不含字母的文本无法判断语言
+		{"ok", ""},
+		{"OK!", ""},
+		{"?", ""},
+		{"SF1234567", ""},
+		{"ok ok", ""},
+		{"12345", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := detectLanguage(tt.text); got != tt.want {
+			t.Errorf("detectLanguage(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -2,34 +2,128 @@ package main
 
 import (
 	"net/http"
+	"os"
 
 	"github.com/joho/godotenv"
 	"go.uber.org/zap"
 )
 
-func init() {
+func main() {
 	// 加载 .env 文件（如果存在）
 	if err := godotenv.Load(); err != nil {
 		// .env 文件不存在时忽略错误，使用系统环境变量
 		logger.Info("未找到 .env 文件，使用系统环境变量")
 	}
 
+	// 子命令：数据库迁移、相似度算法评估、训练数据导出
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			os.Exit(runMigrateCommand(os.Args[2:]))
+		case "evaluate":
+			os.Exit(runEvaluateCommand(os.Args[2:]))
+		case "export":
+			os.Exit(runExportCommand(os.Args[2:]))
+		}
+	}
+
 	// 初始化数据库
 	if err := initDatabase(); err != nil {
-		logger.Warn("数据库初始化失败，suggestion 关联功能将不可用", zap.Error(err))
+		logger.Error("数据库初始化失败，suggestion 关联功能将不可用，可设置 DB_DRIVER=sqlite 或 memory", zap.Error(err))
+	}
+
+	if os.Getenv("ADMIN_API_TOKEN") == "" {
+		logger.Warn("未设置 ADMIN_API_TOKEN，管理接口不可用")
 	}
-}
 
-func main() {
 	// 创建 WebSocket Hub
 	hub := NewWeComHub()
 
 	// 在 goroutine 中运行 hub
 	go hub.Run()
 
+	// 主管频道，推送升级提醒
+	go supervisorHub.Run()
+
+	// 定期清理 AI 限流的令牌桶
+	go aiRateLimiter.RunCleanup()
+
+	// 定期清理内存中过期的 Agent 会话
+	go agentSessions.RunCleanup()
+
+	// 定期清理内存中空闲的会话历史
+	go chatHistory.RunCleanup()
+
+	// 按保留期定期清理过期数据
+	go retentionJob.Run()
+
+	// 注册提供给 Agent 的服务端工具
+	registerBuiltinTools()
+
 	// 设置路由
 	http.HandleFunc("/ws/wecom", WeComWebSocketHandler(hub))
 	http.HandleFunc("/api/wx-config", WeComConfigHandler)
+	http.HandleFunc("/ws/supervisor", SupervisorWebSocketHandler(supervisorHub))
+
+	// 知识库管理
+	http.HandleFunc("/api/knowledge/documents", adminHandler(KnowledgeDocumentsHandler))
+	http.HandleFunc("/api/knowledge/documents/{id}", adminHandler(KnowledgeDocumentHandler))
+	http.HandleFunc("/api/knowledge/import", adminHandler(KnowledgeImportHandler))
+	http.HandleFunc("/api/knowledge/search", adminHandler(KnowledgeSearchHandler))
+
+	// 合规规则管理
+	http.HandleFunc("/api/compliance/rules", adminHandler(ComplianceRulesHandler))
+	http.HandleFunc("/api/compliance/rules/{id}", adminHandler(ComplianceRuleHandler))
+	http.HandleFunc("/api/compliance/check", adminHandler(ComplianceCheckHandler))
+
+	// 会话摘要（主管查看）
+	http.HandleFunc("/api/chats/{chat_id}/summary", adminHandler(ChatSummaryHandler))
+
+	// 会话情绪与升级事件
+	http.HandleFunc("/api/chats/{chat_id}/sentiment", adminHandler(ConversationSentimentHandler))
+	http.HandleFunc("/api/escalations", adminHandler(EscalationsHandler))
+	http.HandleFunc("/api/escalations/{id}/ack", adminHandler(EscalationActionHandler(escalationStatusAcknowledged)))
+	http.HandleFunc("/api/escalations/{id}/resolve", adminHandler(EscalationActionHandler(escalationStatusResolved)))
+
+	// 会话意图标签
+	http.HandleFunc("/api/conversation-tags", adminHandler(ConversationTagsHandler))
+
+	// A/B 实验
+	http.HandleFunc("/api/experiments", adminHandler(ExperimentsHandler))
+	http.HandleFunc("/api/experiments/{id}", adminHandler(ExperimentHandler))
+	http.HandleFunc("/api/experiments/{id}/report", adminHandler(ExperimentReportHandler))
+
+	// Agent 调用审计
+	http.HandleFunc("/api/ai-calls", adminHandler(AICallsHandler))
+	http.HandleFunc("/api/ai-calls/stats", adminHandler(AICallStatsHandler))
+
+	// 建议缓存
+	http.HandleFunc("/api/suggestion-cache", adminHandler(SuggestionCacheHandler))
+	http.HandleFunc("/api/suggestion-cache/{id}", adminHandler(SuggestionCacheEntryHandler))
+
+	// 建议统计
+	http.HandleFunc("/api/analytics/suggestions", adminHandler(SuggestionAnalyticsHandler))
+	http.HandleFunc("/api/analytics/calibration", adminHandler(SuggestionCalibrationHandler))
+
+	// 训练数据导出
+	http.HandleFunc("/api/export/training", adminHandler(TrainingExportHandler))
+
+	// 建议修改记录
+	http.HandleFunc("/api/suggestion-diffs", adminHandler(SuggestionDiffsHandler))
+	http.HandleFunc("/api/suggestion-diffs/stats", adminHandler(SuggestionDiffStatsHandler))
+
+	// 数据保留与清理
+	http.HandleFunc("/api/retention", adminHandler(RetentionHandler))
+	http.HandleFunc("/api/retention/run", adminHandler(RetentionRunHandler))
+
+	// 自动回复设置
+	http.HandleFunc("/api/auto-reply", adminHandler(AutoReplySettingsHandler))
+
+	// AI 限流与配额
+	http.HandleFunc("/api/ai-usage", adminHandler(AIUsageHandler))
+
+	// 工具调用审计
+	http.HandleFunc("/api/tool-invocations", adminHandler(ToolInvocationsHandler))
 
 	// 启动 HTTP 服务器
 	port := ":8080"
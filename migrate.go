@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// migrationFiles 内嵌的 SQL 迁移文件，命名为 NNNN_name.up.sql / NNNN_name.down.sql
+// migrations 下为 PostgreSQL 迁移，migrations/sqlite 下为对应的 SQLite 迁移
+//
+//go:embed migrations/*.sql migrations/sqlite/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey 迁移使用的 PostgreSQL advisory lock，保证同一时间只有一个实例执行迁移
+const migrationLockKey int64 = 0x73696465626172 // "sidebar"
+
+var migrationFileRe = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// migration 一个版本的迁移
+type migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string // 为空时该版本不可回滚
+}
+
+// migrationState 迁移版本的执行状态
+type migrationState struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time // 未执行为 nil
+	Known     bool       // 当前程序是否包含该版本，数据库版本比程序新时为 false
+}
+
+// migrateOnStart 服务启动时是否自动执行迁移，设置 DB_MIGRATE_ON_START=false 关闭
+func migrateOnStart() bool {
+	return os.Getenv("DB_MIGRATE_ON_START") != "false"
+}
+
+// migrationDir 当前数据库使用的迁移目录
+func migrationDir() string {
+	if db != nil && db.Dialector.Name() == storageDriverSQLite {
+		return "migrations/sqlite"
+	}
+	return "migrations"
+}
+
+// loadMigrations 读取当前数据库对应的内嵌迁移文件，按版本升序返回
+func loadMigrations() ([]migration, error) {
+	dir := migrationDir()
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取迁移文件失败: %w", err)
+	}
+
+	byVersion := make(map[int64]*migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := migrationFileRe.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("无效的迁移文件名: %s", entry.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("无效的迁移版本: %s", entry.Name())
+		}
+		content, err := migrationFiles.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("读取迁移文件 %s 失败: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("迁移版本 %d 的文件名不一致: %s, %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("迁移版本 %d 缺少 up 文件", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// withMigrationLock 在持有迁移锁的专用连接上执行 fn，其他实例会阻塞等待锁释放
+// SQLite 只有单个进程访问，不加锁
+func withMigrationLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	if db == nil {
+		return fmt.Errorf("数据库未初始化")
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+	defer conn.Close()
+
+	appliedAtType := "datetime"
+	if usingPostgres() {
+		appliedAtType = "timestamptz"
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+			return fmt.Errorf("获取迁移锁失败: %w", err)
+		}
+		defer func() {
+			// 使用独立的 context，确保调用方取消后仍能释放锁
+			if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey); err != nil {
+				logger.Warn("释放迁移锁失败", zap.Error(err))
+			}
+		}()
+	}
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY,
+		name varchar(255) NOT NULL,
+		applied_at `+appliedAtType+` NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		return fmt.Errorf("创建 schema_migrations 表失败: %w", err)
+	}
+	return fn(conn)
+}
+
+// appliedMigrations 查询已执行的迁移版本
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int64]migrationState, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("查询 schema_migrations 失败: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]migrationState)
+	for rows.Next() {
+		var state migrationState
+		var appliedAt time.Time
+		if err := rows.Scan(&state.Version, &state.Name, &appliedAt); err != nil {
+			return nil, fmt.Errorf("读取 schema_migrations 失败: %w", err)
+		}
+		state.AppliedAt = &appliedAt
+		applied[state.Version] = state
+	}
+	return applied, rows.Err()
+}
+
+// runMigration 在事务中执行一个版本的 up 或 down，并更新 schema_migrations
+func runMigration(ctx context.Context, conn *sql.Conn, m migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	script, record, args := m.Up, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", []interface{}{m.Version, m.Name}
+	if !up {
+		script, record, args = m.Down, "DELETE FROM schema_migrations WHERE version = $1", []interface{}{m.Version}
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("执行迁移 %04d_%s 失败: %w", m.Version, m.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return fmt.Errorf("记录迁移 %04d_%s 失败: %w", m.Version, m.Name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交迁移 %04d_%s 失败: %w", m.Version, m.Name, err)
+	}
+	return nil
+}
+
+// migrateUp 按版本顺序执行所有未执行的迁移，返回执行的数量
+func migrateUp(ctx context.Context) (int, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			start := time.Now()
+			if err := runMigration(ctx, conn, m, true); err != nil {
+				return err
+			}
+			count++
+			logger.Info("已执行数据库迁移",
+				zap.Int64("version", m.Version),
+				zap.String("name", m.Name),
+				zap.Duration("duration", time.Since(start)))
+		}
+		return nil
+	})
+	return count, err
+}
+
+// migrateDown 按版本倒序回滚最近执行的 steps 个迁移，返回回滚的数量
+func migrateDown(ctx context.Context, steps int) (int, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	known := make(map[int64]migration, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = m
+	}
+
+	count := 0
+	err = withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		versions := make([]int64, 0, len(applied))
+		for version := range applied {
+			versions = append(versions, version)
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+
+		for _, version := range versions {
+			if count >= steps {
+				break
+			}
+			m, ok := known[version]
+			if !ok {
+				return fmt.Errorf("迁移版本 %d 不在当前程序中，无法回滚", version)
+			}
+			if m.Down == "" {
+				return fmt.Errorf("迁移 %04d_%s 缺少 down 文件，无法回滚", m.Version, m.Name)
+			}
+			if err := runMigration(ctx, conn, m, false); err != nil {
+				return err
+			}
+			count++
+			logger.Info("已回滚数据库迁移", zap.Int64("version", m.Version), zap.String("name", m.Name))
+		}
+		return nil
+	})
+	return count, err
+}
+
+// migrationStatus 查询所有迁移版本的执行状态，包括数据库中存在但当前程序不包含的版本
+func migrationStatus(ctx context.Context) ([]migrationState, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var states []migrationState
+	err = withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			state := migrationState{Version: m.Version, Name: m.Name, Known: true}
+			if a, ok := applied[m.Version]; ok {
+				state.AppliedAt = a.AppliedAt
+				delete(applied, m.Version)
+			}
+			states = append(states, state)
+		}
+		for _, a := range applied {
+			states = append(states, a)
+		}
+		return nil
+	})
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states, err
+}
+
+// runMigrateCommand 执行 migrate 子命令，返回进程退出码
+// 用法: sidebar-server migrate up | down [N] | status
+func runMigrateCommand(args []string) int {
+	usage := func() int {
+		fmt.Fprintln(os.Stderr, "用法: sidebar-server migrate up | down [N] | status")
+		return 2
+	}
+	if len(args) == 0 {
+		return usage()
+	}
+
+	if err := openDatabase(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		count, err := migrateUp(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "迁移失败（已执行 %d 个）: %v\n", count, err)
+			return 1
+		}
+		fmt.Printf("已执行 %d 个迁移\n", count)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return usage()
+			}
+			steps = n
+		}
+		count, err := migrateDown(ctx, steps)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "回滚失败（已回滚 %d 个）: %v\n", count, err)
+			return 1
+		}
+		fmt.Printf("已回滚 %d 个迁移\n", count)
+
+	case "status":
+		states, err := migrationStatus(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "查询迁移状态失败: %v\n", err)
+			return 1
+		}
+		for _, state := range states {
+			status := "pending"
+			if state.AppliedAt != nil {
+				status = "applied " + state.AppliedAt.Format(time.RFC3339)
+			}
+			if !state.Known {
+				status += " (unknown)"
+			}
+			fmt.Printf("%04d_%s\t%s\n", state.Version, state.Name, status)
+		}
+
+	default:
+		return usage()
+	}
+	return 0
+}
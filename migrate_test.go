@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// migratedModels 由迁移创建表结构的 GORM 模型
+var migratedModels = []schema.Tabler{
+	Suggestion{},
+	AgentSession{},
+	ReplyAnalysis{},
+	KnowledgeDocument{},
+	KnowledgeChunk{},
+	ToolInvocation{},
+	ComplianceRule{},
+	ConversationTag{},
+	ChatMessage{},
+	ChatSummaryRecord{},
+	ConversationSentiment{},
+	Escalation{},
+	Experiment{},
+	AICall{},
+	AIQuotaUsage{},
+	SuggestionCacheEntry{},
+	AutoReplySetting{},
+	SuggestionDiff{},
+}
+
+// assertSchemaMatchesModels 检查每个模型的表和所有列都存在
+func assertSchemaMatchesModels(t *testing.T) {
+	t.Helper()
+	migrator := db.Migrator()
+	for _, model := range migratedModels {
+		if !migrator.HasTable(model) {
+			t.Errorf("缺少表 %s", model.TableName())
+			continue
+		}
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatalf("解析模型 %s 失败: %v", model.TableName(), err)
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			if !migrator.HasColumn(model, field.DBName) {
+				t.Errorf("表 %s 缺少列 %s", model.TableName(), field.DBName)
+			}
+		}
+	}
+}
+
+func TestMigrationsUpDownSQLite(t *testing.T) {
+	newTestSQLiteStore(t)
+	ctx := context.Background()
+
+	assertSchemaMatchesModels(t)
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("加载迁移失败: %v", err)
+	}
+
+	// 回滚前写入一条建议，回滚 0001 时不应删除 suggestions 表
+	if err := suggestionStore.CreateSuggestion(Suggestion{SuggestionID: "s1", AgentID: "a1", ChatID: "c1"}); err != nil {
+		t.Fatalf("CreateSuggestion: %v", err)
+	}
+
+	count, err := migrateDown(ctx, len(migrations))
+	if err != nil {
+		t.Fatalf("回滚迁移失败: %v", err)
+	}
+	if count != len(migrations) {
+		t.Errorf("回滚了 %d 个迁移, want %d", count, len(migrations))
+	}
+	for _, model := range migratedModels {
+		exists := db.Migrator().HasTable(model)
+		if _, ok := model.(Suggestion); ok {
+			if !exists {
+				t.Error("回滚后应保留 suggestions 表")
+			}
+			continue
+		}
+		if exists {
+			t.Errorf("回滚后表 %s 仍然存在", model.TableName())
+		}
+	}
+	var kept int64
+	if err := db.Model(&Suggestion{}).Count(&kept).Error; err != nil || kept != 1 {
+		t.Errorf("回滚后 suggestions 记录数 = %d, %v, want 1", kept, err)
+	}
+
+	// 在保留的 suggestions 表上重新执行全部迁移
+	if _, err := migrateUp(ctx); err != nil {
+		t.Fatalf("重新执行迁移失败: %v", err)
+	}
+	assertSchemaMatchesModels(t)
+}
@@ -0,0 +1,17 @@
+-- suggestions 表在引入迁移前已由 AutoMigrate 创建并保存着线上数据，回滚不删除该表
+DROP TABLE IF EXISTS auto_reply_settings;
+DROP TABLE IF EXISTS suggestion_cache;
+DROP TABLE IF EXISTS ai_quota_usage;
+DROP TABLE IF EXISTS ai_calls;
+DROP TABLE IF EXISTS experiments;
+DROP TABLE IF EXISTS escalations;
+DROP TABLE IF EXISTS conversation_sentiments;
+DROP TABLE IF EXISTS chat_summaries;
+DROP TABLE IF EXISTS chat_messages;
+DROP TABLE IF EXISTS conversation_tags;
+DROP TABLE IF EXISTS compliance_rules;
+DROP TABLE IF EXISTS tool_invocations;
+DROP TABLE IF EXISTS knowledge_chunks;
+DROP TABLE IF EXISTS knowledge_documents;
+DROP TABLE IF EXISTS reply_analyses;
+DROP TABLE IF EXISTS agent_sessions;
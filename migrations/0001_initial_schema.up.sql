@@ -0,0 +1,276 @@
+-- 初始表结构，与此前 AutoMigrate 创建的结构一致
+-- 已由 AutoMigrate 建表的数据库执行本迁移时只创建缺少的表、列和索引，不改动已有的表、列和索引；
+-- 早期版本只创建了 suggestions 的基础列，后来新增的列通过 ADD COLUMN IF NOT EXISTS 补齐
+
+CREATE TABLE IF NOT EXISTS suggestions (
+    id bigserial PRIMARY KEY,
+    suggestion_id varchar(255) NOT NULL,
+    agent_id varchar(255) NOT NULL,
+    chat_id varchar(255),
+    msg_id varchar(255),
+    original_content text,
+    edited_content text,
+    confidence decimal(5,2),
+    similarity decimal(5,2) DEFAULT 0,
+    action varchar(50),
+    knowledge_ids text,
+    compliance_status varchar(20),
+    compliance_violations text,
+    intent varchar(50),
+    language varchar(10),
+    translated_content text,
+    experiment varchar(100),
+    variant varchar(100),
+    question text,
+    cache_entry_id bigint,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+ALTER TABLE suggestions ADD COLUMN IF NOT EXISTS knowledge_ids text;
+ALTER TABLE suggestions ADD COLUMN IF NOT EXISTS compliance_status varchar(20);
+ALTER TABLE suggestions ADD COLUMN IF NOT EXISTS compliance_violations text;
+ALTER TABLE suggestions ADD COLUMN IF NOT EXISTS intent varchar(50);
+ALTER TABLE suggestions ADD COLUMN IF NOT EXISTS language varchar(10);
+ALTER TABLE suggestions ADD COLUMN IF NOT EXISTS translated_content text;
+ALTER TABLE suggestions ADD COLUMN IF NOT EXISTS experiment varchar(100);
+ALTER TABLE suggestions ADD COLUMN IF NOT EXISTS variant varchar(100);
+ALTER TABLE suggestions ADD COLUMN IF NOT EXISTS question text;
+ALTER TABLE suggestions ADD COLUMN IF NOT EXISTS cache_entry_id bigint;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_suggestions_suggestion_id ON suggestions (suggestion_id);
+CREATE INDEX IF NOT EXISTS idx_suggestions_agent_id ON suggestions (agent_id);
+CREATE INDEX IF NOT EXISTS idx_suggestions_chat_id ON suggestions (chat_id);
+CREATE INDEX IF NOT EXISTS idx_suggestions_msg_id ON suggestions (msg_id);
+CREATE INDEX IF NOT EXISTS idx_suggestions_compliance_status ON suggestions (compliance_status);
+CREATE INDEX IF NOT EXISTS idx_suggestions_intent ON suggestions (intent);
+CREATE INDEX IF NOT EXISTS idx_suggestions_experiment ON suggestions (experiment);
+CREATE INDEX IF NOT EXISTS idx_suggestions_cache_entry_id ON suggestions (cache_entry_id);
+
+CREATE TABLE IF NOT EXISTS agent_sessions (
+    id bigserial PRIMARY KEY,
+    agent_id varchar(255) NOT NULL,
+    chat_id varchar(255) NOT NULL,
+    session_id bigint NOT NULL,
+    caller_instance_id bigint NOT NULL,
+    expire_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_agent_sessions_agent_chat ON agent_sessions (agent_id, chat_id);
+CREATE INDEX IF NOT EXISTS idx_agent_sessions_expire_at ON agent_sessions (expire_at);
+
+CREATE TABLE IF NOT EXISTS reply_analyses (
+    id bigserial PRIMARY KEY,
+    agent_id varchar(255) NOT NULL,
+    chat_id varchar(255),
+    msg_id varchar(255),
+    reply_content text,
+    next_step_hints text,
+    missing_info text,
+    quality_score decimal(5,2) DEFAULT 0,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_reply_analyses_agent_id ON reply_analyses (agent_id);
+CREATE INDEX IF NOT EXISTS idx_reply_analyses_chat_id ON reply_analyses (chat_id);
+CREATE INDEX IF NOT EXISTS idx_reply_analyses_msg_id ON reply_analyses (msg_id);
+
+CREATE TABLE IF NOT EXISTS knowledge_documents (
+    id bigserial PRIMARY KEY,
+    title varchar(255),
+    source varchar(50),
+    content text,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS knowledge_chunks (
+    id bigserial PRIMARY KEY,
+    document_id bigint NOT NULL,
+    seq bigint NOT NULL,
+    title varchar(255),
+    content text,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_knowledge_chunks_document_id ON knowledge_chunks (document_id);
+
+CREATE TABLE IF NOT EXISTS tool_invocations (
+    id bigserial PRIMARY KEY,
+    agent_id varchar(255) NOT NULL,
+    chat_id varchar(255),
+    tool_call_id varchar(255),
+    tool_name varchar(100),
+    arguments text,
+    result text,
+    error text,
+    duration_ms bigint,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_tool_invocations_agent_id ON tool_invocations (agent_id);
+CREATE INDEX IF NOT EXISTS idx_tool_invocations_chat_id ON tool_invocations (chat_id);
+CREATE INDEX IF NOT EXISTS idx_tool_invocations_tool_name ON tool_invocations (tool_name);
+CREATE INDEX IF NOT EXISTS idx_tool_invocations_created_at ON tool_invocations (created_at);
+
+CREATE TABLE IF NOT EXISTS compliance_rules (
+    id bigserial PRIMARY KEY,
+    name varchar(255),
+    category varchar(50) NOT NULL,
+    pattern text NOT NULL,
+    is_regex boolean,
+    action varchar(20) NOT NULL,
+    replacement text,
+    message text,
+    enabled boolean,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_compliance_rules_category ON compliance_rules (category);
+
+CREATE TABLE IF NOT EXISTS conversation_tags (
+    id bigserial PRIMARY KEY,
+    agent_id varchar(255),
+    chat_id varchar(255) NOT NULL,
+    intent varchar(50) NOT NULL,
+    count bigint NOT NULL DEFAULT 1,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conversation_tags_chat_intent ON conversation_tags (chat_id, intent);
+CREATE INDEX IF NOT EXISTS idx_conversation_tags_agent_id ON conversation_tags (agent_id);
+CREATE INDEX IF NOT EXISTS idx_conversation_tags_updated_at ON conversation_tags (updated_at);
+
+CREATE TABLE IF NOT EXISTS chat_messages (
+    id bigserial PRIMARY KEY,
+    chat_id varchar(255) NOT NULL,
+    msg_id varchar(255) NOT NULL,
+    role varchar(20),
+    content text,
+    msg_time timestamptz,
+    created_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_chat_messages_chat_msg ON chat_messages (chat_id, msg_id);
+CREATE INDEX IF NOT EXISTS idx_chat_messages_msg_time ON chat_messages (msg_time);
+
+CREATE TABLE IF NOT EXISTS chat_summaries (
+    id bigserial PRIMARY KEY,
+    chat_id varchar(255) NOT NULL,
+    customer_issue text,
+    promises text,
+    open_items text,
+    last_msg_id varchar(255),
+    message_count bigint,
+    generated_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_chat_summaries_chat_id ON chat_summaries (chat_id);
+
+CREATE TABLE IF NOT EXISTS conversation_sentiments (
+    id bigserial PRIMARY KEY,
+    chat_id varchar(255) NOT NULL,
+    agent_id varchar(255),
+    message_count bigint,
+    score decimal,
+    anger decimal,
+    churn decimal,
+    last_score decimal,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conversation_sentiments_chat_id ON conversation_sentiments (chat_id);
+CREATE INDEX IF NOT EXISTS idx_conversation_sentiments_agent_id ON conversation_sentiments (agent_id);
+
+CREATE TABLE IF NOT EXISTS escalations (
+    id bigserial PRIMARY KEY,
+    agent_id varchar(255),
+    chat_id varchar(255) NOT NULL,
+    msg_id varchar(255),
+    reason varchar(50),
+    keyword varchar(100),
+    content text,
+    score decimal,
+    anger decimal,
+    churn decimal,
+    status varchar(20) NOT NULL,
+    acknowledged_by varchar(255),
+    acknowledged_at timestamptz,
+    resolved_by varchar(255),
+    resolved_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_escalations_agent_id ON escalations (agent_id);
+CREATE INDEX IF NOT EXISTS idx_escalations_chat_id ON escalations (chat_id);
+CREATE INDEX IF NOT EXISTS idx_escalations_reason ON escalations (reason);
+CREATE INDEX IF NOT EXISTS idx_escalations_status ON escalations (status);
+CREATE INDEX IF NOT EXISTS idx_escalations_created_at ON escalations (created_at);
+
+CREATE TABLE IF NOT EXISTS experiments (
+    id bigserial PRIMARY KEY,
+    name varchar(100) NOT NULL,
+    description text,
+    assign_by varchar(20) NOT NULL,
+    variants text,
+    enabled boolean,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_experiments_name ON experiments (name);
+CREATE INDEX IF NOT EXISTS idx_experiments_enabled ON experiments (enabled);
+
+CREATE TABLE IF NOT EXISTS ai_calls (
+    id bigserial PRIMARY KEY,
+    suggestion_id varchar(255),
+    agent_id varchar(255) NOT NULL,
+    chat_id varchar(255),
+    event_type varchar(50),
+    backend varchar(500),
+    request text,
+    response text,
+    http_status bigint,
+    code bigint,
+    latency_ms bigint,
+    retries bigint,
+    error text,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_ai_calls_suggestion_id ON ai_calls (suggestion_id);
+CREATE INDEX IF NOT EXISTS idx_ai_calls_agent_id ON ai_calls (agent_id);
+CREATE INDEX IF NOT EXISTS idx_ai_calls_chat_id ON ai_calls (chat_id);
+CREATE INDEX IF NOT EXISTS idx_ai_calls_event_type ON ai_calls (event_type);
+CREATE INDEX IF NOT EXISTS idx_ai_calls_created_at ON ai_calls (created_at);
+
+CREATE TABLE IF NOT EXISTS ai_quota_usage (
+    id bigserial PRIMARY KEY,
+    corp_id varchar(100) NOT NULL,
+    day varchar(10) NOT NULL,
+    count bigint,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_ai_quota_corp_day ON ai_quota_usage (corp_id, day);
+
+CREATE TABLE IF NOT EXISTS suggestion_cache (
+    id bigserial PRIMARY KEY,
+    corp_id varchar(100) NOT NULL,
+    intent varchar(50),
+    question_hash varchar(64) NOT NULL,
+    question text,
+    normalized_question text,
+    answer text,
+    suggestion_id varchar(255),
+    use_count bigint,
+    hit_count bigint,
+    expires_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_suggestion_cache_key ON suggestion_cache (corp_id, intent, question_hash);
+CREATE INDEX IF NOT EXISTS idx_suggestion_cache_expires_at ON suggestion_cache (expires_at);
+
+CREATE TABLE IF NOT EXISTS auto_reply_settings (
+    id bigserial PRIMARY KEY,
+    agent_id varchar(255) NOT NULL,
+    enabled boolean,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_auto_reply_settings_agent_id ON auto_reply_settings (agent_id);
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS suggestion_diffs (
+    id bigserial PRIMARY KEY,
+    suggestion_id varchar(255) NOT NULL,
+    agent_id varchar(255),
+    chat_id varchar(255),
+    intent varchar(50),
+    source varchar(20),
+    original text,
+    sent text,
+    char_ops text,
+    word_ops text,
+    chars_added bigint,
+    chars_removed bigint,
+    words_added bigint,
+    words_removed bigint,
+    edit_ratio decimal,
+    categories varchar(500),
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_suggestion_diffs_suggestion_id ON suggestion_diffs (suggestion_id);
+CREATE INDEX IF NOT EXISTS idx_suggestion_diffs_agent_id ON suggestion_diffs (agent_id);
+CREATE INDEX IF NOT EXISTS idx_suggestion_diffs_intent ON suggestion_diffs (intent);
+CREATE INDEX IF NOT EXISTS idx_suggestion_diffs_created_at ON suggestion_diffs (created_at);
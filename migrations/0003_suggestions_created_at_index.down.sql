@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_suggestions_created_at;
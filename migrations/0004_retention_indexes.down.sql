@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_conversation_sentiments_updated_at;
+DROP INDEX IF EXISTS idx_chat_summaries_updated_at;
+DROP INDEX IF EXISTS idx_reply_analyses_created_at;
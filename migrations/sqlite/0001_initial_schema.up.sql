@@ -0,0 +1,266 @@
+-- 初始表结构，与 PostgreSQL 的 0001_initial_schema 对应
+-- SQLite 数据库只由迁移创建，不存在 AutoMigrate 建的旧表，suggestions 建表时已包含全部列，
+-- 无需像 PostgreSQL 那样补列（SQLite 也不支持 ADD COLUMN IF NOT EXISTS）
+
+CREATE TABLE IF NOT EXISTS suggestions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    suggestion_id varchar(255) NOT NULL,
+    agent_id varchar(255) NOT NULL,
+    chat_id varchar(255),
+    msg_id varchar(255),
+    original_content text,
+    edited_content text,
+    confidence decimal(5,2),
+    similarity decimal(5,2) DEFAULT 0,
+    action varchar(50),
+    knowledge_ids text,
+    compliance_status varchar(20),
+    compliance_violations text,
+    intent varchar(50),
+    language varchar(10),
+    translated_content text,
+    experiment varchar(100),
+    variant varchar(100),
+    question text,
+    cache_entry_id bigint,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_suggestions_suggestion_id ON suggestions (suggestion_id);
+CREATE INDEX IF NOT EXISTS idx_suggestions_agent_id ON suggestions (agent_id);
+CREATE INDEX IF NOT EXISTS idx_suggestions_chat_id ON suggestions (chat_id);
+CREATE INDEX IF NOT EXISTS idx_suggestions_msg_id ON suggestions (msg_id);
+CREATE INDEX IF NOT EXISTS idx_suggestions_compliance_status ON suggestions (compliance_status);
+CREATE INDEX IF NOT EXISTS idx_suggestions_intent ON suggestions (intent);
+CREATE INDEX IF NOT EXISTS idx_suggestions_experiment ON suggestions (experiment);
+CREATE INDEX IF NOT EXISTS idx_suggestions_cache_entry_id ON suggestions (cache_entry_id);
+
+CREATE TABLE IF NOT EXISTS agent_sessions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    agent_id varchar(255) NOT NULL,
+    chat_id varchar(255) NOT NULL,
+    session_id bigint NOT NULL,
+    caller_instance_id bigint NOT NULL,
+    expire_at datetime,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_agent_sessions_agent_chat ON agent_sessions (agent_id, chat_id);
+CREATE INDEX IF NOT EXISTS idx_agent_sessions_expire_at ON agent_sessions (expire_at);
+
+CREATE TABLE IF NOT EXISTS reply_analyses (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    agent_id varchar(255) NOT NULL,
+    chat_id varchar(255),
+    msg_id varchar(255),
+    reply_content text,
+    next_step_hints text,
+    missing_info text,
+    quality_score decimal(5,2) DEFAULT 0,
+    created_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_reply_analyses_agent_id ON reply_analyses (agent_id);
+CREATE INDEX IF NOT EXISTS idx_reply_analyses_chat_id ON reply_analyses (chat_id);
+CREATE INDEX IF NOT EXISTS idx_reply_analyses_msg_id ON reply_analyses (msg_id);
+
+CREATE TABLE IF NOT EXISTS knowledge_documents (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    title varchar(255),
+    source varchar(50),
+    content text,
+    created_at datetime,
+    updated_at datetime
+);
+
+CREATE TABLE IF NOT EXISTS knowledge_chunks (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    document_id bigint NOT NULL,
+    seq bigint NOT NULL,
+    title varchar(255),
+    content text,
+    created_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_knowledge_chunks_document_id ON knowledge_chunks (document_id);
+
+CREATE TABLE IF NOT EXISTS tool_invocations (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    agent_id varchar(255) NOT NULL,
+    chat_id varchar(255),
+    tool_call_id varchar(255),
+    tool_name varchar(100),
+    arguments text,
+    result text,
+    error text,
+    duration_ms bigint,
+    created_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_tool_invocations_agent_id ON tool_invocations (agent_id);
+CREATE INDEX IF NOT EXISTS idx_tool_invocations_chat_id ON tool_invocations (chat_id);
+CREATE INDEX IF NOT EXISTS idx_tool_invocations_tool_name ON tool_invocations (tool_name);
+CREATE INDEX IF NOT EXISTS idx_tool_invocations_created_at ON tool_invocations (created_at);
+
+CREATE TABLE IF NOT EXISTS compliance_rules (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    name varchar(255),
+    category varchar(50) NOT NULL,
+    pattern text NOT NULL,
+    is_regex boolean,
+    action varchar(20) NOT NULL,
+    replacement text,
+    message text,
+    enabled boolean,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_compliance_rules_category ON compliance_rules (category);
+
+CREATE TABLE IF NOT EXISTS conversation_tags (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    agent_id varchar(255),
+    chat_id varchar(255) NOT NULL,
+    intent varchar(50) NOT NULL,
+    count bigint NOT NULL DEFAULT 1,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conversation_tags_chat_intent ON conversation_tags (chat_id, intent);
+CREATE INDEX IF NOT EXISTS idx_conversation_tags_agent_id ON conversation_tags (agent_id);
+CREATE INDEX IF NOT EXISTS idx_conversation_tags_updated_at ON conversation_tags (updated_at);
+
+CREATE TABLE IF NOT EXISTS chat_messages (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    chat_id varchar(255) NOT NULL,
+    msg_id varchar(255) NOT NULL,
+    role varchar(20),
+    content text,
+    msg_time datetime,
+    created_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_chat_messages_chat_msg ON chat_messages (chat_id, msg_id);
+CREATE INDEX IF NOT EXISTS idx_chat_messages_msg_time ON chat_messages (msg_time);
+
+CREATE TABLE IF NOT EXISTS chat_summaries (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    chat_id varchar(255) NOT NULL,
+    customer_issue text,
+    promises text,
+    open_items text,
+    last_msg_id varchar(255),
+    message_count bigint,
+    generated_at datetime,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_chat_summaries_chat_id ON chat_summaries (chat_id);
+
+CREATE TABLE IF NOT EXISTS conversation_sentiments (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    chat_id varchar(255) NOT NULL,
+    agent_id varchar(255),
+    message_count bigint,
+    score decimal,
+    anger decimal,
+    churn decimal,
+    last_score decimal,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conversation_sentiments_chat_id ON conversation_sentiments (chat_id);
+CREATE INDEX IF NOT EXISTS idx_conversation_sentiments_agent_id ON conversation_sentiments (agent_id);
+
+CREATE TABLE IF NOT EXISTS escalations (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    agent_id varchar(255),
+    chat_id varchar(255) NOT NULL,
+    msg_id varchar(255),
+    reason varchar(50),
+    keyword varchar(100),
+    content text,
+    score decimal,
+    anger decimal,
+    churn decimal,
+    status varchar(20) NOT NULL,
+    acknowledged_by varchar(255),
+    acknowledged_at datetime,
+    resolved_by varchar(255),
+    resolved_at datetime,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_escalations_agent_id ON escalations (agent_id);
+CREATE INDEX IF NOT EXISTS idx_escalations_chat_id ON escalations (chat_id);
+CREATE INDEX IF NOT EXISTS idx_escalations_reason ON escalations (reason);
+CREATE INDEX IF NOT EXISTS idx_escalations_status ON escalations (status);
+CREATE INDEX IF NOT EXISTS idx_escalations_created_at ON escalations (created_at);
+
+CREATE TABLE IF NOT EXISTS experiments (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    name varchar(100) NOT NULL,
+    description text,
+    assign_by varchar(20) NOT NULL,
+    variants text,
+    enabled boolean,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_experiments_name ON experiments (name);
+CREATE INDEX IF NOT EXISTS idx_experiments_enabled ON experiments (enabled);
+
+CREATE TABLE IF NOT EXISTS ai_calls (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    suggestion_id varchar(255),
+    agent_id varchar(255) NOT NULL,
+    chat_id varchar(255),
+    event_type varchar(50),
+    backend varchar(500),
+    request text,
+    response text,
+    http_status bigint,
+    code bigint,
+    latency_ms bigint,
+    retries bigint,
+    error text,
+    created_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_ai_calls_suggestion_id ON ai_calls (suggestion_id);
+CREATE INDEX IF NOT EXISTS idx_ai_calls_agent_id ON ai_calls (agent_id);
+CREATE INDEX IF NOT EXISTS idx_ai_calls_chat_id ON ai_calls (chat_id);
+CREATE INDEX IF NOT EXISTS idx_ai_calls_event_type ON ai_calls (event_type);
+CREATE INDEX IF NOT EXISTS idx_ai_calls_created_at ON ai_calls (created_at);
+
+CREATE TABLE IF NOT EXISTS ai_quota_usage (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    corp_id varchar(100) NOT NULL,
+    day varchar(10) NOT NULL,
+    count bigint,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_ai_quota_corp_day ON ai_quota_usage (corp_id, day);
+
+CREATE TABLE IF NOT EXISTS suggestion_cache (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    corp_id varchar(100) NOT NULL,
+    intent varchar(50),
+    question_hash varchar(64) NOT NULL,
+    question text,
+    normalized_question text,
+    answer text,
+    suggestion_id varchar(255),
+    use_count bigint,
+    hit_count bigint,
+    expires_at datetime,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_suggestion_cache_key ON suggestion_cache (corp_id, intent, question_hash);
+CREATE INDEX IF NOT EXISTS idx_suggestion_cache_expires_at ON suggestion_cache (expires_at);
+
+CREATE TABLE IF NOT EXISTS auto_reply_settings (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    agent_id varchar(255) NOT NULL,
+    enabled boolean,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_auto_reply_settings_agent_id ON auto_reply_settings (agent_id);
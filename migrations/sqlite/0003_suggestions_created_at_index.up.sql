@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_suggestions_created_at ON suggestions (created_at);
@@ -0,0 +1,4 @@
+-- 数据清理按时间列分批删除，补齐缺少的时间索引
+CREATE INDEX IF NOT EXISTS idx_reply_analyses_created_at ON reply_analyses (created_at);
+CREATE INDEX IF NOT EXISTS idx_chat_summaries_updated_at ON chat_summaries (updated_at);
+CREATE INDEX IF NOT EXISTS idx_conversation_sentiments_updated_at ON conversation_sentiments (updated_at);
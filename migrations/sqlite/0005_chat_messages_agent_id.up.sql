@@ -0,0 +1,2 @@
+-- 记录客服消息的发送客服，离线评估时只把同一客服的 suggestion 作为候选
+ALTER TABLE chat_messages ADD COLUMN agent_id varchar(255);
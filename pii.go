@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// piiPattern 一类个人敏感信息的识别规则
+type piiPattern struct {
+	kind  string // 占位符中的类型名，如 PHONE
+	re    *regexp.Regexp
+	valid func(match string) bool // 可选的二次校验，减少误判
+}
+
+// piiPatterns 按顺序匹配，较长、较特定的规则在前，避免身份证号被识别为银行卡号或手机号
+var piiPatterns = []piiPattern{
+	{
+		kind: "EMAIL",
+		re:   regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	},
+	{
+		kind: "ID_CARD",
+		re:   regexp.MustCompile(`\b[1-9]\d{5}(?:18|19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]\b`),
+	},
+	{
+		kind:  "BANK_CARD",
+		re:    regexp.MustCompile(`\b\d{4}(?: ?\d{4}){3}(?: ?\d{1,3})?\b`),
+		valid: luhnValid,
+	},
+	{
+		kind: "PHONE",
+		re:   regexp.MustCompile(`(?:\+?86[ \-]?)?\b1[3-9]\d{9}\b|\b0\d{2,3}-\d{7,8}\b`),
+	},
+	{
+		kind: "ADDRESS",
+		re: regexp.MustCompile(`(?:\p{Han}{2,6}(?:省|自治区|特别行政区))?(?:\p{Han}{2,6}(?:市|州|盟))?(?:\p{Han}{1,6}(?:区|县|旗))?` +
+			`[\p{Han}\d]{1,12}(?:路|街|大道|巷|弄|胡同)\d+(?:-\d+)?号(?:[\p{Han}\d\-]{0,12}(?:室|楼|栋|幢|单元|层))?`),
+	},
+}
+
+// luhnValid 使用 Luhn 算法校验银行卡号
+func luhnValid(match string) bool {
+	digits := strings.ReplaceAll(match, " ", "")
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// piiRedactionEnabled 是否启用敏感信息脱敏，设置 PII_REDACTION=false 关闭
+func piiRedactionEnabled() bool {
+	return os.Getenv("PII_REDACTION") != "false"
+}
+
+// PIIRedactor 将文本中的个人敏感信息替换为占位符，如 [PHONE_1]
+// 每次 AI 请求使用独立的实例：同一个值在整个请求（包括多轮工具调用）中始终对应同一个占位符，
+// Agent 返回的内容中的占位符可以还原为原始值
+type PIIRedactor struct {
+	mu           sync.Mutex
+	placeholders map[string]string // 原始值 -> 占位符
+	originals    map[string]string // 占位符 -> 原始值
+	counters     map[string]int
+}
+
+// newPIIRedactor 创建脱敏器，未启用脱敏时返回 nil（nil 脱敏器的方法原样返回输入）
+func newPIIRedactor() *PIIRedactor {
+	if !piiRedactionEnabled() {
+		return nil
+	}
+	return newStrictPIIRedactor()
+}
+
+// newStrictPIIRedactor 创建不受 PII_REDACTION 影响的脱敏器，用于导出等离开本系统的数据
+func newStrictPIIRedactor() *PIIRedactor {
+	return &PIIRedactor{
+		placeholders: make(map[string]string),
+		originals:    make(map[string]string),
+		counters:     make(map[string]int),
+	}
+}
+
+// Redact 替换文本中的敏感信息
+func (r *PIIRedactor) Redact(text string) string {
+	if r == nil || text == "" {
+		return text
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, p := range piiPatterns {
+		text = p.re.ReplaceAllStringFunc(text, func(match string) string {
+			if p.valid != nil && !p.valid(match) {
+				return match
+			}
+			if placeholder, ok := r.placeholders[match]; ok {
+				return placeholder
+			}
+			r.counters[p.kind]++
+			placeholder := fmt.Sprintf("[%s_%d]", p.kind, r.counters[p.kind])
+			r.placeholders[match] = placeholder
+			r.originals[placeholder] = match
+			return placeholder
+		})
+	}
+	return text
+}
+
+// Restore 将文本中的占位符还原为原始值
+func (r *PIIRedactor) Restore(text string) string {
+	if r == nil || text == "" {
+		return text
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.originals) == 0 {
+		return text
+	}
+	pairs := make([]string, 0, len(r.originals)*2)
+	for placeholder, original := range r.originals {
+		pairs = append(pairs, placeholder, original)
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// RedactContents 对 Agent 调用内容中的所有字符串做脱敏
+// 内容先序列化为 JSON 再逐个字符串字段替换，工具调用结果等结构化内容同样会被处理
+func (r *PIIRedactor) RedactContents(contents []AgentCallContent) ([]AgentCallContent, error) {
+	if r == nil {
+		return contents, nil
+	}
+
+	redacted := make([]AgentCallContent, 0, len(contents))
+	for _, content := range contents {
+		data, err := json.Marshal(content.Content)
+		if err != nil {
+			return nil, fmt.Errorf("序列化调用内容失败: %w", err)
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			return nil, fmt.Errorf("解析调用内容失败: %w", err)
+		}
+
+		redacted = append(redacted, AgentCallContent{
+			Type:    content.Type,
+			Content: r.redactValue(value),
+		})
+	}
+	return redacted, nil
+}
+
+// redactValue 递归替换 JSON 值中的敏感信息，以数字形式出现的手机号、卡号等替换为字符串占位符
+func (r *PIIRedactor) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return r.Redact(v)
+	case json.Number:
+		if redacted := r.Redact(v.String()); redacted != v.String() {
+			return redacted
+		}
+		return v
+	case []interface{}:
+		for i := range v {
+			v[i] = r.redactValue(v[i])
+		}
+		return v
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = r.redactValue(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// containsPII 文本中是否包含敏感信息，不受 PII_REDACTION 影响
+func containsPII(text string) bool {
+	return newStrictPIIRedactor().Redact(text) != text
+}
+
+// redactForLog 对写入日志的文本做一次性脱敏
+func redactForLog(text string) string {
+	return newPIIRedactor().Redact(text)
+}
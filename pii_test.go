@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestPIIRedactorRedact(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "无敏感信息", text: "请问什么时候发货", want: "请问什么时候发货"},
+		{name: "手机号", text: "电话 13812345678", want: "电话 [PHONE_1]"},
+		{name: "带国家码的手机号", text: "+86 13812345678", want: "[PHONE_1]"},
+		{name: "座机", text: "座机 010-12345678", want: "座机 [PHONE_1]"},
+		{name: "同一号码使用同一占位符", text: "13812345678 或 13812345678", want: "[PHONE_1] 或 [PHONE_1]"},
+		{name: "不同号码分别编号", text: "13812345678 或 13987654321", want: "[PHONE_1] 或 [PHONE_2]"},
+		{name: "邮箱", text: "邮箱 test.user@example.com", want: "邮箱 [EMAIL_1]"},
+		{name: "身份证号", text: "身份证 11010119900307123X", want: "身份证 [ID_CARD_1]"},
+		{name: "银行卡号", text: "卡号 4111 1111 1111 1111", want: "卡号 [BANK_CARD_1]"},
+		{name: "Luhn 校验失败的卡号", text: "卡号 4111 1111 1111 1112", want: "卡号 4111 1111 1111 1112"},
+		{name: "地址", text: "地址：北京市朝阳区建国路88号", want: "地址：[ADDRESS_1]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newStrictPIIRedactor()
+			got := r.Redact(tt.text)
+			if got != tt.want {
+				t.Errorf("Redact(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+			if restored := r.Restore(got); restored != tt.text {
+				t.Errorf("Restore(%q) = %q, want %q", got, restored, tt.text)
+			}
+		})
+	}
+}
+
+func TestPIIRedactorPlaceholdersAcrossCalls(t *testing.T) {
+	r := newStrictPIIRedactor()
+	first := r.Redact("客户电话 13812345678")
+	second := r.Redact("再确认一下 13812345678")
+	if first != "客户电话 [PHONE_1]" || second != "再确认一下 [PHONE_1]" {
+		t.Errorf("同一请求中的相同号码应使用同一占位符: %q, %q", first, second)
+	}
+	if got := r.Restore("已联系 [PHONE_1]"); got != "已联系 13812345678" {
+		t.Errorf("Restore = %q", got)
+	}
+}
+
+func TestPIIRedactorRedactContents(t *testing.T) {
+	r := newStrictPIIRedactor()
+	contents := []AgentCallContent{
+		{Type: "text", Content: "电话 13812345678"},
+		{Type: "profile", Content: map[string]interface{}{"phone": json.Number("13812345678"), "count": 3}},
+	}
+	got, err := r.RedactContents(contents)
+	if err != nil {
+		t.Fatalf("RedactContents: %v", err)
+	}
+	want := []AgentCallContent{
+		{Type: "text", Content: "电话 [PHONE_1]"},
+		{Type: "profile", Content: map[string]interface{}{"phone": "[PHONE_1]", "count": json.Number("3")}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RedactContents = %#v, want %#v", got, want)
+	}
+}
+
+func TestPIIRedactorDisabled(t *testing.T) {
+	t.Setenv("PII_REDACTION", "false")
+	r := newPIIRedactor()
+	if r != nil {
+		t.Fatal("PII_REDACTION=false 时应返回 nil")
+	}
+	text := "电话 13812345678"
+	if got := r.Redact(text); got != text {
+		t.Errorf("nil 脱敏器 Redact = %q, want %q", got, text)
+	}
+	if got := r.Restore("[PHONE_1]"); got != "[PHONE_1]" {
+		t.Errorf("nil 脱敏器 Restore = %q", got)
+	}
+	if !containsPII(text) {
+		t.Error("containsPII 不应受 PII_REDACTION 影响")
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"net/http"
 	"os"
 	"strings"
-	"sync"
 	"time"
 
 	"wework-sdk/wework"
@@ -324,7 +323,7 @@ func (c *WeComClient) linkSuggestionToMessage(agentID, chatID, msgID, content st
 			zap.String("agent_id", agentID),
 			zap.String("chat_id", chatID),
 			zap.String("msg_id", msgID),
-			zap.String("content", content))
+			zap.String("content", redactForLog(content)))
 		return
 	}
 
@@ -365,6 +364,13 @@ func (c *WeComClient) linkSuggestionToMessage(agentID, chatID, msgID, content st
 		zap.Float64("similarity", suggestion.Similarity),
 		zap.String("match_type", suggestion.MatchType),
 		zap.Int("matched_count", len(suggestions)))
+
+	// 客服发送的内容与建议不同时记录修改
+	if suggestion.MatchType != "exact_original" && suggestion.MatchType != "exact_translated" {
+		if err := recordSuggestionDiff(suggestion.SuggestionID, content, diffSourceLink); err != nil {
+			logger.Warn("记录 suggestion 差异失败", zap.String("suggestion_id", suggestion.SuggestionID), zap.Error(err))
+		}
+	}
 }
 
 // recognizeVoiceWithThirdParty 使用第三方语音识别服务
@@ -442,6 +448,21 @@ func recognizeVoiceWithThirdParty(apiURL string, voiceData []byte) (string, erro
 	return text, nil
 }
 
+// messageParty 判断解密后的消息是否由客服发送，并返回消息所属的会话 chatId
+// 客户发送的消息 from 为客户 ID（即 chatId）；客服发送的消息 from 为客服自己，会话对象是接收方 tolist[0]。
+// 若像客户消息一样取 from 作为 chatId，客服消息会因与当前会话不匹配被跳过，无法关联 suggestion，也无法记入会话历史。
+// 原先的 action="send" 判断在两个分支中都只比较 from 与 AgentID，结果与只比较 from 相同，因此不再单独判断
+func messageParty(msg map[string]interface{}, agentID string) (chatID string, isAgent bool) {
+	from, _ := msg["from"].(string)
+	if from == "" || from != agentID {
+		return from, false
+	}
+	if tolist, ok := msg["tolist"].([]interface{}); ok && len(tolist) > 0 {
+		chatID, _ = tolist[0].(string)
+	}
+	return chatID, true
+}
+
 // pollChatMessages 轮询获取会话消息
 func (c *WeComClient) pollChatMessages() {
 	c.mu.Lock()
@@ -551,11 +572,8 @@ func (c *WeComClient) pollChatMessages() {
 			continue
 		}
 
-		// 获取 chatId
-		chatID := ""
-		if id, ok := decryptedMsgData["from"].(string); ok {
-			chatID = id
-		}
+		// 判断消息发送方并获取 chatId
+		chatID, isAgentMessage := messageParty(decryptedMsgData, c.AgentID)
 
 		// 如果 chatID 不匹配，跳过此消息
 		if chatID != "" && chatID != c.ChatID {
@@ -640,7 +658,7 @@ func (c *WeComClient) pollChatMessages() {
 			} else {
 				// 使用转换后的文本
 				msgContent = []byte(text)
-				logger.Info("客服语音转文本成功", zap.String("agent_id", c.AgentID), zap.String("text", text))
+				logger.Info("客服语音转文本成功", zap.String("agent_id", c.AgentID), zap.String("text", redactForLog(text)))
 			}
 		default:
 			logger.Debug("客服收到不支持的消息类型，跳过", zap.String("agent_id", c.AgentID), zap.String("msg_type", msgType))
@@ -662,38 +680,40 @@ func (c *WeComClient) pollChatMessages() {
 			msgTime = time.Now()
 		}
 
-		// 判断是否是客服发送的消息
-		// 方法1: 通过 action 字段判断，action="send" 表示发送的消息
-		// 方法2: 通过 from 字段判断，如果 from 等于 AgentID，则是客服发送的消息
-		isAgentMessage := false
-		if action, ok := decryptedMsgData["action"].(string); ok && action == "send" {
-			// 如果 action 是 "send"，还需要确认是客服发送的
-			// 检查 from 字段是否等于 AgentID
-			if from, ok := decryptedMsgData["from"].(string); ok {
-				if from == c.AgentID {
-					isAgentMessage = true
-				}
-			}
-		} else {
-			// 如果没有 action 字段，通过 from 字段判断
-			if from, ok := decryptedMsgData["from"].(string); ok {
-				// 如果 from 字段的值是 AgentID，说明是客服发送的消息
-				if from == c.AgentID {
-					isAgentMessage = true
-				}
+		if chatID == "" {
+			chatID = c.ChatID // 如果没有 chatID，使用当前会话的 chatID
+		}
+
+		// 记录会话历史，作为后续 AI 分析和会话摘要的上下文
+		entry := ChatHistoryEntry{
+			MsgID:   msgID,
+			Role:    roleCustomer,
+			Content: string(msgContent),
+			Time:    msgTime,
+		}
+		if isAgentMessage {
+			entry.Role = roleAgent
+			entry.AgentID = c.AgentID
+		}
+		isNewMessage := recordChatMessage(chatID, entry)
+
+		// 客服发送的消息只做 suggestion 关联（异步），不触发 AI 协助：AI 协助针对客户提问，
+		// 对客服自己的回复生成建议没有意义；客服回复的分析由侧边栏上报 agent_message_sent 触发
+		// 关联只依赖 suggestionStore，memory 后端也能关联；差异记录、缓存学习等依赖数据库的步骤在 db 为 nil 时各自跳过
+		if isAgentMessage {
+			if msgID != "" && len(msgContent) > 0 && suggestionStore != nil {
+				go c.linkSuggestionToMessage(c.AgentID, chatID, msgID, string(msgContent), msgTime)
 			}
+			continue
 		}
 
-		// 如果是客服发送的消息，异步处理 suggestion 关联
-		if isAgentMessage && msgID != "" && len(msgContent) > 0 && db != nil {
-			contentStr := string(msgContent)
-			go c.linkSuggestionToMessage(c.AgentID, chatID, msgID, contentStr, msgTime)
+		// 客户消息的情绪分析，愤怒、流失倾向过高或出现投诉关键词时通知主管
+		// 只分析首次记录的消息：重连后轮询序号从 0 开始，重新拉取的历史消息不重复计入
+		if isNewMessage {
+			c.trackSentiment(chatID, msgID, string(msgContent))
 		}
 
 		// 按 chatId 聚合消息
-		if chatID == "" {
-			chatID = c.ChatID // 如果没有 chatID，使用当前会话的 chatID
-		}
 		chatMessages[chatID] = append(chatMessages[chatID], MessageInfo{
 			Content: msgContent,
 			MsgID:   msgID,
@@ -702,28 +722,27 @@ func (c *WeComClient) pollChatMessages() {
 	}
 
 	// 并发发送每个 chatId 的聚合消息给 AI
-	var wg sync.WaitGroup
+	// 不等待 AI 请求完成：下一次轮询拉到同一会话的新消息时会取消并取代旧请求
 	for chatID, messages := range chatMessages {
 		if len(messages) == 0 {
 			continue
 		}
 
-		wg.Add(1)
 		go func(cid string, msgs []MessageInfo) {
-			defer wg.Done()
 
-			// 聚合多条消息内容
-			var aggregatedContent []byte
-			if len(msgs) == 1 {
-				// 如果只有一条消息，直接使用
-				aggregatedContent = msgs[0].Content
-			} else {
-				// 多条消息，用换行符拼接
-				contents := make([]string, 0, len(msgs))
-				for _, msg := range msgs {
-					contents = append(contents, string(msg.Content))
-				}
-				aggregatedContent = []byte(strings.Join(contents, "\n"))
+			// 聚合多条消息内容，多条消息用换行符拼接
+			contents := make([]string, 0, len(msgs))
+			for _, msg := range msgs {
+				contents = append(contents, string(msg.Content))
+			}
+			// WeComMessage.Content 为 json.RawMessage，直接放入纯文本是无效 JSON，
+			// 序列化 Agent 请求时会失败，因此单条和多条消息都编码为 JSON 字符串，由 contentText 解码
+			aggregatedContent, _ := json.Marshal(strings.Join(contents, "\n"))
+
+			// 识别客户消息的语言，双语模式下用于翻译
+			language := ""
+			if bilingualEnabled() {
+				language = detectLanguage(strings.Join(contents, "\n"))
 			}
 
 			// 使用第一条消息的 msgID（或可以合并所有 msgID）
@@ -734,11 +753,12 @@ func (c *WeComClient) pollChatMessages() {
 
 			// 触发 AI 协助请求
 			aiMsg := WeComMessage{
-				Type:    "ai_assistance_request",
-				AgentID: c.AgentID,
-				ChatID:  cid,
-				Content: aggregatedContent,
-				MsgID:   msgID,
+				Type:     "ai_assistance_request",
+				AgentID:  c.AgentID,
+				ChatID:   cid,
+				Content:  aggregatedContent,
+				MsgID:    msgID,
+				Language: language,
 			}
 
 			logger.Info("客服发送聚合消息给 AI", zap.String("agent_id", c.AgentID), zap.String("chat_id", cid), zap.Int("message_count", len(msgs)))
@@ -746,9 +766,6 @@ func (c *WeComClient) pollChatMessages() {
 		}(chatID, messages)
 	}
 
-	// 等待所有 AI 请求完成（可选，根据需求决定是否等待）
-	wg.Wait()
-
 	// 更新 seq
 	c.mu.Lock()
 	c.pollSeq = maxSeq
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestMessageParty(t *testing.T) {
+	tests := []struct {
+		name        string
+		msg         map[string]interface{}
+		wantChatID  string
+		wantIsAgent bool
+	}{
+		{
+			name:       "客户消息取 from 作为 chatId",
+			msg:        map[string]interface{}{"from": "customer-1", "tolist": []interface{}{"agent-1"}},
+			wantChatID: "customer-1",
+		},
+		{
+			name:        "客服消息取 tolist[0] 作为 chatId",
+			msg:         map[string]interface{}{"from": "agent-1", "tolist": []interface{}{"customer-1"}},
+			wantChatID:  "customer-1",
+			wantIsAgent: true,
+		},
+		{
+			name:        "action=send 与无 action 判断结果一致",
+			msg:         map[string]interface{}{"action": "send", "from": "agent-1", "tolist": []interface{}{"customer-1"}},
+			wantChatID:  "customer-1",
+			wantIsAgent: true,
+		},
+		{
+			name:       "action=send 但发送方不是客服",
+			msg:        map[string]interface{}{"action": "send", "from": "customer-1"},
+			wantChatID: "customer-1",
+		},
+		{
+			name:        "客服消息缺少 tolist",
+			msg:         map[string]interface{}{"from": "agent-1"},
+			wantIsAgent: true,
+		},
+		{
+			name: "缺少 from",
+			msg:  map[string]interface{}{"tolist": []interface{}{"customer-1"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chatID, isAgent := messageParty(tt.msg, "agent-1")
+			if chatID != tt.wantChatID || isAgent != tt.wantIsAgent {
+				t.Errorf("messageParty = (%q, %v), want (%q, %v)", chatID, isAgent, tt.wantChatID, tt.wantIsAgent)
+			}
+		})
+	}
+}
+
+func TestLinkSuggestionToMessageWithoutDatabase(t *testing.T) {
+	logger = zap.NewNop()
+	store := newMemorySuggestionStore()
+	suggestionStore = store
+	t.Cleanup(func() { suggestionStore = nil })
+
+	now := time.Now()
+	if err := store.CreateSuggestion(Suggestion{
+		SuggestionID:    "s1",
+		AgentID:         "agent-1",
+		ChatID:          "customer-1",
+		OriginalContent: "您好，您的订单已经发货了，请注意查收",
+		CreatedAt:       now.Add(-time.Minute),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// db 为 nil 时仍应完成关联，改写后的内容触发的差异记录直接跳过
+	c := &WeComClient{AgentID: "agent-1"}
+	c.linkSuggestionToMessage("agent-1", "customer-1", "msg-1", "您好，您的订单已经发货了，请注意查收哦", now)
+
+	got := store.suggestions["s1"]
+	if got.MsgID != "msg-1" || got.Similarity <= 0 {
+		t.Errorf("MsgID = %q, Similarity = %v, 应关联到 msg-1", got.MsgID, got.Similarity)
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// AI 协助请求的限流范围
+const (
+	throttleScopeAgent   = "agent"   // 单个客服
+	throttleScopeChat    = "chat"    // 单个会话
+	throttleScopeBackend = "backend" // 单个 Agent 后端
+	throttleScopeCorp    = "corp"    // 企业每日配额
+)
+
+// currentCorpID 当前部署的企业ID
+func currentCorpID() string {
+	return os.Getenv("WECOM_CORP_ID")
+}
+
+// rateLimitPerMinute 获取限流范围每分钟允许的 Agent 调用数，0 表示不限流
+func rateLimitPerMinute(scope string) int {
+	defaults := map[string]int{
+		throttleScopeAgent:   60,
+		throttleScopeChat:    20,
+		throttleScopeBackend: 300,
+	}
+	return getEnvInt("AI_RATE_LIMIT_"+strings.ToUpper(scope), defaults[scope])
+}
+
+// dailyQuota 每个企业每天允许的 Agent 调用数，0 表示不限制
+func dailyQuota() int {
+	return getEnvInt("AI_DAILY_QUOTA", 0)
+}
+
+// tokenBucket 令牌桶，容量为每分钟的请求数，按速率匀速补充
+type tokenBucket struct {
+	tokens float64
+	limit  int // 每分钟请求数，同时作为桶容量
+	last   time.Time
+}
+
+// refill 按经过的时间补充令牌
+func (b *tokenBucket) refill(now time.Time, limit int) {
+	if b.limit != limit {
+		// 配置变化时按新容量截断
+		b.limit = limit
+		b.tokens = math.Min(b.tokens, float64(limit))
+	}
+	elapsed := now.Sub(b.last).Minutes()
+	b.tokens = math.Min(float64(b.limit), b.tokens+elapsed*float64(b.limit))
+	b.last = now
+}
+
+// retryAfter 距离补充一个令牌的时间
+func (b *tokenBucket) retryAfter() time.Duration {
+	missing := 1 - b.tokens
+	if missing <= 0 || b.limit <= 0 {
+		return 0
+	}
+	return time.Duration(missing / float64(b.limit) * float64(time.Minute))
+}
+
+// rateLimitKey 限流的范围和对象
+type rateLimitKey struct {
+	Scope string
+	ID    string
+}
+
+// ThrottleError AI 协助请求被限流
+type ThrottleError struct {
+	Scope      string
+	RetryAfter time.Duration
+}
+
+func (e *ThrottleError) Error() string {
+	if e.Scope == throttleScopeCorp {
+		return "已达到今日 AI 协助配额"
+	}
+	return fmt.Sprintf("AI 协助请求过于频繁（%s），请 %.0f 秒后重试", e.Scope, math.Ceil(e.RetryAfter.Seconds()))
+}
+
+// RateLimiter 按客服、会话和后端分别限流的令牌桶集合
+type RateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[rateLimitKey]*tokenBucket
+	throttled map[string]int64 // 各范围累计被限流的请求数
+}
+
+var aiRateLimiter = &RateLimiter{
+	buckets:   make(map[rateLimitKey]*tokenBucket),
+	throttled: make(map[string]int64),
+}
+
+// Allow 所有范围都有可用令牌时各扣除一个令牌，否则不扣除并返回限流原因
+func (l *RateLimiter) Allow(keys ...rateLimitKey) *ThrottleError {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var throttle *ThrottleError
+	active := make([]*tokenBucket, 0, len(keys))
+	for _, key := range keys {
+		limit := rateLimitPerMinute(key.Scope)
+		if limit <= 0 {
+			continue
+		}
+		bucket, ok := l.buckets[key]
+		if !ok {
+			bucket = &tokenBucket{tokens: float64(limit), limit: limit, last: now}
+			l.buckets[key] = bucket
+		}
+		bucket.refill(now, limit)
+		if bucket.tokens < 1 {
+			throttle = &ThrottleError{Scope: key.Scope, RetryAfter: bucket.retryAfter()}
+			break
+		}
+		active = append(active, bucket)
+	}
+
+	if throttle != nil {
+		l.throttled[throttle.Scope]++
+		return throttle
+	}
+	for _, bucket := range active {
+		bucket.tokens--
+	}
+	return nil
+}
+
+// recordThrottled 记录被限流的请求数
+func (l *RateLimiter) recordThrottled(scope string) {
+	l.mu.Lock()
+	l.throttled[scope]++
+	l.mu.Unlock()
+}
+
+// cleanup 清理已补满的令牌桶，避免会话数增长导致内存占用持续增加
+func (l *RateLimiter) cleanup() {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, bucket := range l.buckets {
+		bucket.refill(now, rateLimitPerMinute(key.Scope))
+		if bucket.tokens >= float64(bucket.limit) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RunCleanup 定期清理令牌桶
+func (l *RateLimiter) RunCleanup() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		l.cleanup()
+	}
+}
+
+// bucketUsage 令牌桶使用情况
+type bucketUsage struct {
+	Scope     string  `json:"scope"`
+	ID        string  `json:"id"`
+	Limit     int     `json:"limit_per_minute"`
+	Available float64 `json:"available"`
+}
+
+// Usage 获取所有令牌桶的使用情况和被限流的请求数
+func (l *RateLimiter) Usage() ([]bucketUsage, map[string]int64) {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	usage := make([]bucketUsage, 0, len(l.buckets))
+	for key, bucket := range l.buckets {
+		bucket.refill(now, rateLimitPerMinute(key.Scope))
+		usage = append(usage, bucketUsage{
+			Scope:     key.Scope,
+			ID:        key.ID,
+			Limit:     bucket.limit,
+			Available: math.Floor(bucket.tokens*100) / 100,
+		})
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Scope != usage[j].Scope {
+			return usage[i].Scope < usage[j].Scope
+		}
+		return usage[i].Available < usage[j].Available
+	})
+
+	throttled := make(map[string]int64, len(l.throttled))
+	for scope, count := range l.throttled {
+		throttled[scope] = count
+	}
+	return usage, throttled
+}
+
+// AIQuotaUsage ai_quota_usage 表模型，企业每日 Agent 调用数，多实例共享
+type AIQuotaUsage struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"-"`
+	CorpID    string    `gorm:"type:varchar(100);uniqueIndex:idx_ai_quota_corp_day;not null" json:"corp_id"`
+	Day       string    `gorm:"type:varchar(10);uniqueIndex:idx_ai_quota_corp_day;not null" json:"day"` // 2006-01-02，服务器本地时区
+	Count     int       `json:"count"`
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (AIQuotaUsage) TableName() string {
+	return "ai_quota_usage"
+}
+
+// quotaDay 配额计数的日期
+func quotaDay(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// dailyUsage 查询企业当天已使用的请求数
+func dailyUsage(corpID string) (int, error) {
+	var usage AIQuotaUsage
+	if err := db.Where("corp_id = ? AND day = ?", corpID, quotaDay(time.Now())).Limit(1).Find(&usage).Error; err != nil {
+		return 0, fmt.Errorf("查询 AI 配额使用量失败: %w", err)
+	}
+	return usage.Count, nil
+}
+
+// consumeDailyQuota 扣除企业当天的一次配额，已用完时返回限流错误
+// 计数在一条条件 upsert 中完成，多实例并发时也不会超出配额
+func consumeDailyQuota(corpID string) *ThrottleError {
+	quota := dailyQuota()
+	if quota <= 0 || db == nil {
+		return nil
+	}
+
+	now := time.Now()
+	result := db.Exec(`INSERT INTO ai_quota_usage (corp_id, day, count, created_at, updated_at)
+		VALUES (?, ?, 1, ?, ?)
+		ON CONFLICT (corp_id, day) DO UPDATE SET count = ai_quota_usage.count + 1, updated_at = excluded.updated_at
+		WHERE ai_quota_usage.count < ?`,
+		corpID, quotaDay(now), now, now, quota)
+	if result.Error != nil {
+		// 配额统计不可用时放行，避免数据库故障导致 AI 协助全部中断
+		logger.Warn("累加 AI 配额使用量失败，放行请求", zap.String("corp_id", corpID), zap.Error(result.Error))
+		return nil
+	}
+
+	// 当天计数已达到配额时冲突更新不生效
+	if result.RowsAffected == 0 {
+		tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+		aiRateLimiter.recordThrottled(throttleScopeCorp)
+		return &ThrottleError{Scope: throttleScopeCorp, RetryAfter: tomorrow.Sub(now)}
+	}
+	return nil
+}
+
+// throttleAIRequest 检查 Agent 调用是否被限流，依次检查客服、会话、后端的速率和企业每日配额
+func throttleAIRequest(agentID, chatID, backend string) *ThrottleError {
+	if throttle := aiRateLimiter.Allow(
+		rateLimitKey{Scope: throttleScopeAgent, ID: agentID},
+		rateLimitKey{Scope: throttleScopeChat, ID: chatID},
+		rateLimitKey{Scope: throttleScopeBackend, ID: backend},
+	); throttle != nil {
+		return throttle
+	}
+	return consumeDailyQuota(currentCorpID())
+}
+
+// notifyAIThrottled 通知侧边栏 AI 协助请求被限流
+func (c *WeComClient) notifyAIThrottled(chatID, msgID string, throttle *ThrottleError) {
+	logger.Warn("AI协助请求被限流",
+		zap.String("agent_id", c.AgentID),
+		zap.String("chat_id", chatID),
+		zap.String("scope", throttle.Scope),
+		zap.Duration("retry_after", throttle.RetryAfter))
+
+	if err := c.SendMessage(map[string]interface{}{
+		"type":        "ai_throttled",
+		"agent_id":    c.AgentID,
+		"chat_id":     chatID,
+		"msg_id":      msgID,
+		"scope":       throttle.Scope,
+		"reason":      throttle.Error(),
+		"retry_after": math.Ceil(throttle.RetryAfter.Seconds()),
+	}); err != nil {
+		logger.Error("发送 ai_throttled 消息失败", zap.String("agent_id", c.AgentID), zap.Error(err))
+	}
+}
+
+// AIUsageHandler 查询 AI 协助请求的限流状态和配额使用量
+// GET /api/ai-usage
+func AIUsageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	buckets, throttled := aiRateLimiter.Usage()
+	limits := map[string]int{
+		throttleScopeAgent:   rateLimitPerMinute(throttleScopeAgent),
+		throttleScopeChat:    rateLimitPerMinute(throttleScopeChat),
+		throttleScopeBackend: rateLimitPerMinute(throttleScopeBackend),
+	}
+
+	corpID := currentCorpID()
+	daily := map[string]interface{}{
+		"corp_id": corpID,
+		"day":     quotaDay(time.Now()),
+		"quota":   dailyQuota(),
+		"used":    0,
+	}
+	if db != nil {
+		used, err := dailyUsage(corpID)
+		if err != nil {
+			logger.Error("查询 AI 配额使用量失败", zap.Error(err))
+			writeJSONError(w, http.StatusInternalServerError, "查询 AI 配额使用量失败")
+			return
+		}
+		daily["used"] = used
+	}
+
+	// 令牌桶只在本实例内存中，多实例部署时各实例分别限流
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"limits_per_minute": limits,
+		"buckets":           buckets,
+		"throttled":         throttled,
+		"daily":             daily,
+	})
+}
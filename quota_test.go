@@ -0,0 +1,114 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		buckets:   make(map[rateLimitKey]*tokenBucket),
+		throttled: make(map[string]int64),
+	}
+}
+
+func TestTokenBucketRefill(t *testing.T) {
+	start := time.Now()
+	b := &tokenBucket{tokens: 0, limit: 60, last: start}
+
+	b.refill(start.Add(30*time.Second), 60)
+	if b.tokens != 30 {
+		t.Errorf("30 秒后 tokens = %v, want 30", b.tokens)
+	}
+	if got := b.retryAfter(); got != 0 {
+		t.Errorf("有可用令牌时 retryAfter = %v, want 0", got)
+	}
+
+	b.refill(start.Add(5*time.Minute), 60)
+	if b.tokens != 60 {
+		t.Errorf("补充不应超过容量，tokens = %v", b.tokens)
+	}
+
+	// 配置降低时按新容量截断
+	b.refill(start.Add(5*time.Minute), 10)
+	if b.tokens != 10 || b.limit != 10 {
+		t.Errorf("tokens = %v, limit = %d, want 10, 10", b.tokens, b.limit)
+	}
+
+	b.tokens = 0.5
+	if got := b.retryAfter(); got != 3*time.Second {
+		t.Errorf("retryAfter = %v, want 3s", got)
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	t.Setenv("AI_RATE_LIMIT_AGENT", "3")
+	t.Setenv("AI_RATE_LIMIT_CHAT", "2")
+	t.Setenv("AI_RATE_LIMIT_BACKEND", "0")
+	l := newTestRateLimiter()
+
+	keys := func(chatID string) []rateLimitKey {
+		return []rateLimitKey{
+			{Scope: throttleScopeAgent, ID: "a1"},
+			{Scope: throttleScopeChat, ID: chatID},
+			{Scope: throttleScopeBackend, ID: "http://agent"},
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if throttle := l.Allow(keys("c1")...); throttle != nil {
+			t.Fatalf("第 %d 次请求不应被限流: %v", i+1, throttle)
+		}
+	}
+	throttle := l.Allow(keys("c1")...)
+	if throttle == nil || throttle.Scope != throttleScopeChat || throttle.RetryAfter <= 0 {
+		t.Fatalf("会话令牌用完时应按会话限流，实际 %+v", throttle)
+	}
+
+	// 会话被限流时不扣除客服的令牌，客服仍可处理其他会话
+	if throttle := l.Allow(keys("c2")...); throttle != nil {
+		t.Fatalf("其他会话不应被限流: %v", throttle)
+	}
+	throttle = l.Allow(keys("c3")...)
+	if throttle == nil || throttle.Scope != throttleScopeAgent {
+		t.Fatalf("客服令牌用完时应按客服限流，实际 %+v", throttle)
+	}
+
+	// 限流值为 0 的范围不创建令牌桶
+	if _, ok := l.buckets[rateLimitKey{Scope: throttleScopeBackend, ID: "http://agent"}]; ok {
+		t.Error("不限流的范围不应创建令牌桶")
+	}
+
+	_, throttled := l.Usage()
+	if throttled[throttleScopeChat] != 1 || throttled[throttleScopeAgent] != 1 {
+		t.Errorf("throttled = %v", throttled)
+	}
+}
+
+func TestConsumeDailyQuota(t *testing.T) {
+	newTestSQLiteStore(t)
+	t.Setenv("AI_DAILY_QUOTA", "2")
+
+	for i := 0; i < 2; i++ {
+		if throttle := consumeDailyQuota("corp-1"); throttle != nil {
+			t.Fatalf("第 %d 次请求不应超出配额: %v", i+1, throttle)
+		}
+	}
+	throttle := consumeDailyQuota("corp-1")
+	if throttle == nil || throttle.Scope != throttleScopeCorp || throttle.RetryAfter <= 0 || throttle.RetryAfter > 24*time.Hour {
+		t.Fatalf("配额用完时应返回企业限流，实际 %+v", throttle)
+	}
+	if used, err := dailyUsage("corp-1"); err != nil || used != 2 {
+		t.Errorf("dailyUsage = %d, %v, 超出配额的请求不应计数", used, err)
+	}
+
+	// 配额按企业独立计数
+	if throttle := consumeDailyQuota("corp-2"); throttle != nil {
+		t.Errorf("其他企业不应被限流: %v", throttle)
+	}
+
+	t.Setenv("AI_DAILY_QUOTA", "0")
+	if throttle := consumeDailyQuota("corp-1"); throttle != nil {
+		t.Errorf("未设置配额时不应限流: %v", throttle)
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// retentionLockKey 清理任务使用的 PostgreSQL advisory lock，多实例部署时同一时间只有一个实例执行清理
+const retentionLockKey int64 = 0x73696465726574 // "sideret"
+
+// retentionPolicy 一张表的清理规则
+type retentionPolicy struct {
+	Table      string
+	TimeColumn string // 按该列判断是否过期
+	CorpColumn string // 按企业区分保留期的列，为空时整张表属于当前企业
+}
+
+// retentionPolicies 支持按保留期清理的表
+var retentionPolicies = []retentionPolicy{
+	{Table: "suggestions", TimeColumn: "created_at"},
+	{Table: "suggestion_diffs", TimeColumn: "created_at"},
+	{Table: "chat_messages", TimeColumn: "msg_time"},
+	{Table: "chat_summaries", TimeColumn: "updated_at"},
+	{Table: "reply_analyses", TimeColumn: "created_at"},
+	{Table: "ai_calls", TimeColumn: "created_at"},
+	{Table: "tool_invocations", TimeColumn: "created_at"},
+	{Table: "conversation_tags", TimeColumn: "updated_at"},
+	{Table: "conversation_sentiments", TimeColumn: "updated_at"},
+	{Table: "escalations", TimeColumn: "created_at"},
+	{Table: "agent_sessions", TimeColumn: "expire_at"},
+	{Table: "ai_quota_usage", TimeColumn: "updated_at", CorpColumn: "corp_id"},
+	{Table: "suggestion_cache", TimeColumn: "expires_at", CorpColumn: "corp_id"},
+}
+
+// parseRetention 解析保留期，支持 Go 时长格式和以 d 结尾的天数（如 90d）
+func parseRetention(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("无效的保留期: %s", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("无效的保留期: %s", value)
+	}
+	return d, nil
+}
+
+// retentionTTL 表在企业下的保留期，0 表示永久保留
+// 优先读取 RETENTION_CORP_<企业ID>_<表名>，其次 RETENTION_<表名>，如 RETENTION_AI_CALLS=30d
+func retentionTTL(table, corpID string) time.Duration {
+	keys := []string{"RETENTION_" + strings.ToUpper(table)}
+	if corpID != "" {
+		keys = append([]string{"RETENTION_CORP_" + strings.ToUpper(corpID) + "_" + strings.ToUpper(table)}, keys...)
+	}
+	for _, key := range keys {
+		value := os.Getenv(key)
+		if value == "" {
+			continue
+		}
+		ttl, err := parseRetention(value)
+		if err != nil {
+			logger.Warn("保留期配置错误，该表不清理", zap.String("key", key), zap.Error(err))
+			return 0
+		}
+		return ttl
+	}
+	return 0
+}
+
+// retentionTableStats 一张表的清理统计
+type retentionTableStats struct {
+	Table      string     `json:"table"`
+	Purged     int64      `json:"purged"`      // 累计删除的行数
+	Archived   int64      `json:"archived"`    // 累计归档的行数
+	LastPurged int64      `json:"last_purged"` // 最近一次清理删除的行数
+	LastRunAt  *time.Time `json:"last_run_at"`
+	LastError  string     `json:"last_error,omitempty"`
+}
+
+// RetentionJob 按保留期定期清理过期数据，统计保存在本实例内存中
+type RetentionJob struct {
+	mu           sync.Mutex
+	running      bool
+	runs         int64
+	lastRunAt    *time.Time
+	lastDuration time.Duration
+	tables       map[string]*retentionTableStats
+}
+
+var retentionJob = &RetentionJob{
+	tables: make(map[string]*retentionTableStats),
+}
+
+// Run 按 RETENTION_INTERVAL（默认 1h）定期执行清理
+func (j *RetentionJob) Run() {
+	ticker := time.NewTicker(getEnvDuration("RETENTION_INTERVAL", time.Hour))
+	defer ticker.Stop()
+	for range ticker.C {
+		j.RunOnce(context.Background())
+	}
+}
+
+// RunOnce 执行一次清理，已有清理在进行或其他实例持有锁时跳过，返回是否执行
+func (j *RetentionJob) RunOnce(ctx context.Context) bool {
+	if db == nil {
+		return false
+	}
+
+	j.mu.Lock()
+	if j.running {
+		j.mu.Unlock()
+		return false
+	}
+	j.running = true
+	j.mu.Unlock()
+	defer func() {
+		j.mu.Lock()
+		j.running = false
+		j.mu.Unlock()
+	}()
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		logger.Warn("获取数据库连接失败，跳过数据清理", zap.Error(err))
+		return false
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		logger.Warn("获取数据库连接失败，跳过数据清理", zap.Error(err))
+		return false
+	}
+	defer conn.Close()
+
+	// SQLite 只有单个进程访问，不需要跨实例加锁
+	if usingPostgres() {
+		var locked bool
+		if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", retentionLockKey).Scan(&locked); err != nil {
+			logger.Warn("获取数据清理锁失败", zap.Error(err))
+			return false
+		}
+		if !locked {
+			logger.Debug("其他实例正在清理数据，跳过")
+			return false
+		}
+		defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", retentionLockKey)
+	}
+
+	start := time.Now()
+	for _, policy := range retentionPolicies {
+		if ctx.Err() != nil {
+			break
+		}
+		purged, archived, err := purgeTable(ctx, policy, start)
+		j.record(policy.Table, purged, archived, start, err)
+		if err != nil {
+			logger.Error("清理过期数据失败", zap.String("table", policy.Table), zap.Int64("purged", purged), zap.Error(err))
+		} else if purged > 0 {
+			logger.Info("已清理过期数据", zap.String("table", policy.Table), zap.Int64("purged", purged), zap.Int64("archived", archived))
+		}
+	}
+
+	j.mu.Lock()
+	j.runs++
+	j.lastRunAt = &start
+	j.lastDuration = time.Since(start)
+	j.mu.Unlock()
+	return true
+}
+
+// record 记录一张表的清理结果
+func (j *RetentionJob) record(table string, purged, archived int64, runAt time.Time, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	stats, ok := j.tables[table]
+	if !ok {
+		stats = &retentionTableStats{Table: table}
+		j.tables[table] = stats
+	}
+	stats.Purged += purged
+	stats.Archived += archived
+	stats.LastPurged = purged
+	stats.LastRunAt = &runAt
+	stats.LastError = ""
+	if err != nil {
+		stats.LastError = err.Error()
+	}
+}
+
+// purgeTable 分批删除表中超过保留期的行，配置了 RETENTION_ARCHIVE_DIR 时先归档再删除
+func purgeTable(ctx context.Context, policy retentionPolicy, now time.Time) (int64, int64, error) {
+	corpIDs := []string{currentCorpID()}
+	if policy.CorpColumn != "" {
+		corpIDs = nil
+		if err := db.Table(policy.Table).Distinct(policy.CorpColumn).Pluck(policy.CorpColumn, &corpIDs).Error; err != nil {
+			return 0, 0, fmt.Errorf("查询企业列表失败: %w", err)
+		}
+	}
+
+	batchSize := getEnvInt("RETENTION_BATCH_SIZE", 1000)
+	pause := getEnvDuration("RETENTION_BATCH_PAUSE", 100*time.Millisecond)
+	archiveDir := os.Getenv("RETENTION_ARCHIVE_DIR")
+
+	var purged, archived int64
+	for _, corpID := range corpIDs {
+		ttl := retentionTTL(policy.Table, corpID)
+		if ttl <= 0 {
+			continue
+		}
+		cutoff := now.Add(-ttl)
+
+		for {
+			if err := ctx.Err(); err != nil {
+				return purged, archived, err
+			}
+
+			query := db.Table(policy.Table).Where(policy.TimeColumn+" < ?", cutoff).Order("id").Limit(batchSize)
+			if policy.CorpColumn != "" {
+				query = query.Where(policy.CorpColumn+" = ?", corpID)
+			}
+
+			var ids []interface{}
+			if archiveDir != "" {
+				var rows []map[string]interface{}
+				if err := query.Find(&rows).Error; err != nil {
+					return purged, archived, fmt.Errorf("查询过期数据失败: %w", err)
+				}
+				if err := archiveRows(archiveDir, policy.Table, now, rows); err != nil {
+					return purged, archived, err
+				}
+				archived += int64(len(rows))
+				for _, row := range rows {
+					ids = append(ids, row["id"])
+				}
+			} else if err := query.Pluck("id", &ids).Error; err != nil {
+				return purged, archived, fmt.Errorf("查询过期数据失败: %w", err)
+			}
+			if len(ids) == 0 {
+				break
+			}
+
+			result := db.Exec("DELETE FROM "+policy.Table+" WHERE id IN ?", ids)
+			if result.Error != nil {
+				return purged, archived, fmt.Errorf("删除过期数据失败: %w", result.Error)
+			}
+			purged += result.RowsAffected
+
+			if len(ids) < batchSize {
+				break
+			}
+			// 批次之间暂停，减少对线上读写的锁竞争
+			select {
+			case <-ctx.Done():
+				return purged, archived, ctx.Err()
+			case <-time.After(pause):
+			}
+		}
+	}
+	return purged, archived, nil
+}
+
+// archiveRows 将待删除的行以 JSONL 追加写入 <RETENTION_ARCHIVE_DIR>/<表名>/<日期>.jsonl
+func archiveRows(dir, table string, now time.Time, rows []map[string]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	tableDir := filepath.Join(dir, table)
+	if err := os.MkdirAll(tableDir, 0o700); err != nil {
+		return fmt.Errorf("创建归档目录失败: %w", err)
+	}
+	path := filepath.Join(tableDir, now.Format("2006-01-02")+".jsonl")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("打开归档文件失败: %w", err)
+	}
+
+	encoder := json.NewEncoder(f)
+	encoder.SetEscapeHTML(false)
+	for _, row := range rows {
+		if err := encoder.Encode(row); err != nil {
+			f.Close()
+			return fmt.Errorf("写入归档文件失败: %w", err)
+		}
+	}
+	// 确认归档落盘后才删除数据
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("写入归档文件失败: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("写入归档文件失败: %w", err)
+	}
+	return nil
+}
+
+// retentionPolicyView 表的保留期配置
+type retentionPolicyView struct {
+	Table      string `json:"table"`
+	TimeColumn string `json:"time_column"`
+	TTL        string `json:"ttl"` // 当前企业的保留期，0s 表示永久保留
+}
+
+// Stats 获取清理任务的运行情况和各表的清理统计
+func (j *RetentionJob) Stats() map[string]interface{} {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	tables := make([]retentionTableStats, 0, len(retentionPolicies))
+	policies := make([]retentionPolicyView, 0, len(retentionPolicies))
+	for _, policy := range retentionPolicies {
+		stats := retentionTableStats{Table: policy.Table}
+		if s, ok := j.tables[policy.Table]; ok {
+			stats = *s
+		}
+		tables = append(tables, stats)
+		policies = append(policies, retentionPolicyView{
+			Table:      policy.Table,
+			TimeColumn: policy.TimeColumn,
+			TTL:        retentionTTL(policy.Table, currentCorpID()).String(),
+		})
+	}
+	return map[string]interface{}{
+		"running":          j.running,
+		"runs":             j.runs,
+		"last_run_at":      j.lastRunAt,
+		"last_duration_ms": j.lastDuration.Milliseconds(),
+		"interval":         getEnvDuration("RETENTION_INTERVAL", time.Hour).String(),
+		"archive_enabled":  os.Getenv("RETENTION_ARCHIVE_DIR") != "",
+		"policies":         policies,
+		"tables":           tables,
+	}
+}
+
+// RetentionHandler 查询数据清理配置和统计
+// GET /api/retention
+func RetentionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, retentionJob.Stats())
+}
+
+// RetentionRunHandler 立即在后台执行一次数据清理
+// POST /api/retention/run
+func RetentionRunHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if db == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "数据库未初始化")
+		return
+	}
+	go retentionJob.RunOnce(context.Background())
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"status": "started",
+	})
+}
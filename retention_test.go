@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestParseRetention(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"90d", 90 * 24 * time.Hour, false},
+		{"0d", 0, false},
+		{"36h", 36 * time.Hour, false},
+		{"-1d", 0, true},
+		{"xd", 0, true},
+		{"-1h", 0, true},
+		{"forever", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseRetention(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseRetention(%q) = %v, %v, want %v, err=%v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestRetentionTTLPrecedence(t *testing.T) {
+	logger = zap.NewNop()
+	t.Setenv("RETENTION_AI_QUOTA_USAGE", "30d")
+	t.Setenv("RETENTION_CORP_WW1_AI_QUOTA_USAGE", "7d")
+
+	if got := retentionTTL("ai_quota_usage", "ww1"); got != 7*24*time.Hour {
+		t.Errorf("企业单独配置的保留期 = %v, want 7d", got)
+	}
+	if got := retentionTTL("ai_quota_usage", "ww2"); got != 30*24*time.Hour {
+		t.Errorf("未单独配置的企业 = %v, want 30d", got)
+	}
+	if got := retentionTTL("ai_calls", ""); got != 0 {
+		t.Errorf("未配置保留期的表 = %v, 应永久保留", got)
+	}
+	t.Setenv("RETENTION_AI_CALLS", "soon")
+	if got := retentionTTL("ai_calls", ""); got != 0 {
+		t.Errorf("配置错误的表 = %v, 不应清理", got)
+	}
+}
+
+func TestPurgeTableInBatches(t *testing.T) {
+	newTestSQLiteStore(t)
+	t.Setenv("RETENTION_AI_CALLS", "1d")
+	t.Setenv("RETENTION_BATCH_SIZE", "2")
+	t.Setenv("RETENTION_BATCH_PAUSE", "1ms")
+	archiveDir := t.TempDir()
+	t.Setenv("RETENTION_ARCHIVE_DIR", archiveDir)
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		recordAICall(&AICall{AgentID: "a1", CreatedAt: now.Add(-48 * time.Hour)})
+	}
+	for i := 0; i < 2; i++ {
+		recordAICall(&AICall{AgentID: "a1", CreatedAt: now.Add(-time.Hour)})
+	}
+
+	purged, archived, err := purgeTable(context.Background(), retentionPolicy{Table: "ai_calls", TimeColumn: "created_at"}, now)
+	if err != nil {
+		t.Fatalf("purgeTable: %v", err)
+	}
+	if purged != 5 || archived != 5 {
+		t.Errorf("purged = %d, archived = %d, want 5, 5", purged, archived)
+	}
+
+	var remaining int64
+	db.Model(&AICall{}).Count(&remaining)
+	if remaining != 2 {
+		t.Errorf("剩余 %d 行, want 2", remaining)
+	}
+
+	f, err := os.Open(filepath.Join(archiveDir, "ai_calls", now.Format("2006-01-02")+".jsonl"))
+	if err != nil {
+		t.Fatalf("打开归档文件失败: %v", err)
+	}
+	defer f.Close()
+	lines := 0
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		lines++
+	}
+	if lines != 5 {
+		t.Errorf("归档 %d 行, want 5", lines)
+	}
+
+	// 没有过期数据时不再删除
+	purged, _, err = purgeTable(context.Background(), retentionPolicy{Table: "ai_calls", TimeColumn: "created_at"}, now)
+	if err != nil || purged != 0 {
+		t.Errorf("再次清理 purged = %d, %v, want 0", purged, err)
+	}
+}
+
+func TestPurgeTablePerCorp(t *testing.T) {
+	newTestSQLiteStore(t)
+	t.Setenv("RETENTION_AI_QUOTA_USAGE", "30d")
+	t.Setenv("RETENTION_CORP_WW1_AI_QUOTA_USAGE", "1d")
+
+	now := time.Now()
+	old := now.Add(-10 * 24 * time.Hour)
+	for _, usage := range []AIQuotaUsage{
+		{CorpID: "ww1", Day: quotaDay(old), Count: 1, UpdatedAt: old},
+		{CorpID: "ww2", Day: quotaDay(old), Count: 1, UpdatedAt: old},
+	} {
+		if err := db.Create(&usage).Error; err != nil {
+			t.Fatalf("创建配额记录失败: %v", err)
+		}
+	}
+
+	policy := retentionPolicy{Table: "ai_quota_usage", TimeColumn: "updated_at", CorpColumn: "corp_id"}
+	purged, _, err := purgeTable(context.Background(), policy, now)
+	if err != nil || purged != 1 {
+		t.Fatalf("purgeTable = %d, %v, 只应清理保留期为 1d 的企业", purged, err)
+	}
+	var corps []string
+	db.Model(&AIQuotaUsage{}).Pluck("corp_id", &corps)
+	if !equalStrings(corps, []string{"ww2"}) {
+		t.Errorf("剩余企业 = %v, want [ww2]", corps)
+	}
+}
+
+func TestRetentionJobRunOnceWithoutDatabase(t *testing.T) {
+	job := &RetentionJob{tables: make(map[string]*retentionTableStats)}
+	if job.RunOnce(context.Background()) {
+		t.Error("未启用数据库时不应执行清理")
+	}
+}
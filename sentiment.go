@@ -0,0 +1,501 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 情绪词典，匹配时忽略大小写
+// 中文词按子串匹配，不收录单字（"烦" 会命中 "麻烦"、"滚" 会命中 "滚筒"）；英文词按整词匹配（"good" 不命中 "goodbye"）
+var (
+	positiveWords = []string{"谢谢", "感谢", "满意", "不错", "很好", "太好了", "给力", "点赞", "很赞", "辛苦", "thanks", "thank you", "great", "good"}
+	negativeWords = []string{"失望", "不满", "太慢", "很差", "差劲", "糟糕", "无语", "坑人", "被坑", "好烦", "烦死", "不行", "bad", "terrible", "disappointed", "slow"}
+	angerWords    = []string{"气死", "愤怒", "生气", "垃圾", "骗子", "骗人", "滚开", "滚蛋", "什么破", "恶心", "忍无可忍", "太过分", "angry", "scam", "ridiculous", "unacceptable"}
+	churnWords    = []string{"退订", "注销", "销户", "不用了", "换一家", "再也不", "取消会员", "卸载", "不会再买", "unsubscribe", "cancel my account", "never again"}
+)
+
+// defaultEscalationKeywords 出现即升级的投诉关键词，可通过 ESCALATION_KEYWORDS（逗号分隔）覆盖
+var defaultEscalationKeywords = []string{"投诉", "12315", "消协", "曝光", "媒体", "律师", "起诉", "工商"}
+
+// 升级原因
+const (
+	escalationReasonAnger   = "anger"
+	escalationReasonChurn   = "churn"
+	escalationReasonKeyword = "complaint_keyword"
+)
+
+// 升级事件状态
+const (
+	escalationStatusOpen         = "open"
+	escalationStatusAcknowledged = "acknowledged"
+	escalationStatusResolved     = "resolved"
+)
+
+// sentimentSmoothing 会话情绪指数移动平均的权重，新消息占比
+const sentimentSmoothing = 0.4
+
+// SentimentResult 单条消息的情绪分析结果
+type SentimentResult struct {
+	Score   float64  `json:"score"`   // 情绪倾向，-1（负面）到 1（正面）
+	Anger   float64  `json:"anger"`   // 愤怒程度，0-1
+	Churn   float64  `json:"churn"`   // 流失倾向，0-1
+	Signals []string `json:"signals"` // 命中的愤怒、流失词
+}
+
+// splitLatinWords 将文本按拉丁字母以外的字符切分为单词
+func splitLatinWords(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.Is(unicode.Latin, r)
+	})
+}
+
+// isLatinPhrase 词典词是否只由拉丁字母和空格组成，这类词按整词匹配
+func isLatinPhrase(word string) bool {
+	for _, r := range word {
+		if r != ' ' && !unicode.Is(unicode.Latin, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsPhrase 判断单词序列 words 中是否连续出现 phrase 的所有单词
+func containsPhrase(words, phrase []string) bool {
+	for i := 0; i+len(phrase) <= len(words); i++ {
+		matched := true
+		for j, w := range phrase {
+			if words[i+j] != w {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// countWords 统计文本中出现的词典词数量，返回数量和命中的词
+// words 为 text 切分出的拉丁字母单词，英文词典词与其整词匹配
+func countWords(text string, words []string, dict []string) (int, []string) {
+	count := 0
+	var matched []string
+	for _, word := range dict {
+		var hit bool
+		if isLatinPhrase(word) {
+			hit = containsPhrase(words, strings.Fields(word))
+		} else {
+			hit = strings.Contains(text, word)
+		}
+		if hit {
+			count++
+			matched = append(matched, word)
+		}
+	}
+	return count, matched
+}
+
+// analyzeSentiment 基于词典分析消息的情绪
+func analyzeSentiment(text string) SentimentResult {
+	lower := strings.ToLower(text)
+	words := splitLatinWords(lower)
+
+	positive, _ := countWords(lower, words, positiveWords)
+	negative, _ := countWords(lower, words, negativeWords)
+	anger, angerMatched := countWords(lower, words, angerWords)
+	churn, churnMatched := countWords(lower, words, churnWords)
+	exclaims := strings.Count(text, "!") + strings.Count(text, "！")
+
+	result := SentimentResult{Signals: append(angerMatched, churnMatched...)}
+	if result.Signals == nil {
+		result.Signals = []string{}
+	}
+
+	// 愤怒词按两倍负面计
+	if total := positive + negative + 2*anger; total > 0 {
+		result.Score = float64(positive-negative-2*anger) / float64(total)
+	}
+	result.Anger = math.Min(1, 0.4*float64(anger)+0.15*float64(negative)+0.1*math.Min(float64(exclaims), 3))
+	if anger == 0 && negative == 0 {
+		// 感叹号只在有负面情绪时加重愤怒程度
+		result.Anger = 0
+	}
+	result.Churn = math.Min(1, 0.5*float64(churn))
+	return result
+}
+
+// escalationKeywords 获取出现即升级的投诉关键词
+func escalationKeywords() []string {
+	if value := os.Getenv("ESCALATION_KEYWORDS"); value != "" {
+		var keywords []string
+		for _, keyword := range strings.Split(value, ",") {
+			if keyword = strings.TrimSpace(keyword); keyword != "" {
+				keywords = append(keywords, keyword)
+			}
+		}
+		return keywords
+	}
+	return defaultEscalationKeywords
+}
+
+// ConversationSentiment conversation_sentiments 表模型，会话情绪汇总
+// 情绪、愤怒和流失倾向为各条客户消息的指数移动平均，越近的消息权重越高
+type ConversationSentiment struct {
+	ID           uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	ChatID       string    `gorm:"type:varchar(255);uniqueIndex;not null" json:"chat_id"`
+	AgentID      string    `gorm:"type:varchar(255);index" json:"agent_id"`
+	MessageCount int       `json:"message_count"`
+	Score        float64   `json:"score"`
+	Anger        float64   `json:"anger"`
+	Churn        float64   `json:"churn"`
+	LastScore    float64   `json:"last_score"` // 最近一条消息的情绪倾向
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (ConversationSentiment) TableName() string {
+	return "conversation_sentiments"
+}
+
+// SentimentTracker 汇总会话情绪并在达到阈值时触发升级
+type SentimentTracker struct {
+	mu             sync.Mutex
+	conversations  map[string]ConversationSentiment // chatID -> 会话情绪
+	lastEscalation map[string]time.Time             // chatID -> 最近一次升级时间
+}
+
+var sentimentTracker = &SentimentTracker{
+	conversations:  make(map[string]ConversationSentiment),
+	lastEscalation: make(map[string]time.Time),
+}
+
+// load 获取会话情绪，内存未命中时回查数据库，调用方需持有锁
+func (t *SentimentTracker) load(chatID string) ConversationSentiment {
+	if cs, ok := t.conversations[chatID]; ok {
+		return cs
+	}
+	cs := ConversationSentiment{ChatID: chatID}
+	if db != nil {
+		if err := db.Where("chat_id = ?", chatID).Limit(1).Find(&cs).Error; err != nil {
+			logger.Warn("查询会话情绪失败", zap.String("chat_id", chatID), zap.Error(err))
+		}
+	}
+	return cs
+}
+
+// Track 记录一条客户消息的情绪并更新会话汇总，达到升级条件时返回升级原因
+func (t *SentimentTracker) Track(agentID, chatID, content string) (SentimentResult, ConversationSentiment, string, string) {
+	result := analyzeSentiment(content)
+
+	t.mu.Lock()
+	cs := t.load(chatID)
+	cs.AgentID = agentID
+	if cs.MessageCount == 0 {
+		cs.Score, cs.Anger, cs.Churn = result.Score, result.Anger, result.Churn
+	} else {
+		cs.Score = sentimentSmoothing*result.Score + (1-sentimentSmoothing)*cs.Score
+		cs.Anger = sentimentSmoothing*result.Anger + (1-sentimentSmoothing)*cs.Anger
+		cs.Churn = sentimentSmoothing*result.Churn + (1-sentimentSmoothing)*cs.Churn
+	}
+	cs.MessageCount++
+	cs.LastScore = result.Score
+	t.conversations[chatID] = cs
+
+	// 同一会话在冷却时间内只升级一次
+	reason, keyword := "", ""
+	if time.Since(t.lastEscalation[chatID]) >= getEnvDuration("ESCALATION_COOLDOWN", 10*time.Minute) {
+		reason, keyword = escalationReason(content, result, cs)
+		if reason != "" {
+			t.lastEscalation[chatID] = time.Now()
+		}
+	}
+	t.mu.Unlock()
+
+	if db != nil {
+		record := cs
+		record.ID = 0 // 按 chat_id 冲突更新
+		err := db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "chat_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"agent_id", "message_count", "score", "anger", "churn", "last_score", "updated_at"}),
+		}).Create(&record).Error
+		if err != nil {
+			logger.Warn("保存会话情绪失败", zap.String("chat_id", chatID), zap.Error(err))
+		}
+	}
+
+	return result, cs, reason, keyword
+}
+
+// escalationReason 判断是否需要升级：出现投诉关键词，或会话的愤怒、流失倾向超过阈值
+func escalationReason(content string, result SentimentResult, cs ConversationSentiment) (reason, keyword string) {
+	lower := strings.ToLower(content)
+	for _, k := range escalationKeywords() {
+		if strings.Contains(lower, strings.ToLower(k)) {
+			return escalationReasonKeyword, k
+		}
+	}
+	// 单条消息和会话汇总任一达到阈值即升级，避免一条极端消息被平均掉
+	if math.Max(result.Anger, cs.Anger) >= getEnvFloat("ESCALATION_ANGER_THRESHOLD", 0.6) {
+		return escalationReasonAnger, ""
+	}
+	if math.Max(result.Churn, cs.Churn) >= getEnvFloat("ESCALATION_CHURN_THRESHOLD", 0.5) {
+		return escalationReasonChurn, ""
+	}
+	return "", ""
+}
+
+// Escalation escalations 表模型，升级事件，用于审计升级的处理时效
+type Escalation struct {
+	ID             uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	AgentID        string     `gorm:"type:varchar(255);index" json:"agent_id"`
+	ChatID         string     `gorm:"type:varchar(255);index;not null" json:"chat_id"`
+	MsgID          string     `gorm:"type:varchar(255)" json:"msg_id"`
+	Reason         string     `gorm:"type:varchar(50);index" json:"reason"` // anger, churn, complaint_keyword
+	Keyword        string     `gorm:"type:varchar(100)" json:"keyword"`
+	Content        string     `gorm:"type:text" json:"content"`
+	Score          float64    `json:"score"`
+	Anger          float64    `json:"anger"`
+	Churn          float64    `json:"churn"`
+	Status         string     `gorm:"type:varchar(20);index;not null" json:"status"` // open, acknowledged, resolved
+	AcknowledgedBy string     `gorm:"type:varchar(255)" json:"acknowledged_by"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at"`
+	ResolvedBy     string     `gorm:"type:varchar(255)" json:"resolved_by"`
+	ResolvedAt     *time.Time `json:"resolved_at"`
+	CreatedAt      time.Time  `gorm:"index" json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Escalation) TableName() string {
+	return "escalations"
+}
+
+// trackSentiment 记录客户消息的情绪，达到升级条件时记录升级事件并推送给主管
+func (c *WeComClient) trackSentiment(chatID, msgID, content string) {
+	result, cs, reason, keyword := sentimentTracker.Track(c.AgentID, chatID, content)
+	if reason == "" {
+		return
+	}
+
+	escalation := Escalation{
+		AgentID: c.AgentID,
+		ChatID:  chatID,
+		MsgID:   msgID,
+		Reason:  reason,
+		Keyword: keyword,
+		Content: content,
+		Score:   cs.Score,
+		Anger:   math.Max(result.Anger, cs.Anger),
+		Churn:   math.Max(result.Churn, cs.Churn),
+		Status:  escalationStatusOpen,
+	}
+	if db != nil {
+		if err := db.Create(&escalation).Error; err != nil {
+			logger.Error("记录升级事件失败", zap.String("chat_id", chatID), zap.Error(err))
+		}
+	} else {
+		escalation.CreatedAt = time.Now()
+	}
+
+	logger.Warn("会话触发升级",
+		zap.String("agent_id", c.AgentID),
+		zap.String("chat_id", chatID),
+		zap.String("reason", reason),
+		zap.String("keyword", keyword),
+		zap.Strings("signals", result.Signals))
+
+	supervisorHub.Broadcast(map[string]interface{}{
+		"type":       "escalation_alert",
+		"escalation": escalation,
+		"signals":    result.Signals,
+	})
+}
+
+// updateEscalationStatus 主管确认或解决升级事件
+func updateEscalationStatus(id uint, status, supervisorID string) (Escalation, error) {
+	var escalation Escalation
+	if db == nil {
+		return escalation, fmt.Errorf("数据库未初始化")
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&escalation, id).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		switch status {
+		case escalationStatusAcknowledged:
+			if escalation.AcknowledgedAt != nil {
+				return nil // 重复确认时保留首次确认时间
+			}
+			escalation.AcknowledgedBy = supervisorID
+			escalation.AcknowledgedAt = &now
+			if escalation.Status == escalationStatusOpen {
+				escalation.Status = escalationStatusAcknowledged
+			}
+		case escalationStatusResolved:
+			if escalation.ResolvedAt != nil {
+				return nil
+			}
+			// 未确认直接解决时，确认时间同解决时间
+			if escalation.AcknowledgedAt == nil {
+				escalation.AcknowledgedBy = supervisorID
+				escalation.AcknowledgedAt = &now
+			}
+			escalation.ResolvedBy = supervisorID
+			escalation.ResolvedAt = &now
+			escalation.Status = escalationStatusResolved
+		default:
+			return fmt.Errorf("无效的状态: %s", status)
+		}
+		return tx.Save(&escalation).Error
+	})
+	if err != nil {
+		return escalation, err
+	}
+
+	supervisorHub.Broadcast(map[string]interface{}{
+		"type":       "escalation_updated",
+		"escalation": escalation,
+	})
+	return escalation, nil
+}
+
+// escalationView 升级事件及其处理时效
+type escalationView struct {
+	Escalation
+	AckSeconds     *float64 `json:"ack_seconds"`     // 从升级到确认的秒数
+	ResolveSeconds *float64 `json:"resolve_seconds"` // 从升级到解决的秒数
+}
+
+func newEscalationView(e Escalation) escalationView {
+	view := escalationView{Escalation: e}
+	if e.AcknowledgedAt != nil {
+		seconds := e.AcknowledgedAt.Sub(e.CreatedAt).Seconds()
+		view.AckSeconds = &seconds
+	}
+	if e.ResolvedAt != nil {
+		seconds := e.ResolvedAt.Sub(e.CreatedAt).Seconds()
+		view.ResolveSeconds = &seconds
+	}
+	return view
+}
+
+// EscalationsHandler 查询升级事件及处理时效
+// GET /api/escalations?status=...&chat_id=...&agent_id=...&limit=100
+func EscalationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if db == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "数据库未初始化")
+		return
+	}
+
+	query := db.Model(&Escalation{}).Order("id DESC")
+	if status := r.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if chatID := r.URL.Query().Get("chat_id"); chatID != "" {
+		query = query.Where("chat_id = ?", chatID)
+	}
+	if agentID := r.URL.Query().Get("agent_id"); agentID != "" {
+		query = query.Where("agent_id = ?", agentID)
+	}
+
+	limit := 100
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 1000 {
+		limit = l
+	}
+
+	var escalations []Escalation
+	if err := query.Limit(limit).Find(&escalations).Error; err != nil {
+		logger.Error("查询升级事件失败", zap.Error(err))
+		writeJSONError(w, http.StatusInternalServerError, "查询升级事件失败")
+		return
+	}
+
+	views := make([]escalationView, 0, len(escalations))
+	for _, e := range escalations {
+		views = append(views, newEscalationView(e))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"escalations": views,
+	})
+}
+
+// EscalationActionHandler 确认或解决升级事件
+// POST /api/escalations/{id}/ack, POST /api/escalations/{id}/resolve，请求体 {"supervisor_id": "..."}
+func EscalationActionHandler(status string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "无效的升级事件ID")
+			return
+		}
+
+		var req struct {
+			SupervisorID string `json:"supervisor_id"`
+		}
+		// 请求体可选
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeJSONError(w, http.StatusBadRequest, "无效的请求体")
+			return
+		}
+
+		escalation, err := updateEscalationStatus(uint(id), status, req.SupervisorID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				writeJSONError(w, http.StatusNotFound, "升级事件不存在")
+				return
+			}
+			logger.Error("更新升级事件失败", zap.Uint64("id", id), zap.Error(err))
+			writeJSONError(w, http.StatusInternalServerError, "更新升级事件失败")
+			return
+		}
+		writeJSON(w, http.StatusOK, newEscalationView(escalation))
+	}
+}
+
+// ConversationSentimentHandler 查询会话情绪汇总
+// GET /api/chats/{chat_id}/sentiment
+func ConversationSentimentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	chatID := r.PathValue("chat_id")
+	sentimentTracker.mu.Lock()
+	cs := sentimentTracker.load(chatID)
+	sentimentTracker.mu.Unlock()
+
+	if cs.MessageCount == 0 {
+		writeJSONError(w, http.StatusNotFound, "会话没有情绪记录")
+		return
+	}
+	writeJSON(w, http.StatusOK, cs)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAnalyzeSentimentWholeWords(t *testing.T) {
+	tests := []struct {
+		text      string
+		wantScore int // 1 正面，-1 负面，0 中性
+	}{
+		{"谢谢你的帮助", 1},
+		{"Thanks, that was good", 1},
+		{"thank you!", 1},
+		{"太慢了，很失望", -1},
+		{"the delivery is slow", -1},
+		// 单字和英文词的一部分不应命中
+		{"麻烦帮我查一下订单", 0},
+		{"滚筒洗衣机什么时候发货", 0},
+		{"goodbye", 0},
+		{"please drive slowly", 0},
+		{"I am thankful", 0},
+	}
+
+	for _, tt := range tests {
+		result := analyzeSentiment(tt.text)
+		got := 0
+		switch {
+		case result.Score > 0:
+			got = 1
+		case result.Score < 0:
+			got = -1
+		}
+		if got != tt.wantScore {
+			t.Errorf("analyzeSentiment(%q).Score = %v, want sign %d", tt.text, result.Score, tt.wantScore)
+		}
+	}
+}
+
+func TestAnalyzeSentimentSignals(t *testing.T) {
+	result := analyzeSentiment("Never again, I will cancel my account")
+	if len(result.Signals) != 2 || result.Churn == 0 {
+		t.Errorf("Signals = %v, Churn = %v, 期望命中两个流失词", result.Signals, result.Churn)
+	}
+
+	result = analyzeSentiment("can you cancel my order again")
+	if len(result.Signals) != 0 {
+		t.Errorf("Signals = %v, 词组只在连续出现时命中", result.Signals)
+	}
+}
+
+func TestSupervisorAuthorized(t *testing.T) {
+	t.Setenv("ADMIN_API_TOKEN", "secret")
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		target   string
+		wantAuth bool
+	}{
+		{"Authorization 请求头", map[string]string{"Authorization": "Bearer secret"}, "/ws/supervisor", true},
+		{"子协议携带令牌", map[string]string{"Sec-WebSocket-Protocol": "bearer, secret"}, "/ws/supervisor", true},
+		{"子协议令牌错误", map[string]string{"Sec-WebSocket-Protocol": "bearer, wrong"}, "/ws/supervisor", false},
+		{"子协议缺少令牌", map[string]string{"Sec-WebSocket-Protocol": "bearer"}, "/ws/supervisor", false},
+		{"不接受 URL 参数", nil, "/ws/supervisor?token=secret", false},
+		{"未携带令牌", nil, "/ws/supervisor", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.target, nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			if got := supervisorAuthorized(r); got != tt.wantAuth {
+				t.Errorf("supervisorAuthorized = %v, want %v", got, tt.wantAuth)
+			}
+		})
+	}
+
+	t.Setenv("ADMIN_API_TOKEN", "")
+	r := httptest.NewRequest("GET", "/ws/supervisor", nil)
+	r.Header.Set("Authorization", "Bearer ")
+	if supervisorAuthorized(r) {
+		t.Error("未设置 ADMIN_API_TOKEN 时应拒绝连接")
+	}
+}
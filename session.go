@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm/clause"
+)
+
+// AgentSession agent_sessions 表模型，记录 (客服, 会话) 对应的下游 Agent 会话
+type AgentSession struct {
+	ID               uint      `gorm:"primaryKey;autoIncrement"`
+	AgentID          string    `gorm:"type:varchar(255);uniqueIndex:idx_agent_sessions_agent_chat;not null"`
+	ChatID           string    `gorm:"type:varchar(255);uniqueIndex:idx_agent_sessions_agent_chat;not null"`
+	SessionID        int       `gorm:"not null"`
+	CallerInstanceID int64     `gorm:"not null"`
+	ExpireAt         time.Time `gorm:"index"`
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+// TableName 指定表名
+func (AgentSession) TableName() string {
+	return "agent_sessions"
+}
+
+// AgentSessionStore 缓存 (客服, 会话) -> Agent 会话的映射
+// 映射保存在进程内存中，数据库可用时同步写入 agent_sessions 表，
+// 因此客服断线重连（甚至服务重启）后仍能继续使用同一个 Agent 会话
+type AgentSessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]AgentSession // agentID + chatID -> session
+}
+
+var agentSessions = &AgentSessionStore{
+	sessions: make(map[string]AgentSession),
+}
+
+// agentSessionTTL 获取 Agent 会话的有效期（默认 30 分钟）
+func agentSessionTTL() time.Duration {
+	return getEnvDuration("AGENT_SESSION_TTL", 30*time.Minute)
+}
+
+func agentSessionKey(agentID, chatID string) string {
+	return agentID + "\x00" + chatID
+}
+
+// Get 获取未过期的 Agent 会话，内存未命中时回查数据库
+func (s *AgentSessionStore) Get(agentID, chatID string) (AgentSession, bool) {
+	key := agentSessionKey(agentID, chatID)
+
+	s.mu.RLock()
+	session, ok := s.sessions[key]
+	s.mu.RUnlock()
+	if ok {
+		if time.Now().Before(session.ExpireAt) {
+			return session, true
+		}
+		// 已过期，从内存中移除
+		s.mu.Lock()
+		delete(s.sessions, key)
+		s.mu.Unlock()
+	}
+
+	if db == nil {
+		return AgentSession{}, false
+	}
+
+	var stored AgentSession
+	err := db.Where("agent_id = ? AND chat_id = ? AND expire_at > ?", agentID, chatID, time.Now()).
+		Limit(1).
+		Find(&stored).Error
+	if err != nil {
+		logger.Warn("查询 Agent 会话失败", zap.String("agent_id", agentID), zap.String("chat_id", chatID), zap.Error(err))
+		return AgentSession{}, false
+	}
+	if stored.ID == 0 {
+		return AgentSession{}, false
+	}
+
+	s.mu.Lock()
+	s.sessions[key] = stored
+	s.mu.Unlock()
+	return stored, true
+}
+
+// Save 保存 Agent 会话并刷新有效期
+func (s *AgentSessionStore) Save(agentID, chatID string, sessionID int, callerInstanceID int64) error {
+	session := AgentSession{
+		AgentID:          agentID,
+		ChatID:           chatID,
+		SessionID:        sessionID,
+		CallerInstanceID: callerInstanceID,
+		ExpireAt:         time.Now().Add(agentSessionTTL()),
+	}
+
+	s.mu.Lock()
+	s.sessions[agentSessionKey(agentID, chatID)] = session
+	s.mu.Unlock()
+
+	if db == nil {
+		return nil
+	}
+
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "agent_id"}, {Name: "chat_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"session_id", "caller_instance_id", "expire_at", "updated_at"}),
+	}).Create(&session).Error
+	if err != nil {
+		return fmt.Errorf("保存 Agent 会话失败: %w", err)
+	}
+	return nil
+}
+
+// cleanup 清理内存中已过期的会话，避免会话数增长导致内存占用持续增加
+// 数据库中的过期记录由保留期任务清理
+func (s *AgentSessionStore) cleanup() {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, session := range s.sessions {
+		if !now.Before(session.ExpireAt) {
+			delete(s.sessions, key)
+		}
+	}
+}
+
+// RunCleanup 定期清理过期的会话
+func (s *AgentSessionStore) RunCleanup() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.cleanup()
+	}
+}
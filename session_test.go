@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAgentSessionStoreCleanup(t *testing.T) {
+	store := &AgentSessionStore{sessions: make(map[string]AgentSession)}
+	now := time.Now()
+	store.sessions[agentSessionKey("a1", "c1")] = AgentSession{AgentID: "a1", ChatID: "c1", SessionID: 1, ExpireAt: now.Add(time.Minute)}
+	store.sessions[agentSessionKey("a1", "c2")] = AgentSession{AgentID: "a1", ChatID: "c2", SessionID: 2, ExpireAt: now.Add(-time.Minute)}
+
+	store.cleanup()
+
+	if _, ok := store.sessions[agentSessionKey("a1", "c1")]; !ok {
+		t.Error("未过期的会话不应被清理")
+	}
+	if _, ok := store.sessions[agentSessionKey("a1", "c2")]; ok {
+		t.Error("过期的会话应被清理")
+	}
+}
+
+func TestAgentSessionStoreGetWithoutDatabase(t *testing.T) {
+	store := &AgentSessionStore{sessions: make(map[string]AgentSession)}
+	if err := store.Save("a1", "c1", 42, 7); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	session, ok := store.Get("a1", "c1")
+	if !ok || session.SessionID != 42 || session.CallerInstanceID != 7 {
+		t.Errorf("Get = %+v, %v", session, ok)
+	}
+	if _, ok := store.Get("a1", "other"); ok {
+		t.Error("其他会话不应命中")
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Similarity 文本相似度算法，用于客服消息与 suggestion 的关联
+type Similarity interface {
+	// Name 算法名称，对应 SUGGESTION_SIMILARITY_ALGORITHM 的取值
+	Name() string
+	// Score 计算两个文本的相似度（0-100）
+	Score(a, b string) float64
+}
+
+// 相似度算法名称
+const (
+	similarityCosine      = "cosine"      // 词频向量余弦相似度
+	similarityJaccard     = "jaccard"     // 字符 n-gram 集合的 Jaccard 系数
+	similarityLevenshtein = "levenshtein" // 归一化编辑距离
+	similarityLCS         = "lcs"         // 最长公共子序列占比
+)
+
+// similarityAlgorithms 可选的相似度算法
+func similarityAlgorithms() map[string]Similarity {
+	return map[string]Similarity{
+		similarityCosine:      cosineSimilarityAlgorithm{},
+		similarityJaccard:     jaccardSimilarityAlgorithm{n: getEnvInt("SUGGESTION_SIMILARITY_NGRAM", 2)},
+		similarityLevenshtein: levenshteinSimilarityAlgorithm{},
+		similarityLCS:         lcsSimilarityAlgorithm{},
+	}
+}
+
+// similarityAlgorithmNames 所有算法名称（按名称排序）
+func similarityAlgorithmNames() []string {
+	algorithms := similarityAlgorithms()
+	names := make([]string, 0, len(algorithms))
+	for name := range algorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// similarityByName 根据名称获取相似度算法
+func similarityByName(name string) (Similarity, error) {
+	if sim, ok := similarityAlgorithms()[name]; ok {
+		return sim, nil
+	}
+	return nil, fmt.Errorf("未知的相似度算法: %s（可选: %s）", name, strings.Join(similarityAlgorithmNames(), ", "))
+}
+
+// suggestionSimilarity 消息关联使用的相似度算法，由 SUGGESTION_SIMILARITY_ALGORITHM 指定，默认 cosine
+func suggestionSimilarity() Similarity {
+	name := os.Getenv("SUGGESTION_SIMILARITY_ALGORITHM")
+	if name == "" {
+		return cosineSimilarityAlgorithm{}
+	}
+	sim, err := similarityByName(name)
+	if err != nil {
+		logger.Warn("相似度算法配置错误，使用 cosine", zap.Error(err))
+		return cosineSimilarityAlgorithm{}
+	}
+	return sim
+}
+
+// suggestionSimilarityThreshold 关联的相似度阈值（0-100）
+// 各算法的分值分布不同，可通过 SUGGESTION_SIMILARITY_THRESHOLD_<算法> 单独设置，
+// 未设置时使用 SUGGESTION_SIMILARITY_THRESHOLD，默认 80
+func suggestionSimilarityThreshold(name string) float64 {
+	threshold := getEnvFloat("SUGGESTION_SIMILARITY_THRESHOLD", 80)
+	return getEnvFloat("SUGGESTION_SIMILARITY_THRESHOLD_"+strings.ToUpper(name), threshold)
+}
+
+// cosineSimilarityAlgorithm 分词后的词频向量余弦相似度
+type cosineSimilarityAlgorithm struct{}
+
+func (cosineSimilarityAlgorithm) Name() string { return similarityCosine }
+
+func (cosineSimilarityAlgorithm) Score(a, b string) float64 {
+	return calculateCosineSimilarity(a, b)
+}
+
+// jaccardSimilarityAlgorithm 归一化文本的字符 n-gram 集合的 Jaccard 系数
+type jaccardSimilarityAlgorithm struct {
+	n int
+}
+
+func (jaccardSimilarityAlgorithm) Name() string { return similarityJaccard }
+
+func (s jaccardSimilarityAlgorithm) Score(a, b string) float64 {
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 100
+	}
+	grams1 := charNgrams([]rune(normalizeQuestion(a)), s.n)
+	grams2 := charNgrams([]rune(normalizeQuestion(b)), s.n)
+	if len(grams1) == 0 || len(grams2) == 0 {
+		return 0
+	}
+
+	intersection := 0
+	for gram := range grams1 {
+		if grams2[gram] {
+			intersection++
+		}
+	}
+	union := len(grams1) + len(grams2) - intersection
+	return float64(intersection) / float64(union) * 100
+}
+
+// charNgrams 字符 n-gram 集合，文本短于 n 时整体作为一个 n-gram
+func charNgrams(runes []rune, n int) map[string]bool {
+	if n < 1 {
+		n = 1
+	}
+	grams := make(map[string]bool)
+	if len(runes) == 0 {
+		return grams
+	}
+	if len(runes) < n {
+		grams[string(runes)] = true
+		return grams
+	}
+	for i := 0; i+n <= len(runes); i++ {
+		grams[string(runes[i:i+n])] = true
+	}
+	return grams
+}
+
+// levenshteinSimilarityAlgorithm 归一化文本的编辑距离相似度：1 - 距离/较长文本长度
+type levenshteinSimilarityAlgorithm struct{}
+
+func (levenshteinSimilarityAlgorithm) Name() string { return similarityLevenshtein }
+
+func (levenshteinSimilarityAlgorithm) Score(a, b string) float64 {
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 100
+	}
+	r1, r2 := []rune(normalizeQuestion(a)), []rune(normalizeQuestion(b))
+	longest := math.Max(float64(len(r1)), float64(len(r2)))
+	if longest == 0 {
+		return 0
+	}
+	return (1 - float64(levenshteinDistance(r1, r2))/longest) * 100
+}
+
+// levenshteinDistance 编辑距离（插入、删除、替换各计 1），只保留两行状态
+func levenshteinDistance(r1, r2 []rune) int {
+	prev := make([]int, len(r2)+1)
+	curr := make([]int, len(r2)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(r1); i++ {
+		curr[0] = i
+		for j := 1; j <= len(r2); j++ {
+			cost := 1
+			if r1[i-1] == r2[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(r2)]
+}
+
+// lcsSimilarityAlgorithm 归一化文本的最长公共子序列占比：2 * LCS / (两文本长度之和)
+type lcsSimilarityAlgorithm struct{}
+
+func (lcsSimilarityAlgorithm) Name() string { return similarityLCS }
+
+func (lcsSimilarityAlgorithm) Score(a, b string) float64 {
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 100
+	}
+	r1, r2 := []rune(normalizeQuestion(a)), []rune(normalizeQuestion(b))
+	total := len(r1) + len(r2)
+	if total == 0 {
+		return 0
+	}
+	return float64(2*lcsLength(r1, r2)) / float64(total) * 100
+}
+
+// lcsLength 最长公共子序列长度，只保留两行状态
+func lcsLength(r1, r2 []rune) int {
+	prev := make([]int, len(r2)+1)
+	curr := make([]int, len(r2)+1)
+	for i := 1; i <= len(r1); i++ {
+		for j := 1; j <= len(r2); j++ {
+			if r1[i-1] == r2[j-1] {
+				curr[j] = prev[j-1] + 1
+			} else {
+				curr[j] = max(prev[j], curr[j-1])
+			}
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(r2)]
+}
+
+// scoreSuggestion 计算客服消息与 suggestion 的相似度和匹配类型，suggestion 没有可比较的内容时返回 false
+func scoreSuggestion(sim Similarity, sug Suggestion, content string) (float64, string, bool) {
+	switch {
+	case sug.OriginalContent == content:
+		return 100, "exact_original", true
+	case sug.TranslatedContent != "" && sug.TranslatedContent == content:
+		// 双语模式下客服发送的是回译后的建议
+		return 100, "exact_translated", true
+	case sug.EditedContent == content:
+		// 与 edited_content 完全相同时，相似率为 edited_content 与 original_content 的相似度
+		if sug.OriginalContent == "" {
+			return 100, "exact_edited", true
+		}
+		return sim.Score(sug.EditedContent, sug.OriginalContent), "exact_edited", true
+	case sug.OriginalContent != "":
+		similarity := sim.Score(content, sug.OriginalContent)
+		if sug.TranslatedContent != "" {
+			similarity = math.Max(similarity, sim.Score(content, sug.TranslatedContent))
+		}
+		return similarity, "similar", true
+	}
+	return 0, "", false
+}
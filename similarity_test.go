@@ -0,0 +1,66 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSimilarityScore(t *testing.T) {
+	tests := []struct {
+		name string
+		sim  Similarity
+		a, b string
+		want float64
+	}{
+		{name: "cosine 相同", sim: cosineSimilarityAlgorithm{}, a: "hello world", b: "hello world", want: 100},
+		{name: "cosine 空文本", sim: cosineSimilarityAlgorithm{}, a: "", b: "hello", want: 0},
+		{name: "cosine 无共同词", sim: cosineSimilarityAlgorithm{}, a: "hello world", b: "foo bar", want: 0},
+		{name: "cosine 部分相同", sim: cosineSimilarityAlgorithm{}, a: "hello world", b: "hello there", want: 50},
+		{name: "cosine 中文", sim: cosineSimilarityAlgorithm{}, a: "退货", b: "退货流程", want: 100 / math.Sqrt(3)},
+
+		{name: "jaccard 相同", sim: jaccardSimilarityAlgorithm{n: 2}, a: "abcd", b: "abcd", want: 100},
+		{name: "jaccard 空文本", sim: jaccardSimilarityAlgorithm{n: 2}, a: "abcd", b: "", want: 0},
+		{name: "jaccard 无共同片段", sim: jaccardSimilarityAlgorithm{n: 2}, a: "abc", b: "xyz", want: 0},
+		{name: "jaccard 部分相同", sim: jaccardSimilarityAlgorithm{n: 2}, a: "abcd", b: "abce", want: 50},
+		{name: "jaccard 忽略大小写和标点", sim: jaccardSimilarityAlgorithm{n: 2}, a: "Hello!", b: "hello", want: 100},
+
+		{name: "levenshtein 相同", sim: levenshteinSimilarityAlgorithm{}, a: "kitten", b: "kitten", want: 100},
+		{name: "levenshtein 空文本", sim: levenshteinSimilarityAlgorithm{}, a: "", b: "kitten", want: 0},
+		{name: "levenshtein 完全不同", sim: levenshteinSimilarityAlgorithm{}, a: "abc", b: "xyz", want: 0},
+		{name: "levenshtein 部分相同", sim: levenshteinSimilarityAlgorithm{}, a: "kitten", b: "sitting", want: (1 - 3.0/7) * 100},
+		{name: "levenshtein 中文", sim: levenshteinSimilarityAlgorithm{}, a: "请稍等片刻", b: "请稍等一下", want: 60},
+
+		{name: "lcs 相同", sim: lcsSimilarityAlgorithm{}, a: "abcd", b: "abcd", want: 100},
+		{name: "lcs 空文本", sim: lcsSimilarityAlgorithm{}, a: "abcd", b: "", want: 0},
+		{name: "lcs 完全不同", sim: lcsSimilarityAlgorithm{}, a: "abc", b: "xyz", want: 0},
+		{name: "lcs 部分相同", sim: lcsSimilarityAlgorithm{}, a: "abcd", b: "abed", want: 75},
+		{name: "lcs 忽略大小写和末尾标点", sim: lcsSimilarityAlgorithm{}, a: "Thanks!", b: "thanks", want: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.sim.Score(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("%s.Score(%q, %q) = %v, want %v", tt.sim.Name(), tt.a, tt.b, got, tt.want)
+			}
+			// 所有算法都是对称的
+			if got := tt.sim.Score(tt.b, tt.a); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("%s.Score(%q, %q) = %v, want %v", tt.sim.Name(), tt.b, tt.a, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSimilarityByName(t *testing.T) {
+	for _, name := range similarityAlgorithmNames() {
+		sim, err := similarityByName(name)
+		if err != nil {
+			t.Fatalf("similarityByName(%q): %v", name, err)
+		}
+		if sim.Name() != name {
+			t.Errorf("similarityByName(%q).Name() = %q", name, sim.Name())
+		}
+	}
+	if _, err := similarityByName("unknown"); err == nil {
+		t.Error("未知算法应返回错误")
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 存储后端，由 DB_DRIVER 选择
+const (
+	storageDriverPostgres = "postgres"
+	storageDriverSQLite   = "sqlite"
+	storageDriverMemory   = "memory"
+)
+
+// storageDriver 当前配置的存储后端，默认 postgres
+func storageDriver() string {
+	switch driver := os.Getenv("DB_DRIVER"); driver {
+	case "", storageDriverPostgres:
+		return storageDriverPostgres
+	case storageDriverSQLite, storageDriverMemory:
+		return driver
+	default:
+		logger.Warn("DB_DRIVER 配置无效，使用 postgres", zap.String("value", driver))
+		return storageDriverPostgres
+	}
+}
+
+// usingPostgres 当前数据库是否为 PostgreSQL，advisory lock 等特性只在 PostgreSQL 下可用
+func usingPostgres() bool {
+	return db != nil && db.Dialector.Name() == storageDriverPostgres
+}
+
+// SuggestionStore suggestion 的存储
+type SuggestionStore interface {
+	// CreateSuggestion 创建 suggestion，suggestion_id 重复时返回错误
+	CreateSuggestion(suggestion Suggestion) error
+	// UpdateFeedback 更新客服反馈，originalContent、editedContent 为空时不更新对应字段
+	UpdateFeedback(suggestionID, action, originalContent, editedContent string) error
+	// UpdateMsgID 更新关联的消息ID和相似率
+	UpdateMsgID(suggestionID, msgID string, similarity float64) error
+	// RecentSuggestions 查询客服在会话中 before 之前创建的 suggestion，按创建时间倒序，最多 limit 条，limit 不大于 0 时返回空
+	RecentSuggestions(agentID, chatID string, before time.Time, limit int) ([]Suggestion, error)
+}
+
+// suggestionStore 当前使用的 suggestion 存储，数据库初始化失败时为 nil
+var suggestionStore SuggestionStore
+
+// gormSuggestionStore 基于 GORM 的存储，用于 PostgreSQL 和 SQLite
+type gormSuggestionStore struct {
+	db *gorm.DB
+}
+
+func (s *gormSuggestionStore) CreateSuggestion(suggestion Suggestion) error {
+	if err := s.db.Create(&suggestion).Error; err != nil {
+		return fmt.Errorf("创建 suggestion 失败: %w", err)
+	}
+	return nil
+}
+
+func (s *gormSuggestionStore) UpdateFeedback(suggestionID, action, originalContent, editedContent string) error {
+	updates := map[string]interface{}{
+		"action": action,
+	}
+	if originalContent != "" {
+		updates["original_content"] = originalContent
+	}
+	if editedContent != "" {
+		updates["edited_content"] = editedContent
+	}
+
+	result := s.db.Model(&Suggestion{}).
+		Where("suggestion_id = ?", suggestionID).
+		Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("更新 suggestion 反馈信息失败: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("未找到 suggestion_id: %s", suggestionID)
+	}
+	return nil
+}
+
+func (s *gormSuggestionStore) UpdateMsgID(suggestionID, msgID string, similarity float64) error {
+	result := s.db.Model(&Suggestion{}).
+		Where("suggestion_id = ?", suggestionID).
+		Updates(map[string]interface{}{
+			"msg_id":     msgID,
+			"similarity": similarity,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("更新 suggestion msg_id 和相似率失败: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("未找到 suggestion_id: %s", suggestionID)
+	}
+	return nil
+}
+
+func (s *gormSuggestionStore) RecentSuggestions(agentID, chatID string, before time.Time, limit int) ([]Suggestion, error) {
+	// GORM 的负数 Limit 表示不限制，与接口约定不一致
+	if limit <= 0 {
+		return nil, nil
+	}
+	var suggestions []Suggestion
+	if err := s.db.Where("agent_id = ? AND chat_id = ? AND created_at < ?", agentID, chatID, before).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&suggestions).Error; err != nil {
+		return nil, fmt.Errorf("查询 suggestion 失败: %w", err)
+	}
+	return suggestions, nil
+}
+
+// memorySuggestionStore 内存存储，进程退出后数据丢失，用于单元测试和本地调试
+type memorySuggestionStore struct {
+	mu          sync.Mutex
+	nextID      uint
+	suggestions map[string]*Suggestion // suggestion_id -> suggestion
+}
+
+func newMemorySuggestionStore() *memorySuggestionStore {
+	return &memorySuggestionStore{
+		suggestions: make(map[string]*Suggestion),
+	}
+}
+
+func (s *memorySuggestionStore) CreateSuggestion(suggestion Suggestion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.suggestions[suggestion.SuggestionID]; ok {
+		return fmt.Errorf("创建 suggestion 失败: suggestion_id 已存在: %s", suggestion.SuggestionID)
+	}
+	s.nextID++
+	suggestion.ID = s.nextID
+	now := time.Now()
+	if suggestion.CreatedAt.IsZero() {
+		suggestion.CreatedAt = now
+	}
+	if suggestion.UpdatedAt.IsZero() {
+		suggestion.UpdatedAt = now
+	}
+	s.suggestions[suggestion.SuggestionID] = &suggestion
+	return nil
+}
+
+func (s *memorySuggestionStore) UpdateFeedback(suggestionID, action, originalContent, editedContent string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	suggestion, ok := s.suggestions[suggestionID]
+	if !ok {
+		return fmt.Errorf("未找到 suggestion_id: %s", suggestionID)
+	}
+	suggestion.Action = action
+	if originalContent != "" {
+		suggestion.OriginalContent = originalContent
+	}
+	if editedContent != "" {
+		suggestion.EditedContent = editedContent
+	}
+	suggestion.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *memorySuggestionStore) UpdateMsgID(suggestionID, msgID string, similarity float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	suggestion, ok := s.suggestions[suggestionID]
+	if !ok {
+		return fmt.Errorf("未找到 suggestion_id: %s", suggestionID)
+	}
+	suggestion.MsgID = msgID
+	suggestion.Similarity = similarity
+	suggestion.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *memorySuggestionStore) RecentSuggestions(agentID, chatID string, before time.Time, limit int) ([]Suggestion, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var suggestions []Suggestion
+	for _, sug := range s.suggestions {
+		if sug.AgentID == agentID && sug.ChatID == chatID && sug.CreatedAt.Before(before) {
+			suggestions = append(suggestions, *sug)
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		return suggestions[i].CreatedAt.After(suggestions[j].CreatedAt)
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
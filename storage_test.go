@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// suggestionStoreFactories 各存储后端的构造函数，同一组用例在所有后端上运行
+var suggestionStoreFactories = map[string]func(t *testing.T) SuggestionStore{
+	storageDriverMemory: func(t *testing.T) SuggestionStore {
+		return newMemorySuggestionStore()
+	},
+	storageDriverSQLite: newTestSQLiteStore,
+}
+
+// newTestSQLiteStore 在临时目录中创建 SQLite 数据库并执行迁移
+func newTestSQLiteStore(t *testing.T) SuggestionStore {
+	t.Helper()
+	logger = zap.NewNop()
+	t.Setenv("DB_DRIVER", storageDriverSQLite)
+	t.Setenv("DB_SQLITE_PATH", filepath.Join(t.TempDir(), "sidebar.db"))
+	if err := openDatabase(); err != nil {
+		t.Fatalf("打开 SQLite 失败: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		db = nil
+		suggestionStore = nil
+	})
+	if _, err := migrateUp(context.Background()); err != nil {
+		t.Fatalf("迁移失败: %v", err)
+	}
+	return suggestionStore
+}
+
+// forEachSuggestionStore 在每个存储后端上运行 fn
+func forEachSuggestionStore(t *testing.T, fn func(t *testing.T, store SuggestionStore)) {
+	for name, factory := range suggestionStoreFactories {
+		t.Run(name, func(t *testing.T) {
+			fn(t, factory(t))
+		})
+	}
+}
+
+func TestSuggestionStoreRecentSuggestions(t *testing.T) {
+	base := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	fixtures := []Suggestion{
+		{SuggestionID: "s1", AgentID: "a1", ChatID: "c1", OriginalContent: "one", CreatedAt: base},
+		{SuggestionID: "s2", AgentID: "a1", ChatID: "c1", OriginalContent: "two", CreatedAt: base.Add(time.Minute)},
+		{SuggestionID: "s3", AgentID: "a1", ChatID: "c1", OriginalContent: "three", CreatedAt: base.Add(2 * time.Minute)},
+		{SuggestionID: "s4", AgentID: "a1", ChatID: "c2", OriginalContent: "other chat", CreatedAt: base},
+		{SuggestionID: "s5", AgentID: "a2", ChatID: "c1", OriginalContent: "other agent", CreatedAt: base},
+	}
+
+	tests := []struct {
+		name    string
+		agentID string
+		chatID  string
+		before  time.Time
+		limit   int
+		want    []string
+	}{
+		{name: "按创建时间倒序", agentID: "a1", chatID: "c1", before: base.Add(time.Hour), limit: 10, want: []string{"s3", "s2", "s1"}},
+		{name: "只返回 before 之前的", agentID: "a1", chatID: "c1", before: base.Add(2 * time.Minute), limit: 10, want: []string{"s2", "s1"}},
+		{name: "最多 limit 条", agentID: "a1", chatID: "c1", before: base.Add(time.Hour), limit: 2, want: []string{"s3", "s2"}},
+		{name: "按会话过滤", agentID: "a1", chatID: "c2", before: base.Add(time.Hour), limit: 10, want: []string{"s4"}},
+		{name: "按客服过滤", agentID: "a2", chatID: "c1", before: base.Add(time.Hour), limit: 10, want: []string{"s5"}},
+		{name: "没有匹配", agentID: "a3", chatID: "c1", before: base.Add(time.Hour), limit: 10, want: nil},
+		{name: "limit 为 0", agentID: "a1", chatID: "c1", before: base.Add(time.Hour), limit: 0, want: nil},
+		{name: "limit 为负数", agentID: "a1", chatID: "c1", before: base.Add(time.Hour), limit: -1, want: nil},
+	}
+
+	forEachSuggestionStore(t, func(t *testing.T, store SuggestionStore) {
+		for _, sug := range fixtures {
+			if err := store.CreateSuggestion(sug); err != nil {
+				t.Fatalf("CreateSuggestion(%s): %v", sug.SuggestionID, err)
+			}
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := store.RecentSuggestions(tt.agentID, tt.chatID, tt.before, tt.limit)
+				if err != nil {
+					t.Fatalf("RecentSuggestions: %v", err)
+				}
+				var ids []string
+				for _, sug := range got {
+					ids = append(ids, sug.SuggestionID)
+				}
+				if !equalStrings(ids, tt.want) {
+					t.Errorf("RecentSuggestions = %v, want %v", ids, tt.want)
+				}
+			})
+		}
+	})
+}
+
+func TestSuggestionStoreCreateDuplicate(t *testing.T) {
+	forEachSuggestionStore(t, func(t *testing.T, store SuggestionStore) {
+		sug := Suggestion{SuggestionID: "dup", AgentID: "a1", ChatID: "c1"}
+		if err := store.CreateSuggestion(sug); err != nil {
+			t.Fatalf("CreateSuggestion: %v", err)
+		}
+		if err := store.CreateSuggestion(sug); err == nil {
+			t.Error("重复的 suggestion_id 应返回错误")
+		}
+	})
+}
+
+func TestSuggestionStoreUpdates(t *testing.T) {
+	tests := []struct {
+		name         string
+		update       func(store SuggestionStore) error
+		wantErr      bool
+		wantAction   string
+		wantOriginal string
+		wantEdited   string
+		wantMsgID    string
+		wantSim      float64
+	}{
+		{
+			name:         "更新反馈",
+			update:       func(store SuggestionStore) error { return store.UpdateFeedback("s1", "edit", "new original", "edited") },
+			wantAction:   "edit",
+			wantOriginal: "new original",
+			wantEdited:   "edited",
+		},
+		{
+			name:         "空内容不覆盖",
+			update:       func(store SuggestionStore) error { return store.UpdateFeedback("s1", "use", "", "") },
+			wantAction:   "use",
+			wantOriginal: "original",
+		},
+		{
+			name:         "更新关联消息",
+			update:       func(store SuggestionStore) error { return store.UpdateMsgID("s1", "m1", 87.5) },
+			wantOriginal: "original",
+			wantMsgID:    "m1",
+			wantSim:      87.5,
+		},
+		{
+			name:         "反馈的 suggestion 不存在",
+			update:       func(store SuggestionStore) error { return store.UpdateFeedback("missing", "use", "", "") },
+			wantErr:      true,
+			wantOriginal: "original",
+		},
+		{
+			name:         "关联的 suggestion 不存在",
+			update:       func(store SuggestionStore) error { return store.UpdateMsgID("missing", "m1", 90) },
+			wantErr:      true,
+			wantOriginal: "original",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachSuggestionStore(t, func(t *testing.T, store SuggestionStore) {
+				created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+				if err := store.CreateSuggestion(Suggestion{
+					SuggestionID:    "s1",
+					AgentID:         "a1",
+					ChatID:          "c1",
+					OriginalContent: "original",
+					CreatedAt:       created,
+				}); err != nil {
+					t.Fatalf("CreateSuggestion: %v", err)
+				}
+
+				err := tt.update(store)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+				}
+
+				got, err := store.RecentSuggestions("a1", "c1", created.Add(time.Second), 1)
+				if err != nil || len(got) != 1 {
+					t.Fatalf("RecentSuggestions = %v, %v", got, err)
+				}
+				sug := got[0]
+				if sug.Action != tt.wantAction || sug.OriginalContent != tt.wantOriginal || sug.EditedContent != tt.wantEdited {
+					t.Errorf("action, original, edited = %q, %q, %q, want %q, %q, %q",
+						sug.Action, sug.OriginalContent, sug.EditedContent, tt.wantAction, tt.wantOriginal, tt.wantEdited)
+				}
+				if sug.MsgID != tt.wantMsgID || sug.Similarity != tt.wantSim {
+					t.Errorf("msg_id, similarity = %q, %v, want %q, %v", sug.MsgID, sug.Similarity, tt.wantMsgID, tt.wantSim)
+				}
+			})
+		})
+	}
+}
+
+// equalStrings 两个字符串切片是否按顺序相同，nil 与空切片视为相同
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm/clause"
+)
+
+// ChatSummary 结构化的会话摘要
+type ChatSummary struct {
+	ChatID        string    `json:"chat_id"`
+	CustomerIssue string    `json:"customer_issue"` // 客户的问题
+	Promises      []string  `json:"promises"`       // 客服已做出的承诺
+	OpenItems     []string  `json:"open_items"`     // 待处理事项
+	LastMsgID     string    `json:"last_msg_id"`    // 生成摘要时的最后一条消息
+	MessageCount  int       `json:"message_count"`  // 参与摘要的消息条数
+	GeneratedAt   time.Time `json:"generated_at"`
+}
+
+// ChatSummaryRecord chat_summaries 表模型，会话摘要缓存
+type ChatSummaryRecord struct {
+	ID            uint   `gorm:"primaryKey;autoIncrement"`
+	ChatID        string `gorm:"type:varchar(255);uniqueIndex;not null"`
+	CustomerIssue string `gorm:"type:text"`
+	Promises      string `gorm:"type:text"` // JSON 数组
+	OpenItems     string `gorm:"type:text"` // JSON 数组
+	LastMsgID     string `gorm:"type:varchar(255)"`
+	MessageCount  int
+	GeneratedAt   time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// TableName 指定表名
+func (ChatSummaryRecord) TableName() string {
+	return "chat_summaries"
+}
+
+// ChatSummaryStore 缓存会话摘要，会话有新消息时失效
+// 摘要同时保存到 chat_summaries 表，读取时以最后一条消息判断是否仍然有效，
+// 因此其他实例或重启后读取到的摘要也不会过期
+type ChatSummaryStore struct {
+	mu        sync.RWMutex
+	summaries map[string]ChatSummary
+}
+
+var chatSummaries = &ChatSummaryStore{
+	summaries: make(map[string]ChatSummary),
+}
+
+// Invalidate 使会话摘要失效
+func (s *ChatSummaryStore) Invalidate(chatID string) {
+	s.mu.Lock()
+	delete(s.summaries, chatID)
+	s.mu.Unlock()
+}
+
+// Get 获取会话摘要（可能已过期），内存未命中时回查数据库
+func (s *ChatSummaryStore) Get(chatID string) (ChatSummary, bool) {
+	s.mu.RLock()
+	summary, ok := s.summaries[chatID]
+	s.mu.RUnlock()
+	if ok || db == nil {
+		return summary, ok
+	}
+
+	var record ChatSummaryRecord
+	if err := db.Where("chat_id = ?", chatID).Limit(1).Find(&record).Error; err != nil {
+		logger.Warn("查询会话摘要失败", zap.String("chat_id", chatID), zap.Error(err))
+		return ChatSummary{}, false
+	}
+	if record.ID == 0 {
+		return ChatSummary{}, false
+	}
+
+	summary = ChatSummary{
+		ChatID:        record.ChatID,
+		CustomerIssue: record.CustomerIssue,
+		LastMsgID:     record.LastMsgID,
+		MessageCount:  record.MessageCount,
+		GeneratedAt:   record.GeneratedAt,
+	}
+	json.Unmarshal([]byte(record.Promises), &summary.Promises)
+	json.Unmarshal([]byte(record.OpenItems), &summary.OpenItems)
+	return summary, true
+}
+
+// Save 保存会话摘要
+func (s *ChatSummaryStore) Save(summary ChatSummary) error {
+	s.mu.Lock()
+	s.summaries[summary.ChatID] = summary
+	s.mu.Unlock()
+
+	if db == nil {
+		return nil
+	}
+
+	promises, err := json.Marshal(summary.Promises)
+	if err != nil {
+		return fmt.Errorf("序列化承诺事项失败: %w", err)
+	}
+	openItems, err := json.Marshal(summary.OpenItems)
+	if err != nil {
+		return fmt.Errorf("序列化待处理事项失败: %w", err)
+	}
+
+	record := ChatSummaryRecord{
+		ChatID:        summary.ChatID,
+		CustomerIssue: summary.CustomerIssue,
+		Promises:      string(promises),
+		OpenItems:     string(openItems),
+		LastMsgID:     summary.LastMsgID,
+		MessageCount:  summary.MessageCount,
+		GeneratedAt:   summary.GeneratedAt,
+	}
+	err = db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chat_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"customer_issue", "promises", "open_items", "last_msg_id", "message_count", "generated_at", "updated_at"}),
+	}).Create(&record).Error
+	if err != nil {
+		return fmt.Errorf("保存会话摘要失败: %w", err)
+	}
+	return nil
+}
+
+// lastMsgID 获取消息列表中最后一条消息的ID
+func lastMsgID(messages []ChatHistoryEntry) string {
+	if len(messages) == 0 {
+		return ""
+	}
+	return messages[len(messages)-1].MsgID
+}
+
+// parseChatSummary 从 Agent 响应中解析会话摘要
+// 支持 data 直接包含摘要字段，或 data["0"].content 为摘要的 JSON 文本；
+// 无法解析为结构化结果时，将文本整体作为客户问题
+func parseChatSummary(agentResp *AgentResponse) ChatSummary {
+	var summary ChatSummary
+	if agentResp != nil && agentResp.Data != nil {
+		if _, ok := agentResp.Data["customer_issue"]; ok {
+			if raw, err := json.Marshal(agentResp.Data); err == nil {
+				json.Unmarshal(raw, &summary)
+			}
+		} else if text := agentResponseText(agentResp); text != "" {
+			if err := json.Unmarshal([]byte(text), &summary); err != nil {
+				summary.CustomerIssue = text
+			}
+		}
+	}
+
+	if summary.Promises == nil {
+		summary.Promises = []string{}
+	}
+	if summary.OpenItems == nil {
+		summary.OpenItems = []string{}
+	}
+	return summary
+}
+
+// errNoChatMessages 会话没有可供摘要的消息
+var errNoChatMessages = errors.New("会话没有消息记录")
+
+// summarizeChat 获取会话摘要，缓存仍然有效且未要求刷新时直接返回缓存
+// 返回的 cached 表示是否命中缓存
+func (c *WeComClient) summarizeChat(ctx context.Context, chatID string, refresh bool) (summary ChatSummary, cached bool, err error) {
+	messages, err := loadChatTranscript(chatID, getEnvInt("CHAT_SUMMARY_MAX_MESSAGES", 200))
+	if err != nil {
+		return ChatSummary{}, false, err
+	}
+	if len(messages) == 0 {
+		return ChatSummary{}, false, errNoChatMessages
+	}
+
+	last := lastMsgID(messages)
+	if !refresh {
+		if summary, ok := chatSummaries.Get(chatID); ok && summary.LastMsgID == last && summary.MessageCount == len(messages) {
+			return summary, true, nil
+		}
+	}
+
+	// 会话内容脱敏后发送给 Agent，摘要中的占位符还原后展示
+	redactor := newPIIRedactor()
+	agentResp, err := c.callAgentAPI(ctx, agentCallRequest{
+		ChatID:    chatID,
+		EventType: "chat_summary",
+		Contents: []AgentCallContent{
+			{Type: "context", Content: messages},
+		},
+		Redactor:  redactor,
+		Stateless: true,
+	})
+	if err != nil {
+		return ChatSummary{}, false, err
+	}
+
+	summary = parseChatSummary(agentResp)
+	summary.ChatID = chatID
+	summary.CustomerIssue = redactor.Restore(summary.CustomerIssue)
+	for i, promise := range summary.Promises {
+		summary.Promises[i] = redactor.Restore(promise)
+	}
+	for i, item := range summary.OpenItems {
+		summary.OpenItems[i] = redactor.Restore(item)
+	}
+	summary.LastMsgID = last
+	summary.MessageCount = len(messages)
+	summary.GeneratedAt = time.Now()
+
+	if err := chatSummaries.Save(summary); err != nil {
+		logger.Warn("缓存会话摘要失败", zap.String("chat_id", chatID), zap.Error(err))
+	}
+	return summary, false, nil
+}
+
+// handleSummarizeChat 处理会话摘要请求
+func (c *WeComClient) handleSummarizeChat(msg WeComMessage) {
+	chatID := msg.ChatID
+	if chatID == "" {
+		chatID = c.ChatID
+	}
+
+	logger.Info("收到会话摘要请求", zap.String("agent_id", c.AgentID), zap.String("chat_id", chatID))
+
+	summary, cached, err := c.summarizeChat(c.ctx, chatID, false)
+	if err != nil {
+		var throttle *ThrottleError
+		switch {
+		case errors.Is(err, ErrCircuitOpen):
+			c.notifyAIUnavailable(chatID, "")
+		case errors.As(err, &throttle):
+			c.notifyAIThrottled(chatID, msg.MsgID, throttle)
+		}
+		logger.Error("生成会话摘要失败", zap.String("agent_id", c.AgentID), zap.String("chat_id", chatID), zap.Error(err))
+		if sendErr := c.SendMessage(map[string]interface{}{
+			"type":     "chat_summary_error",
+			"agent_id": c.AgentID,
+			"chat_id":  chatID,
+			"error":    err.Error(),
+		}); sendErr != nil {
+			logger.Error("发送 chat_summary_error 消息失败", zap.String("agent_id", c.AgentID), zap.Error(sendErr))
+		}
+		return
+	}
+
+	if err := c.SendMessage(map[string]interface{}{
+		"type":     "chat_summary",
+		"agent_id": c.AgentID,
+		"chat_id":  chatID,
+		"summary":  summary,
+		"cached":   cached,
+	}); err != nil {
+		logger.Error("发送会话摘要失败", zap.String("agent_id", c.AgentID), zap.Error(err))
+	}
+}
+
+// ChatSummaryHandler 主管查询会话摘要
+// GET /api/chats/{chat_id}/summary[?refresh=true]
+// 缓存的摘要已过期或 refresh=true 时重新生成
+func ChatSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	chatID := r.PathValue("chat_id")
+	if chatID == "" {
+		writeJSONError(w, http.StatusBadRequest, "chat_id 不能为空")
+		return
+	}
+
+	// 不经过侧边栏连接，使用不复用会话的独立客户端调用 Agent
+	client := &WeComClient{AgentID: "supervisor"}
+	summary, cached, err := client.summarizeChat(r.Context(), chatID, r.URL.Query().Get("refresh") == "true")
+	if err != nil {
+		var throttle *ThrottleError
+		switch {
+		case errors.Is(err, errNoChatMessages):
+			writeJSONError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, ErrCircuitOpen):
+			writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+		case errors.As(err, &throttle):
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttle.RetryAfter.Seconds()))))
+			writeJSONError(w, http.StatusTooManyRequests, err.Error())
+		default:
+			logger.Error("生成会话摘要失败", zap.String("chat_id", chatID), zap.Error(err))
+			writeJSONError(w, http.StatusBadGateway, "生成会话摘要失败")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"summary": summary,
+		"cached":  cached,
+	})
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// SupervisorClient 主管的 WebSocket 连接
+type SupervisorClient struct {
+	Conn         *websocket.Conn
+	SupervisorID string
+	Send         chan []byte
+}
+
+// SupervisorHub 主管频道，向所有在线主管推送升级提醒
+type SupervisorHub struct {
+	clients    map[*SupervisorClient]bool
+	broadcast  chan []byte
+	register   chan *SupervisorClient
+	unregister chan *SupervisorClient
+}
+
+// NewSupervisorHub 创建主管频道
+func NewSupervisorHub() *SupervisorHub {
+	return &SupervisorHub{
+		clients:    make(map[*SupervisorClient]bool),
+		broadcast:  make(chan []byte, 256),
+		register:   make(chan *SupervisorClient),
+		unregister: make(chan *SupervisorClient),
+	}
+}
+
+var supervisorHub = NewSupervisorHub()
+
+// Run 运行主管频道
+func (h *SupervisorHub) Run() {
+	for {
+		select {
+		case client := <-h.register:
+			h.clients[client] = true
+			logger.Info("主管已连接", zap.String("supervisor_id", client.SupervisorID), zap.Int("online", len(h.clients)))
+
+		case client := <-h.unregister:
+			if _, ok := h.clients[client]; ok {
+				delete(h.clients, client)
+				close(client.Send)
+				logger.Info("主管已断开", zap.String("supervisor_id", client.SupervisorID))
+			}
+
+		case message := <-h.broadcast:
+			for client := range h.clients {
+				select {
+				case client.Send <- message:
+				default:
+					// 发送缓冲区已满，断开连接，主管可重连后通过 HTTP 接口补查
+					close(client.Send)
+					delete(h.clients, client)
+				}
+			}
+		}
+	}
+}
+
+// Broadcast 推送消息给所有在线主管，频道繁忙时丢弃（升级事件已入库，可通过 HTTP 接口查询）
+func (h *SupervisorHub) Broadcast(data interface{}) {
+	message, err := json.Marshal(data)
+	if err != nil {
+		logger.Error("序列化主管消息失败", zap.Error(err))
+		return
+	}
+
+	select {
+	case h.broadcast <- message:
+	default:
+		logger.Warn("主管频道繁忙，丢弃消息")
+	}
+}
+
+// supervisorSubprotocol 浏览器无法为 WebSocket 设置请求头，改为在子协议中携带令牌：
+// new WebSocket(url, ["bearer", token])，服务端选择 bearer 子协议完成握手
+const supervisorSubprotocol = "bearer"
+
+// supervisorToken 获取主管频道请求携带的令牌
+// 优先读取 Authorization 请求头，其次读取 Sec-WebSocket-Protocol 中紧跟 bearer 的子协议；
+// 不接受 URL 参数，避免令牌出现在访问日志中
+func supervisorToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	protocols := websocket.Subprotocols(r)
+	for i := 0; i+1 < len(protocols); i++ {
+		if protocols[i] == supervisorSubprotocol {
+			return protocols[i+1]
+		}
+	}
+	return ""
+}
+
+// supervisorAuthorized 校验主管频道的访问令牌，未设置 ADMIN_API_TOKEN 时拒绝连接
+func supervisorAuthorized(r *http.Request) bool {
+	token := os.Getenv("ADMIN_API_TOKEN")
+	if token == "" {
+		return false
+	}
+
+	return adminTokenMatches(supervisorToken(r), token)
+}
+
+// SupervisorWebSocketHandler 主管频道 WebSocket 处理器
+// GET /ws/supervisor?supervisor_id=...，请求头 Authorization: Bearer <token>，
+// 或浏览器中 Sec-WebSocket-Protocol: bearer, <token>
+func SupervisorWebSocketHandler(hub *SupervisorHub) http.HandlerFunc {
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		Subprotocols:    []string{supervisorSubprotocol},
+		CheckOrigin: func(r *http.Request) bool {
+			return true // 生产环境需要严格检查
+		},
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !supervisorAuthorized(r) {
+			writeJSONError(w, http.StatusUnauthorized, "未授权")
+			return
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			logger.Error("主管 WebSocket 升级失败", zap.Error(err))
+			return
+		}
+
+		client := &SupervisorClient{
+			Conn:         conn,
+			SupervisorID: r.URL.Query().Get("supervisor_id"),
+			Send:         make(chan []byte, 256),
+		}
+		hub.register <- client
+
+		go client.writePump()
+		go client.readPump(hub)
+	}
+}
+
+// readPump 读取主管消息：确认或解决升级事件
+func (s *SupervisorClient) readPump(hub *SupervisorHub) {
+	defer func() {
+		hub.unregister <- s
+		s.Conn.Close()
+	}()
+
+	s.Conn.SetReadLimit(5120)
+	s.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	s.Conn.SetPongHandler(func(string) error {
+		s.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		return nil
+	})
+
+	for {
+		_, data, err := s.Conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				logger.Error("主管连接读取错误", zap.Error(err))
+			}
+			break
+		}
+
+		var msg struct {
+			Type         string `json:"type"`
+			EscalationID uint   `json:"escalation_id"`
+		}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			logger.Error("解析主管消息失败", zap.Error(err))
+			continue
+		}
+
+		switch msg.Type {
+		case "ack_escalation":
+			s.updateEscalation(msg.EscalationID, escalationStatusAcknowledged)
+		case "resolve_escalation":
+			s.updateEscalation(msg.EscalationID, escalationStatusResolved)
+		case "pong":
+			s.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		}
+	}
+}
+
+// updateEscalation 更新升级事件状态，结果通过 escalation_updated 广播给所有主管
+func (s *SupervisorClient) updateEscalation(id uint, status string) {
+	if _, err := updateEscalationStatus(id, status, s.SupervisorID); err != nil {
+		logger.Error("更新升级事件失败",
+			zap.String("supervisor_id", s.SupervisorID),
+			zap.Uint("escalation_id", id),
+			zap.String("status", status),
+			zap.Error(err))
+	}
+}
+
+// writePump 写入消息
+func (s *SupervisorClient) writePump() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer func() {
+		ticker.Stop()
+		s.Conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-s.Send:
+			s.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if !ok {
+				s.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := s.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			s.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := s.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
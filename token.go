@@ -6,11 +6,21 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"os"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
 )
 
+// wecomAPIBaseURL 企业微信 API 地址，可通过 WECOM_API_BASE_URL 指向本地模拟服务
+func wecomAPIBaseURL() string {
+	if baseURL := os.Getenv("WECOM_API_BASE_URL"); baseURL != "" {
+		return strings.TrimRight(baseURL, "/")
+	}
+	return "https://qyapi.weixin.qq.com"
+}
+
 // getAccessToken 获取企业微信 access_token
 func getAccessToken(corpID, corpSecret string) (string, error) {
 	// 检查缓存
@@ -23,8 +33,8 @@ func getAccessToken(corpID, corpSecret string) (string, error) {
 	tokenCache.mu.RUnlock()
 
 	// 从 API 获取
-	apiURL := fmt.Sprintf("https://qyapi.weixin.qq.com/cgi-bin/gettoken?corpid=%s&corpsecret=%s",
-		url.QueryEscape(corpID), url.QueryEscape(corpSecret))
+	apiURL := fmt.Sprintf("%s/cgi-bin/gettoken?corpid=%s&corpsecret=%s",
+		wecomAPIBaseURL(), url.QueryEscape(corpID), url.QueryEscape(corpSecret))
 
 	resp, err := http.Get(apiURL)
 	if err != nil {
@@ -115,10 +125,10 @@ func getJSAPITicket(corpID, corpSecret string, useAgentConfig bool) (string, err
 	var apiURL string
 	if useAgentConfig {
 		// 应用的 jsapi_ticket API（使用企业的 ticket API）
-		apiURL = fmt.Sprintf("https://qyapi.weixin.qq.com/cgi-bin/ticket/get?access_token=%s&type=agent_config", url.QueryEscape(accessToken))
+		apiURL = fmt.Sprintf("%s/cgi-bin/ticket/get?access_token=%s&type=agent_config", wecomAPIBaseURL(), url.QueryEscape(accessToken))
 	} else {
 		// 企业的 jsapi_ticket API（使用应用的 ticket API）
-		apiURL = fmt.Sprintf("https://qyapi.weixin.qq.com/cgi-bin/get_jsapi_ticket?access_token=%s", url.QueryEscape(accessToken))
+		apiURL = fmt.Sprintf("%s/cgi-bin/get_jsapi_ticket?access_token=%s", wecomAPIBaseURL(), url.QueryEscape(accessToken))
 	}
 
 	resp, err := http.Get(apiURL)
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"unicode"
+)
+
+// 分词规则：
+//   - 英文、数字按连续的字母数字切分为词，转小写，忽略单字符
+//   - 中日韩文字没有空格分隔，按相邻两字切分为二元组（"怎么退货" → 怎么、么退、退货），
+//     只有一个字的片段保留单字
+//   - 中英文混排时在文字种类变化处切分（"iPhone15怎么退货" → iphone15、怎么、么退、退货）
+//   - 全角字母数字按半角处理
+//
+// 设置 TOKENIZER_STOP_WORDS=true 时去除停用词：英文停用词整词去除，中文停用字视为分隔符
+
+// englishStopWords 英文停用词
+var englishStopWords = map[string]bool{
+	"a": true, "an": true, "the": true, "and": true, "or": true, "but": true,
+	"is": true, "are": true, "was": true, "were": true, "be": true, "been": true,
+	"am": true, "do": true, "does": true, "did": true, "to": true, "of": true,
+	"in": true, "on": true, "at": true, "for": true, "with": true, "by": true,
+	"from": true, "it": true, "its": true, "this": true, "that": true, "these": true,
+	"those": true, "i": true, "me": true, "my": true, "you": true, "your": true,
+	"we": true, "our": true, "he": true, "she": true, "they": true, "them": true,
+	"please": true, "can": true, "could": true, "would": true, "will": true, "just": true,
+}
+
+// chineseStopChars 中文停用字（语气词、助词等）
+var chineseStopChars = map[rune]bool{
+	'的': true, '了': true, '吗': true, '呢': true, '吧': true, '啊': true,
+	'呀': true, '哦': true, '嗯': true, '哈': true, '嘛': true, '着': true,
+	'和': true, '与': true, '及': true, '就': true, '都': true, '也': true,
+	'还': true, '又': true, '请': true, '您': true, '你': true, '我': true,
+	'是': true,
+}
+
+// tokenizerStopWords 是否去除停用词
+func tokenizerStopWords() bool {
+	return os.Getenv("TOKENIZER_STOP_WORDS") == "true"
+}
+
+// isCJK 是否为中日韩文字
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r)
+}
+
+// foldWidth 全角字母数字转为半角
+func foldWidth(r rune) rune {
+	if r >= 0xFF10 && r <= 0xFF5A && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+		return r - 0xFEE0
+	}
+	return r
+}
+
+// tokenize 将文本分词并返回词频映射
+func tokenize(text string) map[string]int {
+	words := make(map[string]int)
+	stopWords := tokenizerStopWords()
+
+	var word strings.Builder
+	var cjk []rune
+
+	flushWord := func() {
+		if word.Len() == 0 {
+			return
+		}
+		w := word.String()
+		word.Reset()
+		if len(w) <= 1 { // 忽略单字符
+			return
+		}
+		if stopWords && englishStopWords[w] {
+			return
+		}
+		words[w]++
+	}
+	flushCJK := func() {
+		switch len(cjk) {
+		case 0:
+			return
+		case 1:
+			words[string(cjk)]++
+		default:
+			for i := 0; i+1 < len(cjk); i++ {
+				words[string(cjk[i:i+2])]++
+			}
+		}
+		cjk = cjk[:0]
+	}
+
+	for _, r := range text {
+		r = foldWidth(r)
+		switch {
+		case isCJK(r):
+			flushWord()
+			if stopWords && chineseStopChars[r] {
+				flushCJK()
+				continue
+			}
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word.WriteRune(unicode.ToLower(r))
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+
+	return words
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		stopWords bool
+		want      map[string]int
+	}{
+		{name: "空文本", text: "", want: map[string]int{}},
+		{name: "英文转小写并计数", text: "Hello, World! hello", want: map[string]int{"hello": 2, "world": 1}},
+		{name: "忽略单字符英文", text: "a b ok", want: map[string]int{"ok": 1}},
+		{name: "中文二元组", text: "怎么退货", want: map[string]int{"怎么": 1, "么退": 1, "退货": 1}},
+		{name: "单个汉字保留", text: "好", want: map[string]int{"好": 1}},
+		{name: "中英文混排", text: "iPhone15怎么退货", want: map[string]int{"iphone15": 1, "怎么": 1, "么退": 1, "退货": 1}},
+		{name: "标点分隔中文", text: "退货，换货", want: map[string]int{"退货": 1, "换货": 1}},
+		{name: "全角字母数字", text: "ＡＢＣ１２", want: map[string]int{"abc12": 1}},
+		{name: "去除英文停用词", text: "the order is late", stopWords: true, want: map[string]int{"order": 1, "late": 1}},
+		{name: "中文停用字作为分隔符", text: "我的订单", stopWords: true, want: map[string]int{"订单": 1}},
+		{name: "未开启时保留停用词", text: "我的订单", want: map[string]int{"我的": 1, "的订": 1, "订单": 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.stopWords {
+				t.Setenv("TOKENIZER_STOP_WORDS", "true")
+			}
+			if got := tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tokenize(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
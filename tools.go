@@ -0,0 +1,466 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// AgentToolDefinition 发送给 Agent 的工具定义（AgentCallEvent.Tools）
+type AgentToolDefinition struct {
+	Name        string                 `json:"name"`        // 工具名称
+	Description string                 `json:"description"` // 工具描述
+	Parameters  map[string]interface{} `json:"parameters"`  // 参数 JSON Schema
+}
+
+// AgentToolCall Agent 请求的工具调用
+type AgentToolCall struct {
+	ID        string          `json:"id"`        // 调用ID，结果中原样返回
+	Name      string          `json:"name"`      // 工具名称
+	Arguments json.RawMessage `json:"arguments"` // 调用参数（JSON 对象）
+}
+
+// AgentToolResult 工具调用结果，作为 tool_result 内容发送给 Agent
+type AgentToolResult struct {
+	ToolCallID string      `json:"tool_call_id"`
+	Name       string      `json:"name"`
+	Result     interface{} `json:"result,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// toolContext 工具执行上下文
+type toolContext struct {
+	AgentID string
+	ChatID  string
+}
+
+// Tool 服务端注册的工具
+type Tool struct {
+	Definition AgentToolDefinition
+	Timeout    time.Duration // 单次执行超时，为 0 时使用 AGENT_TOOL_TIMEOUT
+	execute    func(ctx context.Context, tc toolContext, args json.RawMessage) (interface{}, error)
+}
+
+// newTool 创建带类型参数的工具，调用参数会解码为 A 类型后交给 handler
+func newTool[A any](name, description string, parameters map[string]interface{}, handler func(ctx context.Context, tc toolContext, args A) (interface{}, error)) *Tool {
+	return &Tool{
+		Definition: AgentToolDefinition{
+			Name:        name,
+			Description: description,
+			Parameters:  parameters,
+		},
+		execute: func(ctx context.Context, tc toolContext, raw json.RawMessage) (interface{}, error) {
+			var args A
+			if len(raw) > 0 && string(raw) != "null" {
+				if err := json.Unmarshal(raw, &args); err != nil {
+					return nil, fmt.Errorf("解析工具参数失败: %w", err)
+				}
+			}
+			return handler(ctx, tc, args)
+		},
+	}
+}
+
+// ToolRegistry 工具注册表
+type ToolRegistry struct {
+	mu    sync.RWMutex
+	tools map[string]*Tool
+	order []string // 注册顺序，保证发送给 Agent 的工具列表稳定
+}
+
+var toolRegistry = &ToolRegistry{
+	tools: make(map[string]*Tool),
+}
+
+// Register 注册工具，同名工具会被覆盖
+func (r *ToolRegistry) Register(tool *Tool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := tool.Definition.Name
+	if _, exists := r.tools[name]; !exists {
+		r.order = append(r.order, name)
+	}
+	r.tools[name] = tool
+}
+
+// Definitions 返回所有工具定义
+func (r *ToolRegistry) Definitions() []interface{} {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	definitions := make([]interface{}, 0, len(r.order))
+	for _, name := range r.order {
+		definitions = append(definitions, r.tools[name].Definition)
+	}
+	return definitions
+}
+
+// Execute 执行一次工具调用并记录审计日志
+func (r *ToolRegistry) Execute(ctx context.Context, tc toolContext, call AgentToolCall) AgentToolResult {
+	result := AgentToolResult{
+		ToolCallID: call.ID,
+		Name:       call.Name,
+	}
+
+	r.mu.RLock()
+	tool, ok := r.tools[call.Name]
+	r.mu.RUnlock()
+
+	start := time.Now()
+	var err error
+	if !ok {
+		err = fmt.Errorf("未知的工具: %s", call.Name)
+	} else {
+		timeout := tool.Timeout
+		if timeout <= 0 {
+			timeout = getEnvDuration("AGENT_TOOL_TIMEOUT", 5*time.Second)
+		}
+		toolCtx, cancel := context.WithTimeout(ctx, timeout)
+		result.Result, err = tool.execute(toolCtx, tc, call.Arguments)
+		cancel()
+	}
+	duration := time.Since(start)
+
+	if err != nil {
+		result.Result = nil
+		result.Error = err.Error()
+		logger.Warn("工具调用失败",
+			zap.String("agent_id", tc.AgentID),
+			zap.String("chat_id", tc.ChatID),
+			zap.String("tool", call.Name),
+			zap.Duration("duration", duration),
+			zap.Error(err))
+	} else {
+		logger.Info("工具调用成功",
+			zap.String("agent_id", tc.AgentID),
+			zap.String("chat_id", tc.ChatID),
+			zap.String("tool", call.Name),
+			zap.Duration("duration", duration))
+	}
+
+	if auditErr := createToolInvocation(tc, call, result, duration); auditErr != nil {
+		logger.Warn("记录工具调用审计日志失败", zap.String("tool", call.Name), zap.Error(auditErr))
+	}
+
+	return result
+}
+
+// parseToolCalls 从 Agent 响应中解析工具调用请求
+// 格式: data.tool_calls = [{"id": "...", "name": "...", "arguments": {...}}]
+func parseToolCalls(agentResp *AgentResponse) []AgentToolCall {
+	if agentResp == nil || agentResp.Data == nil {
+		return nil
+	}
+	raw, ok := agentResp.Data["tool_calls"]
+	if !ok {
+		return nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	var calls []AgentToolCall
+	if err := json.Unmarshal(data, &calls); err != nil {
+		logger.Warn("解析工具调用请求失败", zap.Error(err))
+		return nil
+	}
+	return calls
+}
+
+// callAgentWithTools 调用 Agent 并执行其请求的工具调用
+// Agent 返回 tool_calls 时由服务端执行工具，将结果追加到 Contents 后继续调用，直到得到最终结果
+func (c *WeComClient) callAgentWithTools(ctx context.Context, call agentCallRequest) (*AgentResponse, error) {
+	call.Tools = toolRegistry.Definitions()
+	tc := toolContext{AgentID: c.AgentID, ChatID: call.ChatID}
+	maxRounds := getEnvInt("AGENT_TOOL_MAX_ROUNDS", 5)
+
+	for round := 0; ; round++ {
+		agentResp, err := c.callAgentAPI(ctx, call)
+		if err != nil {
+			return nil, err
+		}
+
+		toolCalls := parseToolCalls(agentResp)
+		if len(toolCalls) == 0 {
+			return agentResp, nil
+		}
+		if round >= maxRounds {
+			return nil, fmt.Errorf("工具调用轮数超过上限: %d", maxRounds)
+		}
+
+		logger.Info("Agent 请求调用工具",
+			zap.String("agent_id", c.AgentID),
+			zap.String("chat_id", call.ChatID),
+			zap.Int("round", round+1),
+			zap.Int("tool_calls", len(toolCalls)))
+
+		// 并发执行本轮的所有工具调用，结果按请求顺序返回
+		results := make([]AgentToolResult, len(toolCalls))
+		var wg sync.WaitGroup
+		for i, toolCall := range toolCalls {
+			wg.Add(1)
+			go func(i int, toolCall AgentToolCall) {
+				defer wg.Done()
+				// Agent 看到的是脱敏后的内容，参数中的占位符还原后再执行工具
+				toolCall.Arguments = json.RawMessage(call.Redactor.Restore(string(toolCall.Arguments)))
+				results[i] = toolRegistry.Execute(ctx, tc, toolCall)
+			}(i, toolCall)
+		}
+		wg.Wait()
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		call.Contents = append(call.Contents,
+			AgentCallContent{Type: "tool_calls", Content: toolCalls},
+			AgentCallContent{Type: "tool_result", Content: results},
+		)
+	}
+}
+
+// registerBuiltinTools 注册内置工具
+func registerBuiltinTools() {
+	toolRegistry.Register(newTool("get_customer_profile",
+		"查询当前客户的企业微信客户资料，包括姓名、企业、性别以及添加了该客户的客服备注和标签",
+		map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		},
+		getCustomerProfileTool))
+
+	toolRegistry.Register(newTool("get_past_conversations",
+		"查询当前客户最近的会话消息",
+		map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"limit": map[string]interface{}{
+					"type":        "integer",
+					"description": "返回的最大消息条数，默认 20",
+				},
+			},
+		},
+		getPastConversationsTool))
+
+	// 工单系统是外部服务，配置了 TICKET_API_URL 才注册
+	if os.Getenv("TICKET_API_URL") != "" {
+		toolRegistry.Register(newTool("get_open_tickets",
+			"查询当前会话关联的未关闭工单",
+			map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			getOpenTicketsTool))
+	}
+}
+
+// getCustomerProfileTool 调用企业微信客户联系接口查询当前会话客户的资料
+// 只查询当前会话的客户，不接受模型指定的客户ID，避免客户消息中的提示注入查询其他客户
+func getCustomerProfileTool(ctx context.Context, tc toolContext, args struct{}) (interface{}, error) {
+	externalUserID := tc.ChatID
+	if externalUserID == "" {
+		return nil, errors.New("当前会话没有客户")
+	}
+
+	corpID := os.Getenv("WECOM_CORP_ID")
+	corpSecret := os.Getenv("WECOM_CORP_SECRET")
+	if corpID == "" || corpSecret == "" {
+		return nil, errors.New("缺少 WECOM_CORP_ID 或 WECOM_CORP_SECRET 环境变量")
+	}
+
+	accessToken, err := getAccessToken(corpID, corpSecret)
+	if err != nil {
+		return nil, fmt.Errorf("获取 access_token 失败: %w", err)
+	}
+
+	apiURL := fmt.Sprintf("%s/cgi-bin/externalcontact/get?access_token=%s&external_userid=%s",
+		wecomAPIBaseURL(), url.QueryEscape(accessToken), url.QueryEscape(externalUserID))
+
+	var result struct {
+		ErrCode         int                      `json:"errcode"`
+		ErrMsg          string                   `json:"errmsg"`
+		ExternalContact map[string]interface{}   `json:"external_contact"`
+		FollowUser      []map[string]interface{} `json:"follow_user"`
+	}
+	if err := getJSON(ctx, apiURL, nil, &result); err != nil {
+		return nil, err
+	}
+	if result.ErrCode != 0 {
+		return nil, fmt.Errorf("查询客户资料失败: errcode=%d, errmsg=%s", result.ErrCode, result.ErrMsg)
+	}
+
+	return map[string]interface{}{
+		"external_contact": result.ExternalContact,
+		"follow_user":      result.FollowUser,
+	}, nil
+}
+
+// pastConversationsArgs get_past_conversations 参数
+type pastConversationsArgs struct {
+	Limit int `json:"limit"`
+}
+
+// getPastConversationsTool 查询客户最近的会话消息，数据库可用时包括此前各次会话保存的消息
+func getPastConversationsTool(ctx context.Context, tc toolContext, args pastConversationsArgs) (interface{}, error) {
+	limit := args.Limit
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	return loadChatTranscript(tc.ChatID, limit)
+}
+
+// getOpenTicketsTool 从外部工单系统查询会话关联的未关闭工单
+// 请求 GET {TICKET_API_URL}?chat_id=...&status=open，响应 JSON 原样返回给 Agent
+func getOpenTicketsTool(ctx context.Context, tc toolContext, args struct{}) (interface{}, error) {
+	apiURL, err := url.Parse(os.Getenv("TICKET_API_URL"))
+	if err != nil {
+		return nil, fmt.Errorf("TICKET_API_URL 格式错误: %w", err)
+	}
+	query := apiURL.Query()
+	query.Set("chat_id", tc.ChatID)
+	query.Set("status", "open")
+	apiURL.RawQuery = query.Encode()
+
+	header := http.Header{}
+	if apiKey := os.Getenv("TICKET_API_KEY"); apiKey != "" {
+		header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	var result interface{}
+	if err := getJSON(ctx, apiURL.String(), header, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// getJSON 发送 GET 请求并解析 JSON 响应
+func getJSON(ctx context.Context, apiURL string, header http.Header, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %w", err)
+	}
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("发送请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("读取响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("请求返回错误状态码: %d, 响应: %s", resp.StatusCode, string(body))
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("解析响应失败: %w", err)
+	}
+	return nil
+}
+
+// ToolInvocation tool_invocations 表模型，工具调用审计日志
+type ToolInvocation struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	AgentID    string    `gorm:"type:varchar(255);index;not null" json:"agent_id"`
+	ChatID     string    `gorm:"type:varchar(255);index" json:"chat_id"`
+	ToolCallID string    `gorm:"type:varchar(255)" json:"tool_call_id"`
+	ToolName   string    `gorm:"type:varchar(100);index" json:"tool_name"`
+	Arguments  string    `gorm:"type:text" json:"arguments"`
+	Result     string    `gorm:"type:text" json:"result"`
+	Error      string    `gorm:"type:text" json:"error"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+}
+
+// TableName 指定表名
+func (ToolInvocation) TableName() string {
+	return "tool_invocations"
+}
+
+// createToolInvocation 记录工具调用审计日志
+func createToolInvocation(tc toolContext, call AgentToolCall, result AgentToolResult, duration time.Duration) error {
+	if db == nil {
+		return nil
+	}
+
+	resultJSON := ""
+	if result.Result != nil {
+		data, err := json.Marshal(result.Result)
+		if err != nil {
+			return fmt.Errorf("序列化工具调用结果失败: %w", err)
+		}
+		resultJSON = string(data)
+	}
+
+	invocation := ToolInvocation{
+		AgentID:    tc.AgentID,
+		ChatID:     tc.ChatID,
+		ToolCallID: call.ID,
+		ToolName:   call.Name,
+		Arguments:  string(call.Arguments),
+		Result:     resultJSON,
+		Error:      result.Error,
+		DurationMs: duration.Milliseconds(),
+	}
+	if err := db.Create(&invocation).Error; err != nil {
+		return fmt.Errorf("创建工具调用记录失败: %w", err)
+	}
+	return nil
+}
+
+// ToolInvocationsHandler 查询工具调用审计日志
+// GET /api/tool-invocations?agent_id=...&chat_id=...&tool=...&limit=100
+func ToolInvocationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if db == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "数据库未初始化")
+		return
+	}
+
+	query := db.Model(&ToolInvocation{}).Order("id DESC")
+	if agentID := r.URL.Query().Get("agent_id"); agentID != "" {
+		query = query.Where("agent_id = ?", agentID)
+	}
+	if chatID := r.URL.Query().Get("chat_id"); chatID != "" {
+		query = query.Where("chat_id = ?", chatID)
+	}
+	if tool := r.URL.Query().Get("tool"); tool != "" {
+		query = query.Where("tool_name = ?", tool)
+	}
+
+	limit := 100
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 1000 {
+		limit = l
+	}
+
+	var invocations []ToolInvocation
+	if err := query.Limit(limit).Find(&invocations).Error; err != nil {
+		logger.Error("查询工具调用记录失败", zap.Error(err))
+		writeJSONError(w, http.StatusInternalServerError, "查询工具调用记录失败")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"invocations": invocations,
+	})
+}
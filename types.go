@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"sync"
@@ -11,7 +12,11 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-var ErrSendBufferFull = errors.New("send buffer is full")
+var (
+	ErrSendBufferFull = errors.New("send buffer is full")
+	ErrCircuitOpen    = errors.New("agent circuit breaker is open")
+	ErrClientClosed   = errors.New("client is closed")
+)
 
 // TokenCache 缓存 access_token 和 jsapi_ticket
 type TokenCache struct {
@@ -51,6 +56,7 @@ type WeComClient struct {
 	AgentID        string
 	ChatID         string
 	Send           chan []byte
+	done           chan struct{} // 连接断开时关闭；Send 不关闭，避免异步发送在断开后 panic
 	mu             sync.Mutex
 	weworkSDK      *wework.SDK
 	pollSeq        uint64             // 轮询序列号
@@ -58,6 +64,15 @@ type WeComClient struct {
 	pollStop       chan struct{}      // 停止轮询信号
 	pollInterval   time.Duration      // 轮询间隔
 	pollIntervalCh chan time.Duration // 更新轮询间隔的通道
+	aiUnavailable  map[string]bool    // 后端地址 -> 是否已通知侧边栏 AI 建议暂停（熔断中）
+	Language       string             // 客服使用的语言，为空时使用 AGENT_LANGUAGE
+
+	ctx              context.Context               // 客户端生命周期，断开连接时取消
+	cancel           context.CancelFunc            // 取消客户端的所有 AI 请求
+	aiMu             sync.Mutex                    // 保护以下 AI 请求状态
+	aiGeneration     uint64                        // AI 请求序号
+	aiRequests       map[string]*inflightAIRequest // chatID -> 进行中的 AI 请求
+	shownSuggestions map[string][]string           // chatID -> 已展示但未处理的 suggestion_id
 }
 
 // WeComMessage 企业微信消息结构
@@ -71,6 +86,8 @@ type WeComMessage struct {
 	OriginalContent string          `json:"original_content,omitempty"`
 	EditedContent   string          `json:"edited_content,omitempty"`
 	MsgID           string          `json:"msg_id,omitempty"`
+	Language        string          `json:"language,omitempty"`  // auth 中为客服语言，ai_assistance_request 中为客户消息语言
+	OpenKfID        string          `json:"open_kfid,omitempty"` // ai_assistance_request 来自微信客服会话时为客服账号ID
 }
 
 // WeComHub WebSocket Hub
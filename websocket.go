@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"time"
@@ -40,7 +41,7 @@ func (h *WeComHub) Run() {
 		case client := <-h.Unregister:
 			if _, ok := h.Clients[client.AgentID]; ok {
 				delete(h.Clients, client.AgentID)
-				close(client.Send)
+				client.close()
 				// 停止轮询
 				client.stopPolling()
 				logger.Info("客服已断开", zap.String("agent_id", client.AgentID))
@@ -52,7 +53,7 @@ func (h *WeComHub) Run() {
 				select {
 				case client.Send <- message:
 				default:
-					close(client.Send)
+					client.close()
 					delete(h.Clients, client.AgentID)
 				}
 			}
@@ -60,13 +61,30 @@ func (h *WeComHub) Run() {
 	}
 }
 
+// close 标记客户端已断开，通知 writePump 退出，只在 Hub 协程中调用
+func (c *WeComClient) close() {
+	select {
+	case <-c.done:
+		// 已经关闭
+	default:
+		close(c.done)
+	}
+}
+
 // SendMessage 发送消息
+// AI 分析、摘要、自动回复等异步任务可能在客户端断开后才完成，此时丢弃消息并返回 ErrClientClosed
 func (c *WeComClient) SendMessage(data interface{}) error {
 	message, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
 
+	select {
+	case <-c.done:
+		return ErrClientClosed
+	default:
+	}
+
 	select {
 	case c.Send <- message:
 		return nil
@@ -92,13 +110,20 @@ func WeComWebSocketHandler(hub *WeComHub) http.HandlerFunc {
 			return
 		}
 
+		ctx, cancel := context.WithCancel(context.Background())
 		client := &WeComClient{
-			Conn:           conn,
-			Send:           make(chan []byte, 256),
-			pollSeq:        0,
-			pollStop:       make(chan struct{}),
-			pollInterval:   5 * time.Second,             // 默认5秒轮询一次
-			pollIntervalCh: make(chan time.Duration, 1), // 更新轮询间隔的通道
+			Conn:             conn,
+			Send:             make(chan []byte, 256),
+			done:             make(chan struct{}),
+			pollSeq:          0,
+			pollStop:         make(chan struct{}),
+			pollInterval:     5 * time.Second,             // 默认5秒轮询一次
+			pollIntervalCh:   make(chan time.Duration, 1), // 更新轮询间隔的通道
+			ctx:              ctx,
+			cancel:           cancel,
+			aiUnavailable:    make(map[string]bool),
+			aiRequests:       make(map[string]*inflightAIRequest),
+			shownSuggestions: make(map[string][]string),
 		}
 
 		// 启动读写协程
@@ -110,6 +135,8 @@ func WeComWebSocketHandler(hub *WeComHub) http.HandlerFunc {
 // readPump 读取消息
 func (c *WeComClient) readPump(hub *WeComHub) {
 	defer func() {
+		// 断开连接时取消所有进行中的 AI 请求
+		c.cancel()
 		hub.Unregister <- c
 		c.Conn.Close()
 	}()
@@ -147,8 +174,16 @@ func (c *WeComClient) handleMessage(data []byte, hub *WeComHub) {
 		// 认证消息，设置客户信息
 		c.AgentID = msg.AgentID
 		c.ChatID = msg.ChatID
+		if msg.Language != "" {
+			c.mu.Lock()
+			c.Language = msg.Language
+			c.mu.Unlock()
+		}
 		hub.Register <- c
 
+		// 同步自动回复开关
+		go c.sendAutoReplyStatus()
+
 	case "agent_message_sent":
 		// 客服发送了消息
 		logger.Info("客服发送了消息", zap.String("agent_id", c.AgentID))
@@ -164,6 +199,14 @@ func (c *WeComClient) handleMessage(data []byte, hub *WeComHub) {
 		// 请求AI协助（现在通过轮询触发，这里保留作为手动触发入口）
 		go c.handleAIAssistanceRequest(msg)
 
+	case "summarize_chat":
+		// 请求会话摘要（转接或次日继续跟进时使用）
+		go c.handleSummarizeChat(msg)
+
+	case "set_auto_reply":
+		// 开启或关闭自动回复，关闭立即生效
+		c.handleSetAutoReply(msg)
+
 	case "set_poll_interval":
 		// 设置轮询间隔
 		c.handleSetPollInterval(msg)
@@ -188,13 +231,14 @@ func (c *WeComClient) writePump() {
 
 	for {
 		select {
-		case message, ok := <-c.Send:
+		case <-c.done:
+			// 客户端已断开
+			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+			return
+
+		case message := <-c.Send:
 			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if !ok {
-				// 通道关闭
-				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
 
 			w, err := c.Conn.NextWriter(websocket.TextMessage)
 			if err != nil {
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSendMessageAfterClose(t *testing.T) {
+	c := &WeComClient{Send: make(chan []byte, 1), done: make(chan struct{})}
+
+	if err := c.SendMessage(map[string]string{"type": "ping"}); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if err := c.SendMessage(map[string]string{"type": "ping"}); !errors.Is(err, ErrSendBufferFull) {
+		t.Errorf("缓冲区满时应返回 ErrSendBufferFull，实际 %v", err)
+	}
+
+	c.close()
+	c.close() // 重复关闭不应 panic
+	<-c.Send
+	if err := c.SendMessage(map[string]string{"type": "ai_analysis"}); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("断开后应返回 ErrClientClosed，实际 %v", err)
+	}
+}